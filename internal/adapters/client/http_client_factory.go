@@ -7,13 +7,37 @@ import (
 	"github.com/hashicorp/go-retryablehttp"
 )
 
-type HTTPClientFactory struct{}
+// Spotify searches are paced at one every spotifyRateInterval, with bursts of up to spotifyRateBurst
+const (
+	spotifyRateInterval = 200 * time.Millisecond
+	spotifyRateBurst    = 5
+)
+
+type HTTPClientFactory struct {
+	// discogsLimiter is shared by every Discogs client, as Discogs limits the requests of the whole process
+	discogsLimiter *RateLimiter
+	// spotifyLimiter is shared by every Spotify client, as Spotify limits the requests of the app credentials
+	spotifyLimiter *TokenBucket
+}
 
 func NewHTTPClientFactory() *HTTPClientFactory {
-	return &HTTPClientFactory{}
+	return &HTTPClientFactory{
+		discogsLimiter: NewRateLimiter(),
+		spotifyLimiter: NewTokenBucket(spotifyRateInterval, spotifyRateBurst),
+	}
+}
+
+// SpotifyLimiter is the limiter of the Spotify clients, paused whenever Spotify answers 429,
+// for callers to wait on before sending bursts of requests
+func (f *HTTPClientFactory) SpotifyLimiter() *TokenBucket {
+	return f.spotifyLimiter
 }
 
 func (*HTTPClientFactory) CreateClient(timeout time.Duration, retryAttempts int, retryDelay time.Duration) HTTPClient {
+	return newRetryClient(timeout, retryAttempts, retryDelay).StandardClient()
+}
+
+func newRetryClient(timeout time.Duration, retryAttempts int, retryDelay time.Duration) *retryablehttp.Client {
 	retryClient := retryablehttp.NewClient()
 	retryClient.RetryMax = retryAttempts
 	retryClient.RetryWaitMin = retryDelay
@@ -23,18 +47,27 @@ func (*HTTPClientFactory) CreateClient(timeout time.Duration, retryAttempts int,
 
 	retryClient.Logger = nil // Disable default logger
 
-	return retryClient.StandardClient()
+	return retryClient
 }
 
 func (f *HTTPClientFactory) CreateDiscogsClient(timeout time.Duration, retryAttempts int, retryDelay time.Duration) HTTPClient {
-	client := f.CreateClient(timeout, retryAttempts, retryDelay)
+	retryClient := newRetryClient(timeout, retryAttempts, retryDelay)
+	// the rate limiter goes under the retries, so every attempt waits for its turn,
+	// and takes over the timeout so it doesn't count the wait
+	retryClient.HTTPClient.Timeout = 0
+	retryClient.HTTPClient.Transport = &rateLimitTransport{
+		base:    retryClient.HTTPClient.Transport,
+		limiter: f.discogsLimiter,
+		timeout: timeout,
+	}
+	client := retryClient.StandardClient()
 
-	transport := client.(*http.Client).Transport
+	transport := client.Transport
 	if transport == nil {
 		transport = http.DefaultTransport
 	}
 
-	client.(*http.Client).Transport = &userAgentTransport{
+	client.Transport = &userAgentTransport{
 		base:      transport,
 		userAgent: "DiscogsSpotify/1.0",
 	}
@@ -43,9 +76,16 @@ func (f *HTTPClientFactory) CreateDiscogsClient(timeout time.Duration, retryAtte
 }
 
 func (f *HTTPClientFactory) CreateSpotifyClient(timeout time.Duration, retryAttempts int, retryDelay time.Duration) HTTPClient {
-	client := f.CreateClient(timeout, retryAttempts, retryDelay)
+	retryClient := newRetryClient(timeout, retryAttempts, retryDelay)
+	// as with Discogs, every attempt waits for the pauses of 429 responses without counting it in the timeout
+	retryClient.HTTPClient.Timeout = 0
+	retryClient.HTTPClient.Transport = &retryAfterTransport{
+		base:    retryClient.HTTPClient.Transport,
+		limiter: f.spotifyLimiter,
+		timeout: timeout,
+	}
 
-	return client
+	return retryClient.StandardClient()
 }
 
 // userAgentTransport is a custom transport that adds a User-Agent header
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rate limit headers Discogs sends on every response, counting the requests of the last minute
+const (
+	rateLimitHeader          = "X-Discogs-Ratelimit"
+	rateLimitUsedHeader      = "X-Discogs-Ratelimit-Used"
+	rateLimitRemainingHeader = "X-Discogs-Ratelimit-Remaining"
+
+	rateLimitWindow = time.Minute
+	// requests are spaced out once less than this share of the limit remains
+	rateLimitReserve = 0.2
+	// limit assumed before Discogs tells it, the one of unauthenticated requests
+	defaultRateLimit = 25
+)
+
+// oauthTokenParam finds the token of an OAuth Authorization header, the rest of it changes on every request
+var oauthTokenParam = regexp.MustCompile(`oauth_token="([^"]*)"`)
+
+// RateLimiter throttles requests with the rate limit the responses report, so a single one is shared
+// by every client of the process. Discogs counts anonymous requests by source IP and authenticated ones
+// by account, with a higher limit, so every account is tracked apart from the others and the anonymous requests
+type RateLimiter struct {
+	mu      sync.Mutex
+	windows map[credentialKey]*rateWindow // by the account the requests are authenticated with
+	now     func() time.Time
+}
+
+// credentialKey identifies the account of a request without keeping its credentials, zero when anonymous
+type credentialKey [sha256.Size]byte
+
+type rateWindow struct {
+	limit     int // zero until a response reports it
+	remaining int
+	next      time.Time // earliest time the next request can be sent
+	used      time.Time // last time a request used it, windows unused for longer than rateLimitWindow are dropped
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{windows: make(map[credentialKey]*rateWindow), now: time.Now}
+}
+
+// reserve books the slot of the request and returns how long it has to wait for it. Requests go
+// out right away while the limit is far, and one every window/limit once it gets close
+func (l *RateLimiter) reserve(req *http.Request) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	window := l.window(req)
+	now := l.now()
+	at := now
+	if window.next.After(now) {
+		at = window.next
+	}
+	if window.limit > 0 && float64(window.remaining) <= float64(window.limit)*rateLimitReserve {
+		window.next = at.Add(rateLimitWindow / time.Duration(window.limit))
+	}
+	if window.remaining > 0 {
+		window.remaining-- // counts the requests in flight until their response updates it
+	}
+	return at.Sub(now)
+}
+
+// update reads the rate limit of the response, a 429 holds back the next requests for its Retry-After
+func (l *RateLimiter) update(req *http.Request, resp *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	window := l.window(req)
+	limit, err := strconv.Atoi(resp.Header.Get(rateLimitHeader))
+	if err == nil && limit > 0 {
+		window.limit = limit
+		if remaining, err := strconv.Atoi(resp.Header.Get(rateLimitRemainingHeader)); err == nil {
+			window.remaining = remaining
+		} else if used, err := strconv.Atoi(resp.Header.Get(rateLimitUsedHeader)); err == nil {
+			window.remaining = max(limit-used, 0)
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		window.remaining = 0
+		if window.limit == 0 {
+			window.limit = defaultRateLimit
+		}
+		delay, ok := retryAfter(resp)
+		if !ok {
+			delay = rateLimitWindow / time.Duration(window.limit)
+		}
+		if next := l.now().Add(delay); next.After(window.next) {
+			window.next = next
+		}
+	}
+}
+
+// window returns the window of the account of the request, must be called with the lock held
+func (l *RateLimiter) window(req *http.Request) *rateWindow {
+	key := requestCredentials(req)
+	now := l.now()
+	window, exists := l.windows[key]
+	if !exists {
+		// a full window later the limit has started over, so the windows of accounts gone quiet are forgotten
+		for other, stale := range l.windows {
+			if now.Sub(stale.used) > rateLimitWindow && !stale.next.After(now) {
+				delete(l.windows, other)
+			}
+		}
+		window = &rateWindow{}
+		l.windows[key] = window
+	}
+	window.used = now
+	return window
+}
+
+// requestCredentials returns the account the request is authenticated with
+func requestCredentials(req *http.Request) credentialKey {
+	authorization := req.Header.Get("Authorization")
+	if authorization == "" {
+		return credentialKey{}
+	}
+	if strings.HasPrefix(authorization, "OAuth ") {
+		if token := oauthTokenParam.FindStringSubmatch(authorization); token != nil {
+			authorization = "OAuth " + token[1]
+		}
+	}
+	return sha256.Sum256([]byte(authorization))
+}
+
+// rateLimitTransport waits for the rate limiter before every attempt of a request. The timeout
+// starts once the request is sent, so the time waiting for the limiter doesn't count
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *RateLimiter
+	timeout time.Duration
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := sleep(req.Context(), t.limiter.reserve(req)); err != nil {
+		return nil, err
+	}
+
+	resp, err := roundTripWithTimeout(t.base, req, t.timeout)
+	if err != nil {
+		return nil, err
+	}
+	t.limiter.update(req, resp)
+	return resp, nil
+}
+
+// roundTripWithTimeout sends the request, cancelling it after timeout unless its body is closed before
+func roundTripWithTimeout(base http.RoundTripper, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 {
+		return base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the timeout of the request once its body is read
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func rateLimitResponse(status int, limit, remaining string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(bytes.NewBufferString("{}"))}
+	resp.Header.Set(rateLimitHeader, limit)
+	resp.Header.Set(rateLimitRemainingHeader, remaining)
+	return resp
+}
+
+func oauthRequest(token, nonce string) *http.Request {
+	req := httptest.NewRequest("GET", "https://api.discogs.com/releases/1", http.NoBody)
+	req.Header.Set("Authorization", `OAuth oauth_nonce="`+nonce+`", oauth_token="`+token+`"`)
+	return req
+}
+
+func newTestRateLimiter(now time.Time) *RateLimiter {
+	limiter := NewRateLimiter()
+	limiter.now = func() time.Time { return now }
+	return limiter
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	anonymous := httptest.NewRequest("GET", "https://api.discogs.com/releases/1", http.NoBody)
+	authenticated := httptest.NewRequest("GET", "https://api.discogs.com/releases/1", http.NoBody)
+	authenticated.Header.Set("Authorization", "Discogs token=personal_token")
+	otherAccount := httptest.NewRequest("GET", "https://api.discogs.com/releases/1", http.NoBody)
+	otherAccount.Header.Set("Authorization", "Discogs token=other_token")
+
+	tests := []struct {
+		name     string
+		limited  *http.Request // request the response answers, anonymous when nil
+		response *http.Response
+		request  *http.Request
+		want     []time.Duration
+	}{
+		{
+			name:     "far from the limit",
+			response: rateLimitResponse(http.StatusOK, "60", "40"),
+			request:  anonymous,
+			want:     []time.Duration{0, 0, 0},
+		},
+		{
+			name:     "close to the limit",
+			response: rateLimitResponse(http.StatusOK, "60", "5"),
+			request:  anonymous,
+			want:     []time.Duration{0, time.Second, 2 * time.Second},
+		},
+		{
+			name: "used header",
+			response: func() *http.Response {
+				resp := rateLimitResponse(http.StatusOK, "25", "")
+				resp.Header.Del(rateLimitRemainingHeader)
+				resp.Header.Set(rateLimitUsedHeader, "25")
+				return resp
+			}(),
+			request: anonymous,
+			want:    []time.Duration{0, 2400 * time.Millisecond},
+		},
+		{
+			name: "too many requests",
+			response: func() *http.Response {
+				resp := rateLimitResponse(http.StatusTooManyRequests, "60", "0")
+				resp.Header.Set("Retry-After", "5")
+				return resp
+			}(),
+			request: anonymous,
+			want:    []time.Duration{5 * time.Second, 6 * time.Second},
+		},
+		{
+			name:     "authenticated requests are tracked apart",
+			response: rateLimitResponse(http.StatusOK, "25", "0"),
+			request:  authenticated,
+			want:     []time.Duration{0, 0},
+		},
+		{
+			name:     "every account is tracked apart",
+			limited:  authenticated,
+			response: rateLimitResponse(http.StatusOK, "60", "0"),
+			request:  otherAccount,
+			want:     []time.Duration{0, 0},
+		},
+		{
+			name:     "requests of the same account share the limit",
+			limited:  authenticated,
+			response: rateLimitResponse(http.StatusOK, "60", "0"),
+			request:  authenticated,
+			want:     []time.Duration{0, time.Second},
+		},
+		{
+			name:     "oauth requests of the same account share the limit",
+			limited:  oauthRequest("token", "nonce-1"),
+			response: rateLimitResponse(http.StatusOK, "60", "0"),
+			request:  oauthRequest("token", "nonce-2"),
+			want:     []time.Duration{0, time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newTestRateLimiter(now)
+			limited := tt.limited
+			if limited == nil {
+				limited = anonymous
+			}
+			limiter.update(limited, tt.response)
+
+			for i, want := range tt.want {
+				if got := limiter.reserve(tt.request); got != want {
+					t.Errorf("request %d got wait %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+type stubRoundTripper struct {
+	responses []*http.Response
+	calls     int
+}
+
+func (s *stubRoundTripper) RoundTrip(_ *http.Request) (*http.Response, error) {
+	resp := s.responses[s.calls]
+	s.calls++
+	return resp, nil
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	base := &stubRoundTripper{responses: []*http.Response{rateLimitResponse(http.StatusOK, "60", "0")}}
+	limiter := NewRateLimiter()
+	transport := &rateLimitTransport{base: base, limiter: limiter, timeout: time.Second}
+
+	resp, err := transport.RoundTrip(httptest.NewRequest("GET", "https://api.discogs.com/releases/1", http.NoBody))
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		t.Errorf("did not expect error, got %v", err)
+	}
+
+	// the limit is reached, the next request is spaced a second away
+	if wait := limiter.reserve(httptest.NewRequest("GET", "https://api.discogs.com/releases/2", http.NoBody)); wait != 0 {
+		t.Errorf("got wait %v, want 0", wait)
+	}
+	if wait := limiter.reserve(httptest.NewRequest("GET", "https://api.discogs.com/releases/3", http.NoBody)); wait <= 0 || wait > time.Second {
+		t.Errorf("got wait %v, want up to a second", wait)
+	}
+}
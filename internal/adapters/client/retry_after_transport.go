@@ -0,0 +1,52 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryAfterTransport pauses the limiter for the Retry-After of 429 responses, holding back every caller
+// sharing it, and waits for the pause before every attempt. The timeout starts once the request is sent
+type retryAfterTransport struct {
+	base    http.RoundTripper
+	limiter *TokenBucket
+	timeout time.Duration
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.WaitPause(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := roundTripWithTimeout(t.base, req, t.timeout)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		delay, ok := retryAfter(resp)
+		if !ok {
+			delay = defaultRetryAfter
+		}
+		t.limiter.Pause(delay)
+	}
+	return resp, nil
+}
+
+// pause when a 429 comes without Retry-After
+const defaultRetryAfter = time.Second
+
+// retryAfter parses the Retry-After header, in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket lets requests through at a steady rate, with bursts of up to burst requests after idle
+// periods. Pause holds back every caller, like when the API answers 429
+type TokenBucket struct {
+	mu          sync.Mutex
+	interval    time.Duration // time to refill a token
+	burst       int
+	tokens      float64 // negative when requests are waiting for tokens
+	last        time.Time
+	pausedUntil time.Time
+	now         func() time.Time
+}
+
+func NewTokenBucket(interval time.Duration, burst int) *TokenBucket {
+	return &TokenBucket{interval: interval, burst: burst, tokens: float64(burst), now: time.Now}
+}
+
+// Wait takes a token, waiting for it as long as needed. Callers woken during a pause wait for it too
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if err := sleep(ctx, b.reserve()); err != nil {
+		return err
+	}
+	return b.WaitPause(ctx)
+}
+
+// WaitPause waits until the bucket isn't paused, without taking a token
+func (b *TokenBucket) WaitPause(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		left := b.pausedUntil.Sub(b.now())
+		b.mu.Unlock()
+		if left <= 0 {
+			return ctx.Err()
+		}
+		if err := sleep(ctx, left); err != nil {
+			return err
+		}
+	}
+}
+
+// Pause holds back every caller for d, the bucket refills from empty once it's over
+func (b *TokenBucket) Pause(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.refill(now)
+	until := now.Add(d)
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+	b.tokens = min(b.tokens, 0)
+	if until.After(b.last) {
+		b.last = until
+	}
+}
+
+// reserve takes a token, returning how long it takes to be refilled when there are none left
+func (b *TokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.refill(now)
+	b.tokens--
+
+	wait := b.last.Sub(now) // tokens refill from the end of a pause
+	if b.tokens < 0 {
+		wait += time.Duration(-b.tokens * float64(b.interval))
+	}
+	return wait
+}
+
+// refill adds the tokens refilled since the last reservation, none during a pause
+func (b *TokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = min(float64(b.burst), b.tokens+float64(now.Sub(b.last))/float64(b.interval))
+		b.last = now
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bucket := NewTokenBucket(200*time.Millisecond, 2)
+	bucket.now = func() time.Time { return now }
+	bucket.last = now
+
+	// the burst goes through, the next requests are paced
+	want := []time.Duration{0, 0, 200 * time.Millisecond, 400 * time.Millisecond}
+	for i, want := range want {
+		if got := bucket.reserve(); got != want {
+			t.Errorf("request %d got wait %v, want %v", i, got, want)
+		}
+	}
+
+	// once idle the bucket refills up to the burst
+	now = now.Add(10 * time.Second)
+	for i, want := range []time.Duration{0, 0, 200 * time.Millisecond} {
+		if got := bucket.reserve(); got != want {
+			t.Errorf("request %d after idle got wait %v, want %v", i, got, want)
+		}
+	}
+
+	// a pause empties the bucket, which refills once it's over
+	now = now.Add(10 * time.Second)
+	bucket.Pause(3 * time.Second)
+	for i, want := range []time.Duration{3200 * time.Millisecond, 3400 * time.Millisecond} {
+		if got := bucket.reserve(); got != want {
+			t.Errorf("request %d after pause got wait %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestTokenBucketWaitCancelled(t *testing.T) {
+	bucket := NewTokenBucket(time.Minute, 1)
+	bucket.Pause(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bucket.Wait(ctx); err == nil {
+		t.Errorf("got no error, want the context cancellation")
+	}
+}
+
+func TestRetryAfterTransport(t *testing.T) {
+	tooManyRequests := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}, Body: http.NoBody}
+	tooManyRequests.Header.Set("Retry-After", "2")
+	base := &stubRoundTripper{responses: []*http.Response{tooManyRequests}}
+	bucket := NewTokenBucket(200*time.Millisecond, 5)
+	transport := &retryAfterTransport{base: base, limiter: bucket, timeout: time.Second}
+
+	resp, err := transport.RoundTrip(httptest.NewRequest("GET", "https://api.spotify.com/v1/search", http.NoBody))
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	resp.Body.Close()
+
+	// every caller of the bucket waits for the Retry-After
+	if wait := bucket.reserve(); wait < time.Second || wait > 2200*time.Millisecond {
+		t.Errorf("got wait %v, want the 2s of Retry-After", wait)
+	}
+}
@@ -0,0 +1,222 @@
+package discogs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	httpClient "github.com/martiriera/discogs-spotify/internal/adapters/client"
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+)
+
+const (
+	requestTokenURL = basePath + "/oauth/request_token"
+	accessTokenURL  = basePath + "/oauth/access_token"
+	identityURL     = basePath + "/oauth/identity"
+	authorizeURL    = "https://www.discogs.com/oauth/authorize"
+)
+
+// OAuthConsumer is the key and secret of the application registered in the Discogs developer settings
+type OAuthConsumer struct {
+	Key    string
+	Secret string
+}
+
+// AuthService implements the Discogs OAuth 1.0a flow, signing with PLAINTEXT as Discogs only serves HTTPS
+type AuthService struct {
+	client   httpClient.HTTPClient
+	consumer OAuthConsumer
+}
+
+func NewAuthService(client httpClient.HTTPClient, consumer OAuthConsumer) *AuthService {
+	return &AuthService{client: client, consumer: consumer}
+}
+
+func (s *AuthService) RequestToken(ctx context.Context, callbackURL string) (token, secret string, err error) {
+	header := oauthHeader(s.consumer, map[string]string{"oauth_callback": callbackURL}, "")
+	values, err := s.requestForm(ctx, http.MethodGet, requestTokenURL, header)
+	if err != nil {
+		return "", "", err
+	}
+	if values.Get("oauth_token") == "" {
+		return "", "", errors.Wrap(ErrResponse, "no request token")
+	}
+	return values.Get("oauth_token"), values.Get("oauth_token_secret"), nil
+}
+
+func (*AuthService) AuthorizeURL(token string) string {
+	return authorizeURL + "?oauth_token=" + url.QueryEscape(token)
+}
+
+func (s *AuthService) AccessToken(
+	ctx context.Context,
+	token, secret, verifier string,
+) (*entities.DiscogsCredentials, error) {
+	header := oauthHeader(s.consumer, map[string]string{"oauth_token": token, "oauth_verifier": verifier}, secret)
+	values, err := s.requestForm(ctx, http.MethodPost, accessTokenURL, header)
+	if err != nil {
+		return nil, err
+	}
+	if values.Get("oauth_token") == "" {
+		return nil, errors.Wrap(ErrResponse, "no access token")
+	}
+	return &entities.DiscogsCredentials{
+		OAuthToken:  values.Get("oauth_token"),
+		OAuthSecret: values.Get("oauth_token_secret"),
+	}, nil
+}
+
+func (s *AuthService) Identity(ctx context.Context, credentials *entities.DiscogsCredentials) (string, error) {
+	body, err := s.request(ctx, http.MethodGet, identityURL, authorization(s.consumer, credentials))
+	if err != nil {
+		return "", err
+	}
+	var identity entities.DiscogsIdentity
+	if err := json.Unmarshal(body, &identity); err != nil {
+		return "", errors.Wrap(ErrResponse, err.Error())
+	}
+	return identity.Username, nil
+}
+
+// requestForm sends a request of the OAuth flow, which answers with a form encoded body
+func (s *AuthService) requestForm(ctx context.Context, method, endpoint, header string) (url.Values, error) {
+	body, err := s.request(ctx, method, endpoint, header)
+	if err != nil {
+		return nil, err
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errors.Wrap(ErrResponse, err.Error())
+	}
+	return values, nil
+}
+
+func (s *AuthService) request(ctx context.Context, method, endpoint, header string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(ErrRequest, err.Error())
+	}
+	req.Header.Set("Authorization", header)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(ErrRequest, err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(ErrResponse, err.Error())
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, errorWrapper.Wrap(errorWrapper.ErrUnauthorized, "discogs credentials rejected")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(ErrUnexpectedStatus, "status: %d, body: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// authenticatedClient signs every request with the Discogs account linked by the user of its context,
+// requests of users without one are sent as they are
+type authenticatedClient struct {
+	client   httpClient.HTTPClient
+	contexts ports.ContextPort
+	consumer OAuthConsumer
+}
+
+func (c *authenticatedClient) Do(req *http.Request) (*http.Response, error) {
+	resp, _, err := c.DoSigned(req)
+	return resp, err
+}
+
+// DoSigned sends a copy of the request signed with the linked account, leaving req as it is,
+// and reports whether it was signed
+func (c *authenticatedClient) DoSigned(req *http.Request) (*http.Response, bool, error) {
+	credentials, err := c.contexts.GetDiscogsCredentials(req.Context())
+	if err != nil {
+		return nil, false, errors.Wrap(ErrRequest, err.Error())
+	}
+	if credentials == nil {
+		resp, err := c.client.Do(req)
+		return resp, false, err
+	}
+
+	signed := req.Clone(req.Context())
+	signed.Header.Set("Authorization", authorization(c.consumer, credentials))
+	resp, err := c.client.Do(signed)
+	return resp, true, err
+}
+
+// signingClient sends requests signed with the Discogs account linked by their user, when there's one
+type signingClient interface {
+	DoSigned(req *http.Request) (resp *http.Response, signed bool, err error)
+}
+
+// doSigned sends the request, reporting whether it was signed with a linked Discogs account
+func doSigned(client httpClient.HTTPClient, req *http.Request) (*http.Response, bool, error) {
+	if signer, ok := client.(signingClient); ok {
+		return signer.DoSigned(req)
+	}
+	resp, err := client.Do(req)
+	return resp, false, err
+}
+
+// authorization returns the Authorization header of the credentials
+func authorization(consumer OAuthConsumer, credentials *entities.DiscogsCredentials) string {
+	if credentials.IsOAuth() {
+		return oauthHeader(consumer, map[string]string{"oauth_token": credentials.OAuthToken}, credentials.OAuthSecret)
+	}
+	return "Discogs token=" + credentials.PersonalToken
+}
+
+// oauthHeader builds an OAuth 1.0a header signed with PLAINTEXT, tokenSecret is empty until there's a token
+func oauthHeader(consumer OAuthConsumer, params map[string]string, tokenSecret string) string {
+	values := map[string]string{
+		"oauth_consumer_key":     consumer.Key,
+		"oauth_nonce":            nonce(),
+		"oauth_signature":        percentEncode(consumer.Secret) + "&" + percentEncode(tokenSecret),
+		"oauth_signature_method": "PLAINTEXT",
+		"oauth_timestamp":        strconv.FormatInt(time.Now().Unix(), 10),
+		"oauth_version":          "1.0",
+	}
+	for key, value := range params {
+		values[key] = value
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + `="` + percentEncode(values[key]) + `"`
+	}
+	return "OAuth " + strings.Join(parts, ", ")
+}
+
+// percentEncode encodes as RFC 5849 asks, spaces as %20 instead of +
+func percentEncode(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func nonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,184 @@
+package discogs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+)
+
+// credentialsContext links the same Discogs account to every context
+type credentialsContext struct {
+	credentials *entities.DiscogsCredentials
+}
+
+func (*credentialsContext) GetToken(_ context.Context) (*oauth2.Token, error) {
+	return nil, nil
+}
+
+func (*credentialsContext) SetToken(_ context.Context, _ *oauth2.Token) error {
+	return nil
+}
+
+func (*credentialsContext) GetUserID(_ context.Context) (string, error) {
+	return "", nil
+}
+
+func (*credentialsContext) SetUserID(_ context.Context, _ string) error {
+	return nil
+}
+
+func (c *credentialsContext) GetDiscogsCredentials(_ context.Context) (*entities.DiscogsCredentials, error) {
+	return c.credentials, nil
+}
+
+func TestAuthenticatedRequests(t *testing.T) {
+	consumer := OAuthConsumer{Key: "consumer_key", Secret: "consumer secret"}
+	tests := []struct {
+		name        string
+		credentials *entities.DiscogsCredentials
+		want        []string
+	}{
+		{
+			name:        "anonymous",
+			credentials: nil,
+			want:        nil,
+		},
+		{
+			name:        "personal token",
+			credentials: &entities.DiscogsCredentials{PersonalToken: "personal_token"},
+			want:        []string{"Discogs token=personal_token"},
+		},
+		{
+			name:        "oauth",
+			credentials: &entities.DiscogsCredentials{OAuthToken: "oauth_token", OAuthSecret: "oauth_secret"},
+			want: []string{
+				`OAuth oauth_consumer_key="consumer_key"`,
+				`oauth_signature="consumer%2520secret%26oauth_secret"`,
+				`oauth_signature_method="PLAINTEXT"`,
+				`oauth_token="oauth_token"`,
+				`oauth_version="1.0"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{{
+				StatusCode: 200,
+				Body:       io.NopCloser(bytes.NewBufferString(generateResponseBody(t, "wants"))),
+			}}}
+			service := NewHTTPServiceWithOptions(stubClient, Options{
+				Credentials: &credentialsContext{credentials: tt.credentials},
+				Consumer:    consumer,
+			})
+
+			if _, err := service.GetWantlistReleases(context.Background(), "digger"); err != nil {
+				t.Fatalf("did not expect error, got %v", err)
+			}
+
+			header := stubClient.Headers[0].Get("Authorization")
+			if tt.want == nil && header != "" {
+				t.Errorf("got Authorization %q, want none", header)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(header, want) {
+					t.Errorf("got Authorization %q, want it to contain %q", header, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticatedRequestRejected(t *testing.T) {
+	stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{{
+		StatusCode: 401,
+		Body:       io.NopCloser(bytes.NewBufferString(`{"message": "You must authenticate to access this resource."}`)),
+	}}}
+	service := NewHTTPServiceWithOptions(stubClient, Options{
+		Credentials: &credentialsContext{credentials: &entities.DiscogsCredentials{PersonalToken: "revoked"}},
+	})
+
+	_, err := service.GetCollectionReleases(context.Background(), "digger", 0)
+	if !errors.Is(err, ErrUnauthorized) || !strings.Contains(err.Error(), "link rejected") {
+		t.Errorf("got error %v, want the rejected link", err)
+	}
+}
+
+func TestAuthService(t *testing.T) {
+	formResponse := func(body string) http.Response {
+		return http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(body))}
+	}
+	stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{
+		formResponse("oauth_token=request_token&oauth_token_secret=request_secret&oauth_callback_confirmed=true"),
+		formResponse("oauth_token=access_token&oauth_token_secret=access_secret"),
+		formResponse(`{"id": 1, "username": "digger", "resource_url": "https://api.discogs.com/users/digger"}`),
+		{StatusCode: 401, Body: io.NopCloser(bytes.NewBufferString(`{"message": "Invalid consumer."}`))},
+	}}
+	service := NewAuthService(stubClient, OAuthConsumer{Key: "consumer_key", Secret: "consumer_secret"})
+	ctx := context.Background()
+
+	token, secret, err := service.RequestToken(ctx, "http://localhost:8080/auth/discogs/callback")
+	if err != nil || token != "request_token" || secret != "request_secret" {
+		t.Fatalf("got %s, %s, %v, want the request token", token, secret, err)
+	}
+	if header := stubClient.Headers[0].Get("Authorization"); !strings.Contains(header,
+		`oauth_callback="http%3A%2F%2Flocalhost%3A8080%2Fauth%2Fdiscogs%2Fcallback"`) {
+		t.Errorf("got Authorization %q, want the callback", header)
+	}
+	if got, want := service.AuthorizeURL(token), "https://www.discogs.com/oauth/authorize?oauth_token=request_token"; got != want {
+		t.Errorf("got authorize URL %s, want %s", got, want)
+	}
+
+	credentials, err := service.AccessToken(ctx, token, secret, "verifier")
+	if err != nil || credentials.OAuthToken != "access_token" || credentials.OAuthSecret != "access_secret" {
+		t.Fatalf("got %v, %v, want the access token", credentials, err)
+	}
+	header := stubClient.Headers[1].Get("Authorization")
+	if !strings.Contains(header, `oauth_verifier="verifier"`) || !strings.Contains(header, `oauth_signature="consumer_secret%26request_secret"`) {
+		t.Errorf("got Authorization %q, want the verifier signed with the request secret", header)
+	}
+
+	username, err := service.Identity(ctx, credentials)
+	if err != nil || username != "digger" {
+		t.Errorf("got %s, %v, want digger", username, err)
+	}
+
+	if _, err := service.Identity(ctx, credentials); !errorWrapper.Is(err, errorWrapper.ErrUnauthorized) {
+		t.Errorf("got error %v, want unauthorized", err)
+	}
+}
+
+func TestAuthenticatedClientKeepsRequest(t *testing.T) {
+	stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{{StatusCode: 200, Body: http.NoBody}}}
+	client := &authenticatedClient{
+		client:   stubClient,
+		contexts: &credentialsContext{credentials: &entities.DiscogsCredentials{PersonalToken: "personal_token"}},
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, basePath+"/users/digger/wants", http.NoBody)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+
+	_, signed, err := client.DoSigned(req)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if !signed {
+		t.Error("expected the request to be signed")
+	}
+	if header := stubClient.Headers[0].Get("Authorization"); header != "Discogs token=personal_token" {
+		t.Errorf("got Authorization %q sent, want the personal token", header)
+	}
+	if header := req.Header.Get("Authorization"); header != "" {
+		t.Errorf("got Authorization %q on the caller's request, want none", header)
+	}
+}
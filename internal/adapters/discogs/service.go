@@ -3,12 +3,18 @@ package discogs
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
 	httpClient "github.com/martiriera/discogs-spotify/internal/adapters/client"
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
 
 	"github.com/pkg/errors"
 )
@@ -19,23 +25,61 @@ var ErrRequest = errors.New("discogs request error")
 var ErrResponse = errors.New("discogs response error")
 
 type HTTPService struct {
-	client httpClient.HTTPClient
+	client      httpClient.HTTPClient
+	pageWorkers int
 }
 
 const basePath = "https://api.discogs.com"
 
+// Options configures the requests of HTTPService
+type Options struct {
+	// Credentials provides the Discogs account linked by the user of each request, requests are anonymous when nil
+	Credentials ports.ContextPort
+	// Consumer signs the requests of accounts linked with OAuth
+	Consumer OAuthConsumer
+	// PageWorkers fetches up to that many pages at once after the first page tells how many there are,
+	// pages are fetched one after the other when it's 0 or 1
+	PageWorkers int
+}
+
 func NewHTTPService(client httpClient.HTTPClient) *HTTPService {
-	return &HTTPService{client: client}
+	return NewHTTPServiceWithOptions(client, Options{})
+}
+
+func NewHTTPServiceWithOptions(client httpClient.HTTPClient, options Options) *HTTPService {
+	if options.Credentials != nil {
+		client = &authenticatedClient{client: client, contexts: options.Credentials, consumer: options.Consumer}
+	}
+	if options.PageWorkers < 1 {
+		options.PageWorkers = 1
+	}
+	return &HTTPService{client: client, pageWorkers: options.PageWorkers}
+}
+
+func (s *HTTPService) GetCollectionReleases(
+	ctx context.Context,
+	username string,
+	folderID int,
+) ([]entities.DiscogsRelease, error) {
+	url := fmt.Sprintf(
+		"%s/users/%s/collection/folders/%d/releases?per_page=100&sort=artist&sort_order=asc",
+		basePath, username, folderID,
+	)
+	return s.paginate(ctx, url)
 }
 
-func (s *HTTPService) GetCollectionReleases(ctx context.Context, username string) ([]entities.DiscogsRelease, error) {
-	url := basePath + "/users/" + username + "/collection/folders/0/releases?per_page=100&sort=artist&sort_order=asc"
-	return paginate(ctx, s.client, url)
+// GetCollectionFolders lists the folders of the collection, only the "All" folder unless it's the owner's
+func (s *HTTPService) GetCollectionFolders(ctx context.Context, username string) ([]entities.DiscogsFolder, error) {
+	var response entities.DiscogsFoldersResponse
+	if err := getJSON(ctx, s.client, basePath+"/users/"+username+"/collection/folders", &response); err != nil {
+		return nil, err
+	}
+	return response.Folders, nil
 }
 
 func (s *HTTPService) GetWantlistReleases(ctx context.Context, username string) ([]entities.DiscogsRelease, error) {
 	url := basePath + "/users/" + username + "/wants?per_page=100&sort=artist&sort_order=asc"
-	return paginate(ctx, s.client, url)
+	return s.paginate(ctx, url)
 }
 
 func (s *HTTPService) GetListReleases(ctx context.Context, listID string) ([]entities.DiscogsRelease, error) {
@@ -44,65 +88,259 @@ func (s *HTTPService) GetListReleases(ctx context.Context, listID string) ([]ent
 	if err != nil {
 		return nil, err
 	}
+	notifyPage(ctx, response.GetPagination())
 	return response.GetReleases(), nil
 }
 
-func paginate(ctx context.Context, client httpClient.HTTPClient, url string) ([]entities.DiscogsRelease, error) {
+// GetArtistReleases returns the masters of the artist discography, oldest first
+func (s *HTTPService) GetArtistReleases(ctx context.Context, artistID string) ([]entities.DiscogsRelease, error) {
+	url := basePath + "/artists/" + artistID + "/releases?per_page=100&sort=year&sort_order=asc"
+	return s.paginate(ctx, url)
+}
+
+func (s *HTTPService) GetRelease(ctx context.Context, releaseID string) (*entities.DiscogsReleaseDetail, error) {
+	var release entities.DiscogsReleaseDetail
+	if err := getJSON(ctx, s.client, basePath+"/releases/"+releaseID, &release); err != nil {
+		return nil, err
+	}
+	notifyPage(ctx, entities.DiscogsPagination{})
+	return &release, nil
+}
+
+func (s *HTTPService) GetMaster(ctx context.Context, masterID string) (*entities.DiscogsMaster, error) {
+	var master entities.DiscogsMaster
+	if err := getJSON(ctx, s.client, basePath+"/masters/"+masterID, &master); err != nil {
+		return nil, err
+	}
+	notifyPage(ctx, entities.DiscogsPagination{})
+	return &master, nil
+}
+
+// GetLabelReleases returns the label catalog, oldest first, with a single release for the pressings of the same master
+func (s *HTTPService) GetLabelReleases(ctx context.Context, labelID string) ([]entities.DiscogsRelease, error) {
+	url := basePath + "/labels/" + labelID + "/releases?per_page=100&sort=year&sort_order=asc"
+	// pressings are collapsed across pages, so the pages aren't handed out before the last one is in
+	releases, err := s.paginate(ports.WithPageReleases(ctx, nil), url)
+	if err != nil {
+		return nil, err
+	}
+	return collapsePressings(releases), nil
+}
+
+// collapsePressings keeps the first release of every master, or of every artist and title when
+// there's no master ID, taking the earliest known year of its pressings
+func collapsePressings(releases []entities.DiscogsRelease) []entities.DiscogsRelease {
+	collapsed := make([]entities.DiscogsRelease, 0, len(releases))
+	seen := make(map[string]int)
+	for _, release := range releases {
+		info := release.BasicInformation
+		key := "master-" + strconv.Itoa(info.MasterID)
+		if info.MasterID == 0 {
+			artist := ""
+			if len(info.Artists) > 0 {
+				artist = entities.NormalizeName(info.Artists[0].Name)
+			}
+			key = artist + "|" + entities.NormalizeName(info.Title)
+		}
+
+		i, exists := seen[key]
+		if !exists {
+			seen[key] = len(collapsed)
+			collapsed = append(collapsed, release)
+			continue
+		}
+		kept := &collapsed[i].BasicInformation
+		if info.Year != 0 && (kept.Year == 0 || info.Year < kept.Year) {
+			kept.Year = info.Year
+		}
+	}
+	return collapsed
+}
+
+// paginate returns the releases of every page in order, following the next page URLs
+// or fetching the remaining pages at once when the service has page workers
+func (s *HTTPService) paginate(ctx context.Context, url string) ([]entities.DiscogsRelease, error) {
 	result := make([]entities.DiscogsRelease, 0)
-	response, err := doRequest(ctx, client, url)
+	response, err := doRequest(ctx, s.client, url)
 	if err != nil {
 		return nil, err
 	}
 	result = append(result, response.GetReleases()...)
-	for response.GetPagination().Urls.Next != "" {
-		response, err = doRequest(ctx, client, response.GetPagination().Urls.Next)
+	notifyPage(ctx, response.GetPagination())
+	notifyPageReleases(ctx, 1, response.GetReleases())
+
+	pages := response.GetPagination().Pages
+	if s.pageWorkers > 1 && pages > 2 {
+		rest, err := s.fetchPages(ctx, url, pages)
+		if err != nil {
+			return nil, err
+		}
+		return append(result, rest...), nil
+	}
+
+	for page := 2; response.GetPagination().Urls.Next != ""; page++ {
+		response, err = doRequest(ctx, s.client, response.GetPagination().Urls.Next)
 		if err != nil {
 			return nil, err
 		}
 		result = append(result, response.GetReleases()...)
+		notifyPage(ctx, response.GetPagination())
+		notifyPageReleases(ctx, page, response.GetReleases())
 	}
 	return result, nil
 }
 
+// fetchPages fetches pages 2 to pages of the URL with the page workers of the service and returns
+// their releases in page order, the first error stops the pages left.
+// The shared Discogs rate limiter of the client keeps the workers within the rate limit
+func (s *HTTPService) fetchPages(ctx context.Context, url string, pages int) ([]entities.DiscogsRelease, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pageReleases := make([][]entities.DiscogsRelease, pages+1)
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for page := 2; page <= pages; page++ {
+			select {
+			case next <- page:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	fetched := 1
+	var firstErr error
+	// fail keeps the error that stopped the pages, not those of the requests it cancelled
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+	var wg sync.WaitGroup
+	for range min(s.pageWorkers, pages-1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range next {
+				pageURL, err := withPage(url, page)
+				if err != nil {
+					fail(err)
+					return
+				}
+				response, err := doRequest(ctx, s.client, pageURL)
+				if err != nil {
+					fail(err)
+					return
+				}
+				pageReleases[page] = response.GetReleases()
+				notifyPageReleases(ctx, page, response.GetReleases())
+
+				// pages complete out of order, listeners are told how many are in
+				mu.Lock()
+				fetched++
+				ports.NotifyPageFetched(ctx, fetched, pages)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(ErrRequest, err.Error())
+	}
+	result := make([]entities.DiscogsRelease, 0)
+	for _, releases := range pageReleases {
+		result = append(result, releases...)
+	}
+	return result, nil
+}
+
+// withPage sets the page query parameter of a paginated URL
+func withPage(rawURL string, page int) (string, error) {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrap(ErrRequest, err.Error())
+	}
+	query := parsed.Query()
+	query.Set("page", strconv.Itoa(page))
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+func notifyPage(ctx context.Context, pagination entities.DiscogsPagination) {
+	page, pages := pagination.Page, pagination.Pages
+	if pages == 0 {
+		page, pages = 1, 1
+	}
+	ports.NotifyPageFetched(ctx, page, pages)
+}
+
+// notifyPageReleases hands a copy of the page to the listener, which may change its releases
+// while the page is still being put together with the others
+func notifyPageReleases(ctx context.Context, page int, releases []entities.DiscogsRelease) {
+	ports.NotifyPageReleases(ctx, page, slices.Clone(releases))
+}
+
 func doRequest(ctx context.Context, client httpClient.HTTPClient, url string) (entities.DiscogsResponse, error) {
+	var response entities.DiscogsResponse
+	switch {
+	case strings.Contains(url, "collection"):
+		response = &entities.DiscogsCollectionResponse{}
+	case strings.Contains(url, "wants"):
+		response = &entities.DiscogsWantlistResponse{}
+	case strings.Contains(url, "lists"):
+		response = &entities.DiscogsListResponse{}
+	case strings.Contains(url, "artists"):
+		response = &entities.DiscogsArtistReleasesResponse{}
+	case strings.Contains(url, "labels"):
+		response = &entities.DiscogsLabelReleasesResponse{}
+	default:
+		return nil, errors.Wrapf(ErrResponse, "unknown response type for URL: %s", url)
+	}
+
+	if err := getJSON(ctx, client, url, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// getJSON requests the URL and decodes its JSON body into v
+func getJSON(ctx context.Context, client httpClient.HTTPClient, url string, v any) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
 	if err != nil {
-		return nil, errors.Wrap(ErrRequest, err.Error())
+		return errors.Wrap(ErrRequest, err.Error())
 	}
-	resp, err := client.Do(req)
+	resp, signed, err := doSigned(client, req)
 	if err != nil {
-		return nil, errors.Wrap(ErrRequest, err.Error())
+		return errors.Wrap(ErrRequest, err.Error())
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, errors.Wrap(ErrUnauthorized, "private resource")
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized && signed:
+		return errors.Wrap(ErrUnauthorized, "discogs account link rejected")
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errors.Wrap(ErrUnauthorized, "private resource")
+	case resp.StatusCode == http.StatusForbidden:
+		return errors.Wrap(ErrUnauthorized, "resource not shared with the linked discogs account")
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, errors.Wrapf(ErrUnexpectedStatus, "status: %d, body: %s", resp.StatusCode, string(bodyBytes))
+		return errors.Wrapf(ErrUnexpectedStatus, "status: %d, body: %s", resp.StatusCode, string(bodyBytes))
 	}
 
-	if strings.Contains(url, "collection") {
-		var response entities.DiscogsCollectionResponse
-		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			return nil, errors.Wrap(ErrResponse, err.Error())
-		}
-		return &response, nil
-	} else if strings.Contains(url, "wants") {
-		var response entities.DiscogsWantlistResponse
-		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			return nil, errors.Wrap(ErrResponse, err.Error())
-		}
-		return &response, nil
-	} else if strings.Contains(url, "lists") {
-		var response entities.DiscogsListResponse
-		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			return nil, errors.Wrap(ErrResponse, err.Error())
-		}
-		return &response, nil
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrap(ErrResponse, err.Error())
 	}
-
-	return nil, errors.Wrapf(ErrResponse, "unknown response type for URL: %s", url)
+	return nil
 }
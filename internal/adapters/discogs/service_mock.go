@@ -2,19 +2,61 @@ package discogs
 
 import (
 	"context"
+	"slices"
 
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
 )
 
 type ServiceMock struct {
 	Response []entities.DiscogsRelease
-	Error    error
+	// Pages are handed to the page releases listener of the collection requests in PageOrder, page 1 first
+	// when empty, and make up their response
+	Pages     [][]entities.DiscogsRelease
+	PageOrder []int
+	Folders   []entities.DiscogsFolder
+	Release   *entities.DiscogsReleaseDetail
+	Master    *entities.DiscogsMaster
+	Error     error
 }
 
-func (m *ServiceMock) GetCollectionReleases(_ context.Context, _ string) ([]entities.DiscogsRelease, error) {
+func (m *ServiceMock) GetCollectionReleases(ctx context.Context, _ string, _ int) ([]entities.DiscogsRelease, error) {
+	if m.Pages == nil {
+		return m.Response, m.Error
+	}
+	order := m.PageOrder
+	if order == nil {
+		for page := range m.Pages {
+			order = append(order, page+1)
+		}
+	}
+	for _, page := range order {
+		ports.NotifyPageReleases(ctx, page, m.Pages[page-1])
+	}
+	return slices.Concat(m.Pages...), m.Error
+}
+
+func (m *ServiceMock) GetArtistReleases(_ context.Context, _ string) ([]entities.DiscogsRelease, error) {
+	return m.Response, m.Error
+}
+
+func (m *ServiceMock) GetLabelReleases(_ context.Context, _ string) ([]entities.DiscogsRelease, error) {
 	return m.Response, m.Error
 }
 
+func (m *ServiceMock) GetRelease(_ context.Context, _ string) (*entities.DiscogsReleaseDetail, error) {
+	return m.Release, m.Error
+}
+
+func (m *ServiceMock) GetMaster(_ context.Context, _ string) (*entities.DiscogsMaster, error) {
+	return m.Master, m.Error
+}
+
+func (m *ServiceMock) GetCollectionFolders(_ context.Context, _ string) ([]entities.DiscogsFolder, error) {
+	return m.Folders, m.Error
+}
+
 func (m *ServiceMock) GetWantlistReleases(_ context.Context, _ string) ([]entities.DiscogsRelease, error) {
 	return m.Response, m.Error
 }
@@ -22,3 +64,42 @@ func (m *ServiceMock) GetWantlistReleases(_ context.Context, _ string) ([]entiti
 func (m *ServiceMock) GetListReleases(_ context.Context, _ string) ([]entities.DiscogsRelease, error) {
 	return m.Response, m.Error
 }
+
+// AuthServiceMock accepts the personal tokens and the request token of Tokens, mapped to their username
+type AuthServiceMock struct {
+	Tokens map[string]string
+	Error  error
+}
+
+func (m *AuthServiceMock) RequestToken(_ context.Context, _ string) (token, secret string, err error) {
+	return "request_token", "request_secret", m.Error
+}
+
+func (*AuthServiceMock) AuthorizeURL(token string) string {
+	return authorizeURL + "?oauth_token=" + token
+}
+
+func (m *AuthServiceMock) AccessToken(
+	_ context.Context,
+	token, _, _ string,
+) (*entities.DiscogsCredentials, error) {
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	return &entities.DiscogsCredentials{OAuthToken: token, OAuthSecret: "access_secret"}, nil
+}
+
+func (m *AuthServiceMock) Identity(_ context.Context, credentials *entities.DiscogsCredentials) (string, error) {
+	if m.Error != nil {
+		return "", m.Error
+	}
+	token := credentials.PersonalToken
+	if credentials.IsOAuth() {
+		token = credentials.OAuthToken
+	}
+	username, exists := m.Tokens[token]
+	if !exists {
+		return "", errorWrapper.Wrap(errorWrapper.ErrUnauthorized, "discogs credentials rejected")
+	}
+	return username, nil
+}
@@ -3,20 +3,31 @@ package discogs
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+
+	"github.com/pkg/errors"
 )
 
 type StubDiscogsHTTPClient struct {
-	Responses   []http.Response
-	CalledCount int
-	Error       error
+	Responses     []http.Response
+	CalledCount   int
+	RequestedURLs []string
+	Headers       []http.Header
+	Error         error
 }
 
-func (s *StubDiscogsHTTPClient) Do(_ *http.Request) (*http.Response, error) {
+func (s *StubDiscogsHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	s.RequestedURLs = append(s.RequestedURLs, req.URL.String())
+	s.Headers = append(s.Headers, req.Header.Clone())
 	if s.CalledCount >= len(s.Responses) {
 		return nil, s.Error
 	}
@@ -65,8 +76,10 @@ func TestDiscogsService(t *testing.T) {
 		responseBody string
 	}{
 		{
-			name:         "GetCollectionReleases",
-			fn:           service.GetCollectionReleases,
+			name: "GetCollectionReleases",
+			fn: func(ctx context.Context, username string) ([]entities.DiscogsRelease, error) {
+				return service.GetCollectionReleases(ctx, username, 0)
+			},
 			responseBody: generateResponseBody(t, "releases"),
 		},
 		{
@@ -168,7 +181,7 @@ func TestDiscogsServicePagination(t *testing.T) {
 
 	stubClient := &StubDiscogsHTTPClient{Responses: stubResponses}
 	service := NewHTTPService(stubClient)
-	response, err := service.GetCollectionReleases(context.Background(), "digger")
+	response, err := service.GetCollectionReleases(context.Background(), "digger", 0)
 	if err != nil {
 		t.Errorf("did not expect an error, got %v", err)
 	}
@@ -186,6 +199,167 @@ func TestDiscogsServicePagination(t *testing.T) {
 	}
 }
 
+func TestDiscogsServiceCollectionFolder(t *testing.T) {
+	stubResponse := &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(bytes.NewBufferString(generateResponseBody(t, "releases"))),
+	}
+	stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{*stubResponse}}
+	service := NewHTTPService(stubClient)
+
+	_, err := service.GetCollectionReleases(context.Background(), "digger", 123)
+	if err != nil {
+		t.Errorf("did not expect an error, got %v", err)
+	}
+	want := "https://api.discogs.com/users/digger/collection/folders/123/releases?per_page=100&sort=artist&sort_order=asc"
+	if len(stubClient.RequestedURLs) != 1 || stubClient.RequestedURLs[0] != want {
+		t.Errorf("got requests %v, want %s", stubClient.RequestedURLs, want)
+	}
+}
+
+func TestDiscogsServiceCollectionFolders(t *testing.T) {
+	stubResponse := &http.Response{
+		StatusCode: 200,
+		Body: io.NopCloser(bytes.NewBufferString(`{
+			"folders": [
+				{"id": 0, "name": "All", "count": 23, "resource_url": "https://api.discogs.com/users/digger/collection/folders/0"},
+				{"id": 123, "name": "Jazz", "count": 8, "resource_url": "https://api.discogs.com/users/digger/collection/folders/123"}
+			]
+		}`)),
+	}
+	stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{*stubResponse}}
+	service := NewHTTPService(stubClient)
+
+	folders, err := service.GetCollectionFolders(context.Background(), "digger")
+	if err != nil {
+		t.Errorf("did not expect an error, got %v", err)
+	}
+	want := []entities.DiscogsFolder{{ID: 0, Name: "All", Count: 23}, {ID: 123, Name: "Jazz", Count: 8}}
+	if !reflect.DeepEqual(folders, want) {
+		t.Errorf("got %v, want %v", folders, want)
+	}
+}
+
+func TestDiscogsServiceArtistReleases(t *testing.T) {
+	stubResponses := []http.Response{
+		{
+			StatusCode: 200,
+			Body: io.NopCloser(bytes.NewBufferString(`{
+				"pagination": {
+					"page": 1,
+					"pages": 2,
+					"per_page": 2,
+					"items": 3,
+					"urls": {
+						"next": "https://api.discogs.com/artists/125246/releases?per_page=2&sort=year&sort_order=asc&page=2"
+					}
+				},
+				"releases": [
+					{"id": 13773, "type": "master", "main_release": 392900, "title": "Bleach", "artist": "Nirvana", "year": 1989, "role": "Main"},
+					{"id": 2048, "type": "release", "title": "Sliver", "artist": "Nirvana", "year": 1990, "role": "Main", "format": "7\"", "status": "Accepted"}
+				]
+			}`)),
+		},
+		{
+			StatusCode: 200,
+			Body: io.NopCloser(bytes.NewBufferString(`{
+				"pagination": {"page": 2, "pages": 2, "per_page": 2, "items": 3, "urls": {}},
+				"releases": [
+					{"id": 13814, "type": "master", "main_release": 367113, "title": "Nevermind", "artist": "Nirvana", "year": 1991, "role": "Main"}
+				]
+			}`)),
+		},
+	}
+	stubClient := &StubDiscogsHTTPClient{Responses: stubResponses}
+	service := NewHTTPService(stubClient)
+
+	response, err := service.GetArtistReleases(context.Background(), "125246")
+	if err != nil {
+		t.Errorf("did not expect an error, got %v", err)
+	}
+	if len(response) != 2 {
+		t.Fatalf("got %d albums, want 2", len(response))
+	}
+	if response[0].BasicInformation.Title != "Bleach" || response[1].BasicInformation.Title != "Nevermind" {
+		t.Errorf("got %s and %s, want Bleach and Nevermind", response[0].BasicInformation.Title, response[1].BasicInformation.Title)
+	}
+	if stubClient.CalledCount != 2 {
+		t.Errorf("got %d calls, want 2", stubClient.CalledCount)
+	}
+}
+
+func TestDiscogsServiceLabelReleases(t *testing.T) {
+	stubResponse := &http.Response{
+		StatusCode: 200,
+		Body: io.NopCloser(bytes.NewBufferString(`{
+			"pagination": {"page": 1, "pages": 1, "per_page": 100, "items": 4, "urls": {}},
+			"releases": [
+				{"id": 10, "title": "Selected Ambient Works 85-92", "artist": "Aphex Twin", "year": 0, "format": "CD, Album", "catno": "AMB 3922"},
+				{"id": 11, "master_id": 565, "title": "Artificial Intelligence", "artist": "Various", "year": 1992, "format": "Vinyl, LP, Compilation", "catno": "WARPLP6"},
+				{"id": 12, "master_id": 565, "title": "Artificial Intelligence", "artist": "Various", "year": 1994, "format": "CD, Compilation", "catno": "WARPCD6"},
+				{"id": 13, "title": "Selected Ambient Works 85-92", "artist": "Aphex Twin", "year": 1992, "format": "Vinyl, LP, Album", "catno": "AMB LP 3922"}
+			]
+		}`)),
+	}
+	stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{*stubResponse}}
+	service := NewHTTPService(stubClient)
+
+	releases, err := service.GetLabelReleases(context.Background(), "23528")
+	if err != nil {
+		t.Errorf("did not expect an error, got %v", err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("got %d releases, want the pressings collapsed into 2", len(releases))
+	}
+	if info := releases[0].BasicInformation; info.ID != 10 || info.Year != 1992 {
+		t.Errorf("got release %d from %d, want 10 with the year of its later listed pressing, 1992", info.ID, info.Year)
+	}
+	if info := releases[1].BasicInformation; info.ID != 11 || info.Year != 1992 {
+		t.Errorf("got release %d from %d, want 11 from 1992", info.ID, info.Year)
+	}
+	want := []entities.DiscogsFormat{{Name: "Vinyl", Descriptions: []string{"LP", "Compilation"}}}
+	if !reflect.DeepEqual(releases[1].BasicInformation.Formats, want) {
+		t.Errorf("got formats %v, want %v", releases[1].BasicInformation.Formats, want)
+	}
+}
+
+func TestDiscogsServiceRelease(t *testing.T) {
+	stubResponse := &http.Response{
+		StatusCode: 200,
+		Body: io.NopCloser(bytes.NewBufferString(`{
+			"id": 367113,
+			"master_id": 13814,
+			"title": "Nevermind",
+			"year": 1991,
+			"country": "US",
+			"artists": [{"name": "Nirvana"}],
+			"formats": [{"name": "CD", "qty": "1", "descriptions": ["Album"]}],
+			"labels": [{"id": 1, "name": "DGC", "catno": "DGCD-24425"}],
+			"identifiers": [{"type": "Barcode", "value": "7 20642 44252 6", "description": "Text"}],
+			"tracklist": [
+				{"position": "1", "type_": "track", "title": "Smells Like Teen Spirit", "duration": "5:01"},
+				{"position": "2", "type_": "track", "title": "In Bloom", "duration": "4:14"}
+			]
+		}`)),
+	}
+	stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{*stubResponse}}
+	service := NewHTTPService(stubClient)
+
+	release, err := service.GetRelease(context.Background(), "367113")
+	if err != nil {
+		t.Fatalf("did not expect an error, got %v", err)
+	}
+	if want := "https://api.discogs.com/releases/367113"; stubClient.RequestedURLs[0] != want {
+		t.Errorf("got request %s, want %s", stubClient.RequestedURLs[0], want)
+	}
+	if release.MasterID != 13814 || len(release.Tracklist) != 2 || release.Tracklist[0].Title != "Smells Like Teen Spirit" {
+		t.Errorf("got %+v, want Nevermind with its tracklist", release)
+	}
+	if len(release.Identifiers) != 1 || release.Identifiers[0].Type != "Barcode" || release.Labels[0].CatNo != "DGCD-24425" {
+		t.Errorf("got identifiers %v and labels %v, want the barcode and DGC", release.Identifiers, release.Labels)
+	}
+}
+
 func TestDiscogsServiceError(t *testing.T) {
 	stubResponse := &http.Response{
 		StatusCode: 500,
@@ -193,7 +367,7 @@ func TestDiscogsServiceError(t *testing.T) {
 	}
 	stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{*stubResponse}}
 	service := NewHTTPService(stubClient)
-	_, err := service.GetCollectionReleases(context.Background(), "digger")
+	_, err := service.GetCollectionReleases(context.Background(), "digger", 0)
 	if err == nil {
 		t.Errorf("error is nil")
 	}
@@ -206,7 +380,7 @@ func TestDiscogsServiceUnauthorized(t *testing.T) {
 	}
 	stubClient := &StubDiscogsHTTPClient{Responses: []http.Response{*stubResponse}}
 	service := NewHTTPService(stubClient)
-	_, err := service.GetCollectionReleases(context.Background(), "digger")
+	_, err := service.GetCollectionReleases(context.Background(), "digger", 0)
 	if err == nil {
 		t.Errorf("error is nil")
 	}
@@ -241,3 +415,81 @@ func generateResponseBody(t *testing.T, property string) string {
 		}]
 	}`
 }
+
+// pagesDiscogsHTTPClient answers every page of a paginated URL by its page parameter, from any goroutine
+type pagesDiscogsHTTPClient struct {
+	mu     sync.Mutex
+	pages  int
+	failOn int
+	called []int
+}
+
+func (c *pagesDiscogsHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	page, err := strconv.Atoi(req.URL.Query().Get("page"))
+	if err != nil {
+		page = 1
+	}
+	c.mu.Lock()
+	c.called = append(c.called, page)
+	c.mu.Unlock()
+
+	if page == c.failOn {
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(bytes.NewBufferString(""))}, nil
+	}
+	next := ""
+	if page < c.pages {
+		next = fmt.Sprintf("https://api.discogs.com/users/digger/wants?per_page=1&page=%d", page+1)
+	}
+	body := fmt.Sprintf(`{
+		"pagination": {"page": %d, "pages": %d, "per_page": 1, "items": %d, "urls": {"next": %q}},
+		"wants": [{"id": %d, "basic_information": {"id": %d, "title": "Album %d"}}]
+	}`, page, c.pages, c.pages, next, page, page, page)
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+}
+
+func TestDiscogsServiceConcurrentPagination(t *testing.T) {
+	t.Run("fetches the remaining pages at once and keeps their order", func(t *testing.T) {
+		client := &pagesDiscogsHTTPClient{pages: 7}
+		service := NewHTTPServiceWithOptions(client, Options{PageWorkers: 3})
+
+		var mu sync.Mutex
+		var notified []int
+		ctx := ports.WithPageFetched(context.Background(), func(page, pages int) {
+			mu.Lock()
+			defer mu.Unlock()
+			if pages != 7 {
+				t.Errorf("got %d pages, want 7", pages)
+			}
+			notified = append(notified, page)
+		})
+
+		releases, err := service.GetWantlistReleases(ctx, "digger")
+		if err != nil {
+			t.Fatalf("did not expect an error, got %v", err)
+		}
+		if len(releases) != 7 {
+			t.Fatalf("got %d releases, want 7", len(releases))
+		}
+		for i, release := range releases {
+			if release.ID != i+1 {
+				t.Errorf("got release %d at position %d, want %d", release.ID, i, i+1)
+			}
+		}
+		if len(client.called) != 7 || client.called[0] != 1 {
+			t.Errorf("got pages requested %v, want the first page and then the other 6", client.called)
+		}
+		if !reflect.DeepEqual(notified, []int{1, 2, 3, 4, 5, 6, 7}) {
+			t.Errorf("got pages notified %v, want 1 to 7", notified)
+		}
+	})
+
+	t.Run("fails when a page fails", func(t *testing.T) {
+		client := &pagesDiscogsHTTPClient{pages: 5, failOn: 4}
+		service := NewHTTPServiceWithOptions(client, Options{PageWorkers: 2})
+
+		_, err := service.GetWantlistReleases(context.Background(), "digger")
+		if !errors.Is(err, ErrUnexpectedStatus) {
+			t.Errorf("got error %v, want %v", err, ErrUnexpectedStatus)
+		}
+	})
+}
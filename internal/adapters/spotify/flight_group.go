@@ -0,0 +1,78 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errFlightPanicked is what the waiting callers get when the call in flight panics
+var errFlightPanicked = errors.New("shared spotify call panicked")
+
+// flightGroup shares the result of a call among the callers asking for the same key while it's in flight,
+// so concurrent identical requests only reach Spotify once
+type flightGroup[T any] struct {
+	mu      sync.Mutex
+	flights map[string]*flight[T]
+	// private reports whether an error only concerns the caller that made the call, like its context
+	// being done or its token rejected, nil counts the context errors only
+	private func(err error) bool
+}
+
+type flight[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// do runs fn unless a call with the same key is already in flight, in which case it waits for its result.
+// When the call in flight fails with an error private to its caller, the callers waiting run fn themselves
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func() (T, error)) (T, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight[T])
+	}
+	if f, exists := g.flights[key]; exists {
+		g.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-f.done:
+		}
+		if f.err != nil && g.isPrivate(f.err) {
+			return fn()
+		}
+		return f.value, f.err
+	}
+
+	f := &flight[T]{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	// the flight ends even when fn panics, the waiting callers get an error and the panic goes on in this one
+	defer func() {
+		r := recover()
+		if r != nil {
+			f.err = fmt.Errorf("%w: %v", errFlightPanicked, r)
+		}
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+		close(f.done)
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	f.value, f.err = fn()
+	return f.value, f.err
+}
+
+func (g *flightGroup[T]) isPrivate(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	return g.private != nil && g.private(err)
+}
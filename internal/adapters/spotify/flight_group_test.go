@@ -0,0 +1,224 @@
+package spotify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+)
+
+func TestFlightGroup(t *testing.T) {
+	t.Run("concurrent calls for the same key share one call", func(t *testing.T) {
+		var group flightGroup[[]string]
+		var calls atomic.Int32
+		release := make(chan struct{})
+
+		var wg sync.WaitGroup
+		results := make([][]string, 5)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], _ = group.do(context.Background(), "ES|abbey road", func() ([]string, error) {
+					calls.Add(1)
+					<-release
+					return []string{"abbey road"}, nil
+				})
+			}(i)
+		}
+		// let every caller join the call in flight before it returns
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if got := calls.Load(); got != 1 {
+			t.Errorf("expected 1 call, got %d", got)
+		}
+		for i, result := range results {
+			if len(result) != 1 || result[0] != "abbey road" {
+				t.Errorf("caller %d got %v", i, result)
+			}
+		}
+	})
+
+	t.Run("calls for different keys run apart", func(t *testing.T) {
+		var group flightGroup[int]
+		for _, key := range []string{"ES|abbey road", "US|abbey road"} {
+			if _, err := group.do(context.Background(), key, func() (int, error) { return 1, nil }); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(group.flights) != 0 {
+			t.Errorf("expected no calls in flight, got %d", len(group.flights))
+		}
+	})
+
+	t.Run("waiting callers retry when the call in flight is cancelled", func(t *testing.T) {
+		var group flightGroup[int]
+		leaderCtx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+
+		go func() {
+			_, _ = group.do(leaderCtx, "ES|abbey road", func() (int, error) {
+				close(started)
+				<-leaderCtx.Done()
+				return 0, leaderCtx.Err()
+			})
+		}()
+		<-started
+
+		done := make(chan int)
+		go func() {
+			value, _ := group.do(context.Background(), "ES|abbey road", func() (int, error) { return 2, nil })
+			done <- value
+		}()
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+
+		if value := <-done; value != 2 {
+			t.Errorf("expected the waiting caller to run its own call, got %d", value)
+		}
+	})
+
+	t.Run("waiting callers get an error when the call in flight panics", func(t *testing.T) {
+		var group flightGroup[int]
+		started := make(chan struct{})
+		release := make(chan struct{})
+		recovered := make(chan any)
+
+		go func() {
+			defer func() { recovered <- recover() }()
+			_, _ = group.do(context.Background(), "ES|abbey road", func() (int, error) {
+				close(started)
+				<-release
+				panic("boom")
+			})
+		}()
+		<-started
+
+		done := make(chan error)
+		go func() {
+			_, err := group.do(context.Background(), "ES|abbey road", func() (int, error) { return 2, nil })
+			done <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+
+		if r := <-recovered; r != "boom" {
+			t.Errorf("expected the panic to reach the caller that made the call, got %v", r)
+		}
+		select {
+		case err := <-done:
+			if !errors.Is(err, errFlightPanicked) {
+				t.Errorf("expected %v, got %v", errFlightPanicked, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the waiting caller never returned")
+		}
+		if len(group.flights) != 0 {
+			t.Errorf("expected no calls in flight, got %d", len(group.flights))
+		}
+	})
+}
+
+// leaderSpotifyHTTPClient holds the first request until it's released or its context is done,
+// answering it with first, and finds an album for every other request
+type leaderSpotifyHTTPClient struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+	first   func(req *http.Request) (*http.Response, error)
+}
+
+func (c *leaderSpotifyHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if c.calls.Add(1) == 1 {
+		close(c.started)
+		select {
+		case <-c.release:
+		case <-req.Context().Done():
+		}
+		return c.first(req)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewBufferString(`{"albums": {"items": [{"id": "4JeLdGuCEO9SF9SnFa9LBh", "name": "Spring Island"}]}}`)),
+	}, nil
+}
+
+func TestSearchAlbumFollowersRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   func(req *http.Request) (*http.Response, error)
+		stop    func(cancel context.CancelFunc, release chan struct{})
+		wantErr error
+	}{
+		{
+			name: "leader cancelled",
+			first: func(req *http.Request) (*http.Response, error) {
+				return nil, &url.Error{Op: "Get", URL: req.URL.String(), Err: req.Context().Err()}
+			},
+			stop:    func(cancel context.CancelFunc, _ chan struct{}) { cancel() },
+			wantErr: context.Canceled,
+		},
+		{
+			name: "leader token rejected",
+			first: func(*http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(bytes.NewBufferString(`{}`))}, nil
+			},
+			stop:    func(_ context.CancelFunc, release chan struct{}) { close(release) },
+			wantErr: ErrSpotifyUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &leaderSpotifyHTTPClient{started: make(chan struct{}), release: make(chan struct{}), first: tt.first}
+			service := NewHTTPService(client, NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler"), nil)
+			service.markets.Store("wizzler", "ES")
+			album := entities.Album{Artist: "Delta Sleep", Title: "Spring Island"}
+
+			leaderCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			leaderErr := make(chan error)
+			go func() {
+				_, err := service.SearchAlbum(leaderCtx, album)
+				leaderErr <- err
+			}()
+			<-client.started
+
+			type result struct {
+				items []entities.SpotifyAlbumItem
+				err   error
+			}
+			follower := make(chan result)
+			go func() {
+				items, err := service.SearchAlbum(context.Background(), album)
+				follower <- result{items, err}
+			}()
+			// let the follower join the search in flight before the leader's fails
+			time.Sleep(20 * time.Millisecond)
+			tt.stop(cancel, client.release)
+
+			if err := <-leaderErr; !errors.Is(err, tt.wantErr) {
+				t.Errorf("got leader error %v, want %v", err, tt.wantErr)
+			}
+			got := <-follower
+			if got.err != nil || len(got.items) != 1 {
+				t.Errorf("got %v and error %v, want the follower to find the album", got.items, got.err)
+			}
+			if calls := client.calls.Load(); calls != 2 {
+				t.Errorf("got %d requests, want the follower to send its own", calls)
+			}
+		})
+	}
+}
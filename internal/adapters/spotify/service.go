@@ -8,7 +8,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
 
 	httpClient "github.com/martiriera/discogs-spotify/internal/adapters/client"
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
@@ -25,19 +29,71 @@ var (
 type HTTPService struct {
 	client          httpClient.HTTPClient
 	contextProvider ports.ContextPort
+	tokenRefresher  ports.TokenPort
+	// refreshLocks holds a mutex per refresh token, concurrent requests of a user don't refresh
+	// the same token several times and the refreshes of other users don't wait for them
+	refreshLocks sync.Map
+	// markets keeps the country of every user seen, the market Spotify searches in with their token
+	markets sync.Map
+	// searches coalesces the identical album searches of users in the same market
+	searches flightGroup[[]entities.SpotifyAlbumItem]
 }
 
 const basePath = "https://api.spotify.com/v1"
 
-func NewHTTPService(client httpClient.HTTPClient, contextProvider ports.ContextPort) *HTTPService {
+// NewHTTPService creates the Spotify service, tokenRefresher is optional and
+// allows retrying requests rejected with 401 once the token has been refreshed
+func NewHTTPService(client httpClient.HTTPClient, contextProvider ports.ContextPort, tokenRefresher ports.TokenPort) *HTTPService {
 	return &HTTPService{
 		client:          client,
 		contextProvider: contextProvider,
+		tokenRefresher:  tokenRefresher,
+		// a rejected token is the one of the caller, the others search with their own
+		searches: flightGroup[[]entities.SpotifyAlbumItem]{private: func(err error) bool {
+			return errorWrapper.Is(err, ErrSpotifyUnauthorized)
+		}},
 	}
 }
 
+// SearchAlbum looks up the barcodes of the album first, they find the exact edition among reissues
+// sharing the artist and title. The artist and title are only searched when no barcode is on Spotify
 func (s *HTTPService) SearchAlbum(ctx context.Context, album entities.Album) ([]entities.SpotifyAlbumItem, error) {
-	query := "album:" + album.Title + " artist:" + album.Artist
+	for _, barcode := range album.Barcodes {
+		items, err := s.searchAlbums(ctx, "upc:"+barcode)
+		if err != nil || items != nil {
+			return items, err
+		}
+	}
+	return s.searchAlbums(ctx, "album:"+album.Title+" artist:"+album.Artist)
+}
+
+// searchAlbums shares the results of the searches in flight for the same query in the same market,
+// searches of users whose market isn't known yet aren't shared
+func (s *HTTPService) searchAlbums(ctx context.Context, query string) ([]entities.SpotifyAlbumItem, error) {
+	market := s.market(ctx)
+	if market == "" {
+		return s.requestAlbums(ctx, query)
+	}
+	key := market + "|" + strings.ToLower(strings.Join(strings.Fields(query), " "))
+	items, err := s.searches.do(ctx, key, func() ([]entities.SpotifyAlbumItem, error) {
+		return s.requestAlbums(ctx, query)
+	})
+	// every caller gets its own slice, results are shared with other conversions
+	return slices.Clone(items), err
+}
+
+// market returns the country of the user, empty until GetUserID asked Spotify for it
+func (s *HTTPService) market(ctx context.Context) string {
+	userID, err := s.contextProvider.GetUserID(ctx)
+	if err != nil || userID == "" {
+		return ""
+	}
+	market, _ := s.markets.Load(userID)
+	country, _ := market.(string)
+	return country
+}
+
+func (s *HTTPService) requestAlbums(ctx context.Context, query string) ([]entities.SpotifyAlbumItem, error) {
 	encodedQuery := url.QueryEscape(query)
 	route := fmt.Sprintf("%s?q=%s&type=album&limit=4", basePath+"/search", encodedQuery)
 
@@ -47,29 +103,69 @@ func (s *HTTPService) SearchAlbum(ctx context.Context, album entities.Album) ([]
 	}
 
 	if len(resp.Albums.Items) == 0 {
-		fmt.Println("no album found for", album.Artist, album.Title)
 		return nil, nil
 	}
 
 	return resp.Albums.Items, nil
 }
 
+// SearchTrack looks up a single track, the artist filter is left out when the track has no artist
+func (s *HTTPService) SearchTrack(ctx context.Context, track entities.Track) ([]entities.SpotifyTrackItem, error) {
+	query := "track:" + track.Title
+	if track.Artist != "" {
+		query += " artist:" + track.Artist
+	}
+	encodedQuery := url.QueryEscape(query)
+	route := fmt.Sprintf("%s?q=%s&type=track&limit=4", basePath+"/search", encodedQuery)
+
+	resp, err := doRequest[entities.SpotifyTrackSearchResponse](ctx, s, http.MethodGet, route, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Tracks.Items, nil
+}
+
 func (s *HTTPService) GetUserID(ctx context.Context) (string, error) {
 	userID, err := s.contextProvider.GetUserID(ctx)
 	if err == nil && userID != "" {
 		return userID, nil
 	}
 
-	resp, err := doRequest[entities.SpotifyUserResponse](ctx, s, http.MethodGet, basePath+"/me", nil)
+	resp, err := s.getCurrentUser(ctx)
 	if err != nil {
 		return "", err
 	}
+	return resp.ID, nil
+}
 
-	if err := s.contextProvider.SetUserID(ctx, resp.ID); err != nil {
-		return "", errorWrapper.Wrap(err, "error setting spotify user id in context")
+// GetUserMarket returns the country of the user, asking Spotify only the first time for every user
+func (s *HTTPService) GetUserMarket(ctx context.Context) (string, error) {
+	if market := s.market(ctx); market != "" {
+		return market, nil
 	}
 
-	return resp.ID, nil
+	resp, err := s.getCurrentUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	return resp.Country, nil
+}
+
+// getCurrentUser gets the user of the token, keeping their ID in the context and their market
+func (s *HTTPService) getCurrentUser(ctx context.Context) (*entities.SpotifyUserResponse, error) {
+	resp, err := doRequest[entities.SpotifyUserResponse](ctx, s, http.MethodGet, basePath+"/me", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.contextProvider.SetUserID(ctx, resp.ID); err != nil {
+		return nil, errorWrapper.Wrap(err, "error setting spotify user id in context")
+	}
+	if resp.Country != "" {
+		s.markets.Store(resp.ID, resp.Country)
+	}
+	return resp, nil
 }
 
 func (s *HTTPService) CreatePlaylist(ctx context.Context, name, description string) (entities.SpotifyPlaylist, error) {
@@ -153,24 +249,72 @@ func (s *HTTPService) GetAlbumsTrackUris(ctx context.Context, albums []string) (
 	return allTrackURIs, nil
 }
 
-func doRequest[T any](ctx context.Context, s *HTTPService, method, route string, body io.Reader) (*T, error) {
-	req, err := http.NewRequestWithContext(ctx, method, route, body)
-	if err != nil {
-		return nil, errorWrapper.Wrap(ErrSpotifyAPI, err.Error())
+// GetPlaylistItems returns every track of the playlist, following the pages of 100 items
+func (s *HTTPService) GetPlaylistItems(ctx context.Context, playlistID string) ([]entities.SpotifyPlaylistItem, error) {
+	fields := url.QueryEscape("items(track(uri,album(id))),next")
+	route := fmt.Sprintf("%s/playlists/%s/tracks?fields=%s&limit=100", basePath, playlistID, fields)
+
+	items := []entities.SpotifyPlaylistItem{}
+	for route != "" {
+		resp, err := doRequest[entities.SpotifyPlaylistItemsResponse](ctx, s, http.MethodGet, route, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Items {
+			if item.Track == nil {
+				continue
+			}
+			items = append(items, entities.SpotifyPlaylistItem{TrackURI: item.Track.URI, AlbumID: item.Track.Album.ID})
+		}
+		route = resp.Next
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	return items, nil
+}
 
-	token, err := s.contextProvider.GetToken(ctx)
+// RemoveFromPlaylist removes every occurrence of the tracks, Spotify accepts up to 100 per request
+func (s *HTTPService) RemoveFromPlaylist(ctx context.Context, playlistID string, uris []string) error {
+	route := fmt.Sprintf("%s/playlists/%s/tracks", basePath, playlistID)
+
+	tracks := make([]map[string]string, len(uris))
+	for i, uri := range uris {
+		tracks[i] = map[string]string{"uri": uri}
+	}
+	reqBody := map[string]any{
+		"tracks": tracks,
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, errorWrapper.Wrap(ErrSpotifyUnauthorized, err.Error())
+		return errorWrapper.Wrap(err, "error marshaling request body")
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	_, err = doRequest[map[string]any](ctx, s, http.MethodDelete, route, bytes.NewBuffer(jsonBody))
+	return err
+}
 
-	resp, err := s.client.Do(req)
+func doRequest[T any](ctx context.Context, s *HTTPService, method, route string, body io.Reader) (*T, error) {
+	// keep the body so the request can be sent again after refreshing the token
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = io.ReadAll(body)
+		if err != nil {
+			return nil, errorWrapper.Wrap(ErrSpotifyAPI, err.Error())
+		}
+	}
+
+	resp, token, err := s.send(ctx, method, route, payload)
 	if err != nil {
-		return nil, errorWrapper.Wrap(ErrSpotifyAPI, err.Error())
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && s.refreshToken(ctx, token) == nil {
+		resp.Body.Close()
+		resp, _, err = s.send(ctx, method, route, payload)
+		if err != nil {
+			return nil, err
+		}
 	}
 	defer resp.Body.Close()
 
@@ -178,6 +322,10 @@ func doRequest[T any](ctx context.Context, s *HTTPService, method, route string,
 		return nil, ErrSpotifyUnauthorized
 	}
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errorWrapper.Wrap(errorWrapper.ErrNotFound, route)
+	}
+
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		errMsg := fmt.Sprintf("status: %d, body: %s", resp.StatusCode, string(bodyBytes))
@@ -191,3 +339,57 @@ func doRequest[T any](ctx context.Context, s *HTTPService, method, route string,
 
 	return &result, nil
 }
+
+// send performs an authenticated request, returning the token it was sent with
+func (s *HTTPService) send(ctx context.Context, method, route string, payload []byte) (*http.Response, *oauth2.Token, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, route, body)
+	if err != nil {
+		return nil, nil, errorWrapper.Wrap(ErrSpotifyAPI, err.Error())
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	token, err := s.contextProvider.GetToken(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrSpotifyUnauthorized, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// keeps the cause, callers tell a cancelled request from a failed one
+		return nil, nil, fmt.Errorf("%w: %w", ErrSpotifyAPI, err)
+	}
+	return resp, token, nil
+}
+
+// refreshToken replaces the rejected token in the context with a refreshed one,
+// unless a concurrent request refreshed it already
+func (s *HTTPService) refreshToken(ctx context.Context, rejected *oauth2.Token) error {
+	if s.tokenRefresher == nil {
+		return ErrSpotifyUnauthorized
+	}
+
+	lock, _ := s.refreshLocks.LoadOrStore(rejected.RefreshToken, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	current, err := s.contextProvider.GetToken(ctx)
+	if err != nil {
+		return errorWrapper.Wrap(ErrSpotifyUnauthorized, err.Error())
+	}
+	if current.AccessToken != rejected.AccessToken {
+		return nil
+	}
+
+	refreshed, err := s.tokenRefresher.RefreshToken(ctx, current)
+	if err != nil {
+		return errorWrapper.Wrap(ErrSpotifyUnauthorized, err.Error())
+	}
+	return s.contextProvider.SetToken(ctx, refreshed)
+}
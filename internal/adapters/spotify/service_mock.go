@@ -2,42 +2,111 @@ package spotify
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
 )
 
+// ServiceMock is safe for the concurrent searches of a conversion, its fields are set before it's used
+// and read once it's done
 type ServiceMock struct {
+	mu sync.Mutex
+	// SearchAlbumResults are the album search results by album title, the same whichever order albums are searched in
+	SearchAlbumResults map[string][]entities.SpotifyAlbumItem
+	// SearchAlbumResponses are handed out in call order to the albums missing from SearchAlbumResults,
+	// only deterministic when the albums are searched one at a time
 	SearchAlbumResponses [][]entities.SpotifyAlbumItem
-	CalledCount          int
-	SleepMillis          int
+	// SearchAlbumErrors fail the search of the albums by title, without taking a response
+	SearchAlbumErrors map[string]error
+	CalledCount       int // album searches with a response and playlist additions
+	Searches          int // album searches, found or not
+	SleepMillis       int
+	responses         int // SearchAlbumResponses handed out
+	// AlbumTracks are the track URIs of every album, every album has two fixed tracks when nil
+	AlbumTracks map[string][]string
+	// TrackResults are the track search results by track title, no results when missing
+	TrackResults  map[string][]entities.SpotifyTrackItem
+	PlaylistItems []entities.SpotifyPlaylistItem
+	// Market is the country of the user, ES when empty
+	Market      string
+	AddedUris   []string
+	RemovedUris []string
 }
 
-func (m *ServiceMock) SearchAlbum(_ context.Context, _ entities.Album) ([]entities.SpotifyAlbumItem, error) {
-	if m.CalledCount >= len(m.SearchAlbumResponses) {
+func (m *ServiceMock) SearchAlbum(_ context.Context, album entities.Album) ([]entities.SpotifyAlbumItem, error) {
+	if err, exists := m.SearchAlbumErrors[album.Title]; exists {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.Searches++
+	response, exists := m.SearchAlbumResults[album.Title]
+	if exists {
+		m.CalledCount++
+	} else if m.responses < len(m.SearchAlbumResponses) {
+		response = m.SearchAlbumResponses[m.responses]
+		m.responses++
+		m.CalledCount++
+	}
+	m.mu.Unlock()
+
+	if response == nil {
 		return []entities.SpotifyAlbumItem{}, nil
 	}
-	response := m.SearchAlbumResponses[m.CalledCount]
-	m.CalledCount++
 	if m.SleepMillis > 0 {
 		time.Sleep(time.Duration(m.SleepMillis) * time.Millisecond)
 	}
 	return response, nil
 }
 
+func (m *ServiceMock) SearchTrack(_ context.Context, track entities.Track) ([]entities.SpotifyTrackItem, error) {
+	return m.TrackResults[track.Title], nil
+}
+
 func (*ServiceMock) GetUserID(_ context.Context) (string, error) {
 	return "wizzler", nil
 }
 
+func (m *ServiceMock) GetUserMarket(_ context.Context) (string, error) {
+	if m.Market == "" {
+		return "ES", nil
+	}
+	return m.Market, nil
+}
+
 func (*ServiceMock) CreatePlaylist(_ context.Context, _, _ string) (entities.SpotifyPlaylist, error) {
 	return entities.SpotifyPlaylist{ID: "6rqhFgbbKwnb9MLmUQDhG6", URL: "https://open.spotify.com/playlist/6rqhFgbbKwnb9MLmUQDhG6"}, nil
 }
 
-func (m *ServiceMock) AddToPlaylist(_ context.Context, _ string, _ []string) error {
+func (m *ServiceMock) AddToPlaylist(_ context.Context, _ string, uris []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.CalledCount++
+	m.AddedUris = append(m.AddedUris, uris...)
 	return nil
 }
 
-func (*ServiceMock) GetAlbumsTrackUris(_ context.Context, _ []string) ([]string, error) {
-	return []string{"spotify:track:1", "spotify:track:2"}, nil
+func (m *ServiceMock) GetAlbumsTrackUris(_ context.Context, albums []string) ([]string, error) {
+	if m.AlbumTracks == nil {
+		return []string{"spotify:track:1", "spotify:track:2"}, nil
+	}
+	uris := []string{}
+	for _, album := range albums {
+		uris = append(uris, m.AlbumTracks[album]...)
+	}
+	return uris, nil
+}
+
+func (m *ServiceMock) GetPlaylistItems(_ context.Context, _ string) ([]entities.SpotifyPlaylistItem, error) {
+	return m.PlaylistItems, nil
+}
+
+func (m *ServiceMock) RemoveFromPlaylist(_ context.Context, _ string, uris []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.RemovedUris = append(m.RemovedUris, uris...)
+	return nil
 }
@@ -7,7 +7,9 @@ import (
 	"io"
 	"net/http"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
 	"github.com/martiriera/discogs-spotify/internal/core/ports"
@@ -18,12 +20,14 @@ import (
 )
 
 type StubSpotifyHTTPClient struct {
-	Responses []*http.Response
-	index     int
-	Error     error
+	Responses     []*http.Response
+	RequestedURLs []string
+	index         int
+	Error         error
 }
 
-func (s *StubSpotifyHTTPClient) Do(_ *http.Request) (*http.Response, error) {
+func (s *StubSpotifyHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	s.RequestedURLs = append(s.RequestedURLs, req.URL.String())
 	if s.index >= len(s.Responses) {
 		return nil, s.Error
 	}
@@ -48,6 +52,11 @@ func (m *MockContextProvider) GetToken(_ context.Context) (*oauth2.Token, error)
 	return m.token, nil
 }
 
+func (m *MockContextProvider) SetToken(_ context.Context, token *oauth2.Token) error {
+	m.token = token
+	return nil
+}
+
 func (m *MockContextProvider) GetUserID(_ context.Context) (string, error) {
 	return m.userID, nil
 }
@@ -57,6 +66,10 @@ func (m *MockContextProvider) SetUserID(_ context.Context, userID string) error
 	return nil
 }
 
+func (*MockContextProvider) GetDiscogsCredentials(_ context.Context) (*entities.DiscogsCredentials, error) {
+	return nil, nil
+}
+
 func TestSearchAlbum(t *testing.T) {
 	t.Setenv("SPOTIFY_CLIENT_ID", "test")
 	t.Setenv("SPOTIFY_CLIENT_SECRET", "test")
@@ -154,7 +167,7 @@ func TestSearchAlbum(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			stubClient := &StubSpotifyHTTPClient{Responses: []*http.Response{tc.response}}
 			contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler")
-			service := NewHTTPService(stubClient, contextProvider)
+			service := NewHTTPService(stubClient, contextProvider, nil)
 
 			response, err := tc.request(service)
 
@@ -227,7 +240,7 @@ func TestGetUser(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			stubClient := &StubSpotifyHTTPClient{Responses: []*http.Response{tc.response}}
 			contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler")
-			service := NewHTTPService(stubClient, contextProvider)
+			service := NewHTTPService(stubClient, contextProvider, nil)
 			response, err := tc.request(service)
 			if err != nil {
 				t.Errorf("error is not nil: %v", err)
@@ -270,7 +283,7 @@ func TestCreatePlaylist(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			stubClient := &StubSpotifyHTTPClient{Responses: []*http.Response{tc.response}}
 			contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler")
-			service := NewHTTPService(stubClient, contextProvider)
+			service := NewHTTPService(stubClient, contextProvider, nil)
 			response, err := tc.request(service)
 			if err != nil {
 				t.Errorf("error is not nil: %v", err)
@@ -322,7 +335,7 @@ func TestGetAlbumsTrackUris(t *testing.T) {
 	}
 	stubClient := &StubSpotifyHTTPClient{Responses: []*http.Response{stubResponse}}
 	contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler")
-	service := NewHTTPService(stubClient, contextProvider)
+	service := NewHTTPService(stubClient, contextProvider, nil)
 	uris, err := service.GetAlbumsTrackUris(ctx, []string{"spotify:album:1", "spotify:album:2"})
 	if err != nil {
 		t.Errorf("did not expect error, got %v", err)
@@ -332,6 +345,134 @@ func TestGetAlbumsTrackUris(t *testing.T) {
 	}
 }
 
+func TestGetPlaylistItems(t *testing.T) {
+	ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+	firstPage := &http.Response{
+		StatusCode: 200,
+		Body: io.NopCloser(bytes.NewBufferString(`{
+			"items": [
+				{"track": {"uri": "spotify:track:1", "album": {"id": "album1"}}},
+				{"track": null}
+			],
+			"next": "https://api.spotify.com/v1/playlists/6rqhFgbbKwnb9MLmUQDhG6/tracks?offset=100&limit=100"
+		}`)),
+	}
+	secondPage := &http.Response{
+		StatusCode: 200,
+		Body: io.NopCloser(bytes.NewBufferString(`{
+			"items": [
+				{"track": {"uri": "spotify:track:2", "album": {"id": "album2"}}}
+			],
+			"next": null
+		}`)),
+	}
+	stubClient := &StubSpotifyHTTPClient{Responses: []*http.Response{firstPage, secondPage}}
+	contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler")
+	service := NewHTTPService(stubClient, contextProvider, nil)
+
+	items, err := service.GetPlaylistItems(ctx, "6rqhFgbbKwnb9MLmUQDhG6")
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	want := []entities.SpotifyPlaylistItem{
+		{TrackURI: "spotify:track:1", AlbumID: "album1"},
+		{TrackURI: "spotify:track:2", AlbumID: "album2"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+}
+
+func TestSearchAlbumByBarcode(t *testing.T) {
+	ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+	searchResponse := func(body string) *http.Response {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(body))}
+	}
+	nevermind := `{"albums": {"items": [{"id": "2UJcKiJxNryhL050F5Z1Fk", "name": "Nevermind (Remastered)", "album_type": "album"}]}}`
+	album := entities.Album{Artist: "Nirvana", Title: "Nevermind", Barcodes: []string{"0720642442517", "720642442517"}}
+
+	tcs := []struct {
+		name      string
+		responses []*http.Response
+		wantURLs  []string
+	}{
+		{
+			name:      "barcode found",
+			responses: []*http.Response{searchResponse(nevermind)},
+			wantURLs:  []string{"https://api.spotify.com/v1/search?q=upc%3A0720642442517&type=album&limit=4"},
+		},
+		{
+			name: "falls back to artist and title",
+			responses: []*http.Response{
+				searchResponse(`{"albums": {"items": []}}`),
+				searchResponse(`{"albums": {"items": []}}`),
+				searchResponse(nevermind),
+			},
+			wantURLs: []string{
+				"https://api.spotify.com/v1/search?q=upc%3A0720642442517&type=album&limit=4",
+				"https://api.spotify.com/v1/search?q=upc%3A720642442517&type=album&limit=4",
+				"https://api.spotify.com/v1/search?q=album%3ANevermind+artist%3ANirvana&type=album&limit=4",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			stubClient := &StubSpotifyHTTPClient{Responses: tc.responses}
+			contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler")
+			service := NewHTTPService(stubClient, contextProvider, nil)
+
+			albums, err := service.SearchAlbum(ctx, album)
+			if err != nil {
+				t.Fatalf("did not expect error, got %v", err)
+			}
+			if len(albums) != 1 || albums[0].ID != "2UJcKiJxNryhL050F5Z1Fk" {
+				t.Errorf("got %+v, want Nevermind", albums)
+			}
+			if !reflect.DeepEqual(stubClient.RequestedURLs, tc.wantURLs) {
+				t.Errorf("got requests %v, want %v", stubClient.RequestedURLs, tc.wantURLs)
+			}
+		})
+	}
+}
+
+func TestSearchTrack(t *testing.T) {
+	ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+	response := &http.Response{
+		StatusCode: 200,
+		Body: io.NopCloser(bytes.NewBufferString(`{
+			"tracks": {
+				"items": [
+					{
+						"id": "6sSYmP3ZNqqSOn0wbYnKxK",
+						"name": "Xtal",
+						"uri": "spotify:track:6sSYmP3ZNqqSOn0wbYnKxK",
+						"duration_ms": 294000,
+						"album": {"id": "7aNclGRxTysfh6z0d8671k", "name": "Selected Ambient Works 85-92"},
+						"artists": [{"id": "6kBDZFXuLrZgHnvmPu9NsG", "name": "Aphex Twin"}]
+					}
+				],
+				"total": 1
+			}
+		}`)),
+	}
+	stubClient := &StubSpotifyHTTPClient{Responses: []*http.Response{response}}
+	contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler")
+	service := NewHTTPService(stubClient, contextProvider, nil)
+
+	tracks, err := service.SearchTrack(ctx, entities.Track{Artist: "Aphex Twin", Title: "Xtal"})
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if len(tracks) != 1 || tracks[0].URI != "spotify:track:6sSYmP3ZNqqSOn0wbYnKxK" || tracks[0].DurationMs != 294000 {
+		t.Errorf("got %+v, want the Xtal track", tracks)
+	}
+	want := "https://api.spotify.com/v1/search?q=track%3AXtal+artist%3AAphex+Twin&type=track&limit=4"
+	if stubClient.RequestedURLs[0] != want {
+		t.Errorf("got request %s, want %s", stubClient.RequestedURLs[0], want)
+	}
+}
+
 func TestServiceError(t *testing.T) {
 	t.Setenv("SPOTIFY_CLIENT_ID", "test")
 	t.Setenv("SPOTIFY_CLIENT_SECRET", "test")
@@ -343,7 +484,7 @@ func TestServiceError(t *testing.T) {
 	ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
 
 	contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler")
-	service := NewHTTPService(stubClient, contextProvider)
+	service := NewHTTPService(stubClient, contextProvider, nil)
 	_, err := service.SearchAlbum(ctx, entities.Album{Artist: "Delta Sleep", Title: "Spring Island"})
 
 	want := `status: 400, body: {"message": "Bad Request"}: spotify API error`
@@ -368,7 +509,7 @@ func TestServiceUnauthorized(t *testing.T) {
 	ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
 
 	contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "test"}, "wizzler")
-	service := NewHTTPService(stubClient, contextProvider)
+	service := NewHTTPService(stubClient, contextProvider, nil)
 	_, err := service.SearchAlbum(ctx, entities.Album{Artist: "Delta Sleep", Title: "Spring Island"})
 
 	if err == nil {
@@ -378,3 +519,123 @@ func TestServiceUnauthorized(t *testing.T) {
 		t.Errorf("got %v, want %v", err, ErrSpotifyUnauthorized)
 	}
 }
+
+type stubTokenRefresher struct {
+	token       *oauth2.Token
+	CalledCount int
+}
+
+func (s *stubTokenRefresher) RefreshToken(_ context.Context, _ *oauth2.Token) (*oauth2.Token, error) {
+	s.CalledCount++
+	return s.token, nil
+}
+
+func TestServiceUnauthorizedRefreshesToken(t *testing.T) {
+	stubResponses := []*http.Response{
+		{
+			StatusCode: 401,
+			Body:       io.NopCloser(bytes.NewBufferString(`{"error": "The access token expired"}`)),
+		},
+		{
+			StatusCode: 200,
+			Body:       io.NopCloser(bytes.NewBufferString(`{"id": "wizzler"}`)),
+		},
+	}
+	stubClient := &StubSpotifyHTTPClient{Responses: stubResponses}
+	ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "expired"})
+
+	contextProvider := NewMockContextProvider(&oauth2.Token{AccessToken: "expired", RefreshToken: "refresh"}, "")
+	refresher := &stubTokenRefresher{token: &oauth2.Token{AccessToken: "refreshed", RefreshToken: "refresh"}}
+	service := NewHTTPService(stubClient, contextProvider, refresher)
+	userID, err := service.GetUserID(ctx)
+
+	if err != nil {
+		t.Errorf("did not expect error, got %v", err)
+	}
+	if userID != "wizzler" {
+		t.Errorf("got %s, want wizzler", userID)
+	}
+	if refresher.CalledCount != 1 {
+		t.Errorf("got %d refreshes, want 1", refresher.CalledCount)
+	}
+	if contextProvider.token.AccessToken != "refreshed" {
+		t.Errorf("got token %s, want refreshed", contextProvider.token.AccessToken)
+	}
+}
+
+type testUserKey struct{}
+
+// userTokenProvider keeps a token per user, the user is taken from the context
+type userTokenProvider struct {
+	MockContextProvider
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
+}
+
+func (p *userTokenProvider) GetToken(ctx context.Context) (*oauth2.Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tokens[ctx.Value(testUserKey{}).(string)], nil
+}
+
+func (p *userTokenProvider) SetToken(ctx context.Context, token *oauth2.Token) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens[ctx.Value(testUserKey{}).(string)] = token
+	return nil
+}
+
+// blockingTokenRefresher holds the refreshes of the "slow" refresh token until release is closed
+type blockingTokenRefresher struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingTokenRefresher) RefreshToken(_ context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	if token.RefreshToken == "slow" {
+		close(r.started)
+		<-r.release
+	}
+	return &oauth2.Token{AccessToken: "refreshed-" + token.RefreshToken, RefreshToken: token.RefreshToken}, nil
+}
+
+func TestServiceRefreshDoesNotWaitForOtherUsers(t *testing.T) {
+	contextProvider := &userTokenProvider{tokens: map[string]*oauth2.Token{
+		"slow": {AccessToken: "expired-slow", RefreshToken: "slow"},
+		"fast": {AccessToken: "expired-fast", RefreshToken: "fast"},
+	}}
+	refresher := &blockingTokenRefresher{started: make(chan struct{}), release: make(chan struct{})}
+	service := NewHTTPService(&StubSpotifyHTTPClient{}, contextProvider, refresher)
+
+	slowDone := make(chan error, 1)
+	go func() {
+		slowCtx := context.WithValue(context.Background(), testUserKey{}, "slow")
+		slowDone <- service.refreshToken(slowCtx, &oauth2.Token{AccessToken: "expired-slow", RefreshToken: "slow"})
+	}()
+	<-refresher.started
+
+	fastDone := make(chan error, 1)
+	go func() {
+		fastCtx := context.WithValue(context.Background(), testUserKey{}, "fast")
+		fastDone <- service.refreshToken(fastCtx, &oauth2.Token{AccessToken: "expired-fast", RefreshToken: "fast"})
+	}()
+
+	select {
+	case err := <-fastDone:
+		if err != nil {
+			t.Errorf("did not expect error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("refresh waited for the refresh of another user")
+	}
+
+	close(refresher.release)
+	if err := <-slowDone; err != nil {
+		t.Errorf("did not expect error, got %v", err)
+	}
+	for user, token := range contextProvider.tokens {
+		if token.AccessToken != "refreshed-"+user {
+			t.Errorf("got token %s for %s, want refreshed-%s", token.AccessToken, user, user)
+		}
+	}
+}
@@ -1,7 +1,17 @@
 package entities
 
+const (
+	AlbumTypeAlbum       = "album"
+	AlbumTypeSingle      = "single"
+	AlbumTypeCompilation = "compilation"
+)
+
 type Album struct {
 	Artist string
 	Title  string
 	Year   int
+	Tracks int    // zero when unknown
+	Type   string // one of the Spotify album types, empty when unknown
+	// Barcodes are the UPC/EAN codes of the exact edition, searched on Spotify before the artist and title
+	Barcodes []string
 }
@@ -0,0 +1,213 @@
+package entities
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DefaultMatchThreshold = 0.75
+
+// weights of every signal in the final score, signals unknown on either side are left out
+const (
+	artistWeight       = 0.30
+	titleEditWeight    = 0.25
+	titleOverlapWeight = 0.15
+	yearWeight         = 0.10
+	tracksWeight       = 0.10
+	typeWeight         = 0.10
+)
+
+// years apart at which the year signal drops to zero, reissues make small gaps common
+const maxYearDistance = 10
+
+const (
+	// minTitleSimilarity is the title similarity below which an artist match alone can't make the album,
+	// the score is kept under it
+	minTitleSimilarity = 0.5
+	// sequelPenalty scales down the score of titles numbered apart, like "Greatest Hits" and "Greatest Hits II"
+	sequelPenalty = 0.7
+)
+
+// romanNumerals numbers the sequels, single letters are left out as they are more often words
+var romanNumerals = map[string]string{
+	"ii": "2", "iii": "3", "iv": "4", "vi": "6", "vii": "7", "viii": "8", "ix": "9",
+	"xi": "11", "xii": "12", "xiii": "13", "xiv": "14", "xv": "15", "xvi": "16", "xvii": "17", "xviii": "18",
+	"xix": "19", "xx": "20",
+}
+
+type AlbumMatch struct {
+	Album SpotifyAlbumItem
+	Score float64
+}
+
+// AlbumMatcher scores Spotify search results against a Discogs album
+type AlbumMatcher struct {
+	threshold float64
+}
+
+func NewAlbumMatcher(threshold float64) *AlbumMatcher {
+	return &AlbumMatcher{threshold: threshold}
+}
+
+func (m *AlbumMatcher) Threshold() float64 {
+	return m.threshold
+}
+
+// Match returns the best scored candidate, ok reports whether it reaches the threshold
+func (m *AlbumMatcher) Match(album Album, candidates []SpotifyAlbumItem) (match AlbumMatch, ok bool) {
+	matches := m.Rank(album, candidates)
+	if len(matches) == 0 {
+		return AlbumMatch{}, false
+	}
+	return matches[0], matches[0].Score >= m.threshold
+}
+
+// Rank scores every candidate, best first
+func (m *AlbumMatcher) Rank(album Album, candidates []SpotifyAlbumItem) []AlbumMatch {
+	matches := make([]AlbumMatch, len(candidates))
+	for i := range candidates {
+		matches[i] = AlbumMatch{Album: candidates[i], Score: m.Score(album, &candidates[i])}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
+
+// Score returns how likely the candidate is the album, from 0 to 1
+func (m *AlbumMatcher) Score(album Album, candidate *SpotifyAlbumItem) float64 {
+	inputTitle := NormalizeName(album.Title)
+	candidateTitle := NormalizeName(candidate.Name)
+
+	artistScore := 0.0
+	inputArtist := NormalizeName(album.Artist)
+	for _, artist := range candidate.Artists {
+		artistScore = max(artistScore, editSimilarity(inputArtist, NormalizeName(artist.Name)))
+	}
+
+	var total, weights float64
+	add := func(score, weight float64) {
+		total += score * weight
+		weights += weight
+	}
+
+	titleEdit, titleOverlap := editSimilarity(inputTitle, candidateTitle), tokenOverlap(inputTitle, candidateTitle)
+	add(artistScore, artistWeight)
+	add(titleEdit, titleEditWeight)
+	add(titleOverlap, titleOverlapWeight)
+
+	if year := releaseYear(candidate.ReleaseDate); album.Year > 0 && year > 0 {
+		distance := min(abs(album.Year-year), maxYearDistance)
+		add(1-float64(distance)/maxYearDistance, yearWeight)
+	}
+	if album.Tracks > 0 && candidate.TotalTracks > 0 {
+		add(float64(min(album.Tracks, candidate.TotalTracks))/float64(max(album.Tracks, candidate.TotalTracks)), tracksWeight)
+	}
+	if album.Type != "" && candidate.AlbumType != "" {
+		score := 0.0
+		if strings.EqualFold(album.Type, candidate.AlbumType) {
+			score = 1
+		}
+		add(score, typeWeight)
+	}
+
+	score := total / weights
+	if !slices.Equal(sequelNumbers(inputTitle), sequelNumbers(candidateTitle)) {
+		score *= sequelPenalty
+	}
+	if title := max(titleEdit, titleOverlap); title < minTitleSimilarity {
+		score = min(score, title)
+	}
+	return score
+}
+
+// sequelNumbers returns the numbers of the title, as in "Vol. 2" or "Greatest Hits II", sorted.
+// Numbers of more than two digits are mostly years of remasters, so they are left out
+func sequelNumbers(title string) []string {
+	numbers := []string{}
+	for _, token := range strings.Fields(title) {
+		if number, exists := romanNumerals[token]; exists {
+			numbers = append(numbers, number)
+			continue
+		}
+		if n, err := strconv.Atoi(token); err == nil && len(token) <= 2 {
+			numbers = append(numbers, strconv.Itoa(n))
+		}
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+// editSimilarity is the Levenshtein distance scaled to 0 (nothing in common) to 1 (equal).
+// Names with nothing left once normalized, like "!!!", can't be told apart so they never match
+func editSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(max(len(ra), len(rb)))
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// tokenOverlap is the Jaccard index of the words of both normalized names
+func tokenOverlap(a, b string) float64 {
+	tokensA, tokensB := tokenSet(a), tokenSet(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+	shared := 0
+	for token := range tokensA {
+		if _, exists := tokensB[token]; exists {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(tokensA)+len(tokensB)-shared)
+}
+
+func tokenSet(name string) map[string]struct{} {
+	tokens := make(map[string]struct{})
+	for _, token := range strings.Fields(name) {
+		tokens[token] = struct{}{}
+	}
+	return tokens
+}
+
+// releaseYear parses Spotify release dates, which come as "1982", "1982-06" or "1982-06-01"
+func releaseYear(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
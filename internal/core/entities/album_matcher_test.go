@@ -0,0 +1,150 @@
+package entities
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAlbumMatcher_Match(t *testing.T) {
+	candidate := func(id, artist, name, releaseDate, albumType string) SpotifyAlbumItem {
+		return SpotifyAlbumItem{
+			ID:          id,
+			Name:        name,
+			AlbumType:   albumType,
+			ReleaseDate: releaseDate,
+			Artists:     []SpotifyAlbumArtist{{Name: artist}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		album      Album
+		candidates []SpotifyAlbumItem
+		wantID     string
+		wantOK     bool
+	}{
+		{
+			name:       "exact match",
+			album:      Album{Artist: "Descendents", Title: "Milo Goes to College"},
+			candidates: MotherSpotifyAlbums(),
+			wantID:     SpotifyAlbumIDMiloGoesToCollege,
+			wantOK:     true,
+		},
+		{
+			name:  "small spelling differences",
+			album: Album{Artist: "The Jim Caroll Band", Title: "Catholic Boy (Remastered)"},
+			candidates: []SpotifyAlbumItem{
+				candidate("1", "The Jim Carroll Band", "Catholic Boy", "1980", "album"),
+			},
+			wantID: "1",
+			wantOK: true,
+		},
+		{
+			name:  "single shared word is not enough",
+			album: Album{Artist: "Descendents", Title: "Live"},
+			candidates: []SpotifyAlbumItem{
+				candidate("1", "Descendents", "Live at the Whisky a Go Go", "1989", "album"),
+			},
+			wantID: "1",
+			wantOK: false,
+		},
+		{
+			name:  "same title from another artist",
+			album: Album{Artist: "Descendents", Title: "Greatest Hits"},
+			candidates: []SpotifyAlbumItem{
+				candidate("1", "Queen", "Greatest Hits", "1981", "compilation"),
+			},
+			wantID: "1",
+			wantOK: false,
+		},
+		{
+			name:  "first volume is not the sequel",
+			album: Album{Artist: "Queen", Title: "Greatest Hits II", Year: 1991, Type: AlbumTypeCompilation},
+			candidates: []SpotifyAlbumItem{
+				candidate("1", "Queen", "Greatest Hits", "1981", "compilation"),
+			},
+			wantID: "1",
+			wantOK: false,
+		},
+		{
+			name:  "sequels numbered apart",
+			album: Album{Artist: "Queen", Title: "Greatest Hits III", Year: 1999, Type: AlbumTypeCompilation},
+			candidates: []SpotifyAlbumItem{
+				candidate("1", "Queen", "Greatest Hits II", "1991", "compilation"),
+			},
+			wantID: "1",
+			wantOK: false,
+		},
+		{
+			name:  "volume number written apart",
+			album: Album{Artist: "Queen", Title: "Greatest Hits Vol. 2", Year: 1991},
+			candidates: []SpotifyAlbumItem{
+				candidate("1", "Queen", "Greatest Hits", "1991", "compilation"),
+				candidate("2", "Queen", "Greatest Hits II", "1991", "compilation"),
+			},
+			wantID: "2",
+			wantOK: true,
+		},
+		{
+			name:  "artists with nothing left once normalized",
+			album: Album{Artist: "!!!", Title: "Myth Takes"},
+			candidates: []SpotifyAlbumItem{
+				candidate("1", "???", "Myth Takes", "", ""),
+			},
+			wantID: "1",
+			wantOK: false,
+		},
+		{
+			name:  "year and album type break ties",
+			album: Album{Artist: "Descendents", Title: "Everything Sucks", Year: 1996, Type: AlbumTypeAlbum},
+			candidates: []SpotifyAlbumItem{
+				candidate("1", "Descendents", "Everything Sucks", "2016-05-20", "single"),
+				candidate("2", "Descendents", "Everything Sucks", "1996-09-24", "album"),
+			},
+			wantID: "2",
+			wantOK: true,
+		},
+		{
+			name:       "no candidates",
+			album:      Album{Artist: "Descendents", Title: "Milo Goes to College"},
+			candidates: nil,
+			wantOK:     false,
+		},
+	}
+
+	matcher := NewAlbumMatcher(DefaultMatchThreshold)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, ok := matcher.Match(tt.album, tt.candidates)
+			if ok != tt.wantOK {
+				t.Errorf("got ok %v with score %f, want %v", ok, match.Score, tt.wantOK)
+			}
+			if match.Album.ID != tt.wantID {
+				t.Errorf("got album %s, want %s", match.Album.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestAlbumMatcher_Score(t *testing.T) {
+	matcher := NewAlbumMatcher(DefaultMatchThreshold)
+	album := Album{Artist: "Descendents", Title: "Milo Goes to College", Year: 1982, Tracks: 15, Type: AlbumTypeAlbum}
+	candidate := SpotifyAlbumItem{
+		Name:        "Milo Goes To College",
+		AlbumType:   "album",
+		ReleaseDate: "1982-09-01",
+		TotalTracks: 15,
+		Artists:     []SpotifyAlbumArtist{{Name: "Descendents"}},
+	}
+
+	if score := matcher.Score(album, &candidate); math.Abs(score-1) > 1e-9 {
+		t.Errorf("got score %f, want 1", score)
+	}
+
+	candidate.ReleaseDate = "1987"
+	candidate.TotalTracks = 10
+	score := matcher.Score(album, &candidate)
+	if score >= 1 || score < matcher.Threshold() {
+		t.Errorf("got score %f, want it lowered but above the threshold", score)
+	}
+}
@@ -0,0 +1,11 @@
+package entities
+
+// CachedMatch is the Spotify album chosen for a Discogs release in a previous conversion,
+// SpotifyAlbumID is empty when none was good enough, or when the release was matched track by track
+type CachedMatch struct {
+	SpotifyAlbumID string      `json:"spotify_album_id,omitempty"`
+	TrackURIs      []string    `json:"track_uris,omitempty"`
+	Candidates     int         `json:"candidates"`
+	Score          float64     `json:"score"`
+	Reason         MatchReason `json:"reason,omitempty"`
+}
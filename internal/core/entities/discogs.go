@@ -1,5 +1,7 @@
 package entities
 
+import "strconv"
+
 type URLType string
 
 func (t URLType) String() string {
@@ -10,9 +12,63 @@ const (
 	CollectionType URLType = "collection"
 	WantlistType   URLType = "wantlist"
 	ListType       URLType = "list"
+	ArtistType     URLType = "artist"
+	LabelType      URLType = "label"
+	MasterType     URLType = "master"
+	ReleaseType    URLType = "release"
 )
 
 type ParsedDiscogsURL struct {
-	ID   string
-	Type URLType
+	ID       string
+	Type     URLType
+	FolderID int       // collection folder, 0 is the "All" folder
+	Name     string    // name in the URL, like the artist in discogs.com/artist/125246-Nirvana, when it has one
+	Years    YearRange // releases to keep, every year when zero
+}
+
+// YearRange includes both years, a zero bound leaves that side open
+type YearRange struct {
+	From int
+	To   int
+}
+
+func (r YearRange) IsZero() bool {
+	return r.From == 0 && r.To == 0
+}
+
+// Contains reports whether the year is in the range, unknown years (0) only match an empty range
+func (r YearRange) Contains(year int) bool {
+	if r.IsZero() {
+		return true
+	}
+	if year == 0 {
+		return false
+	}
+	return (r.From == 0 || year >= r.From) && (r.To == 0 || year <= r.To)
+}
+
+func (r YearRange) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	from, to := "", ""
+	if r.From != 0 {
+		from = strconv.Itoa(r.From)
+	}
+	if r.To != 0 {
+		to = strconv.Itoa(r.To)
+	}
+	return from + "-" + to
+}
+
+// Source identifies the Discogs collection, wantlist or list regardless of how its URL was written
+func (u *ParsedDiscogsURL) Source() string {
+	source := u.Type.String() + "/" + u.ID
+	if u.FolderID != 0 {
+		source += "/" + strconv.Itoa(u.FolderID)
+	}
+	if !u.Years.IsZero() {
+		source += "/" + u.Years.String()
+	}
+	return source
 }
@@ -0,0 +1,26 @@
+package entities
+
+// DiscogsCredentials authenticate the Discogs requests of a user, either with the personal access token
+// generated in the Discogs developer settings or with the token and secret of an OAuth 1.0a login
+type DiscogsCredentials struct {
+	PersonalToken string `json:"personal_token,omitempty"`
+	OAuthToken    string `json:"oauth_token,omitempty"`
+	OAuthSecret   string `json:"oauth_secret,omitempty"`
+	Username      string `json:"username"` // Discogs account the credentials belong to
+}
+
+// Linked reports whether there are credentials, an unlinked account is kept in the session as empty credentials
+func (c *DiscogsCredentials) Linked() bool {
+	return c != nil && (c.PersonalToken != "" || c.OAuthToken != "")
+}
+
+// IsOAuth reports whether the credentials come from an OAuth login instead of a personal token
+func (c *DiscogsCredentials) IsOAuth() bool {
+	return c.OAuthToken != ""
+}
+
+// DiscogsIdentity is the payload of /oauth/identity, the account authenticated requests are made as
+type DiscogsIdentity struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
@@ -0,0 +1,119 @@
+package entities
+
+import "strings"
+
+// DiscogsReleaseDetail is the full payload of /releases/{id}
+type DiscogsReleaseDetail struct {
+	ID          int                 `json:"id"`
+	MasterID    int                 `json:"master_id"`
+	Title       string              `json:"title"`
+	Year        int                 `json:"year"`
+	Country     string              `json:"country"`
+	Artists     []DiscogsArtist     `json:"artists"`
+	Formats     []DiscogsFormat     `json:"formats"`
+	Labels      []DiscogsLabel      `json:"labels"`
+	Identifiers []DiscogsIdentifier `json:"identifiers"`
+	Tracklist   []DiscogsTrack      `json:"tracklist"`
+	Genres      []string            `json:"genres"`
+	Styles      []string            `json:"styles"`
+}
+
+// ToRelease returns the release as listed in collections, to convert it like any other source
+func (r *DiscogsReleaseDetail) ToRelease() DiscogsRelease {
+	return DiscogsRelease{
+		BasicInformation: DiscogsBasicInformation{
+			ID:       r.ID,
+			MasterID: r.MasterID,
+			Title:    r.Title,
+			Year:     r.Year,
+			Artists:  r.Artists,
+			Formats:  r.Formats,
+		},
+		Tracklist:   r.Tracklist,
+		Identifiers: r.Identifiers,
+	}
+}
+
+// DiscogsMaster is the full payload of /masters/{id}, it groups every version of a release
+type DiscogsMaster struct {
+	ID          int             `json:"id"`
+	MainRelease int             `json:"main_release"`
+	Title       string          `json:"title"`
+	Year        int             `json:"year"`
+	Artists     []DiscogsArtist `json:"artists"`
+	Tracklist   []DiscogsTrack  `json:"tracklist"`
+	Genres      []string        `json:"genres"`
+	Styles      []string        `json:"styles"`
+}
+
+// ToRelease returns the main release of the master as listed in collections
+func (m *DiscogsMaster) ToRelease() DiscogsRelease {
+	return DiscogsRelease{
+		BasicInformation: DiscogsBasicInformation{
+			ID:       m.MainRelease,
+			MasterID: m.ID,
+			Title:    m.Title,
+			Year:     m.Year,
+			Artists:  m.Artists,
+		},
+		Tracklist: m.Tracklist,
+	}
+}
+
+type DiscogsLabel struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	CatNo string `json:"catno"`
+}
+
+// DiscogsIdentifier is a code printed on the release, like its barcode or matrix numbers
+type DiscogsIdentifier struct {
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Description string `json:"description"`
+}
+
+// DiscogsTrack is an entry of a tracklist, headings and index tracks group the actual tracks
+type DiscogsTrack struct {
+	Position  string          `json:"position"`
+	Type      string          `json:"type_"` // track, heading or index
+	Title     string          `json:"title"`
+	Duration  string          `json:"duration"`
+	Artists   []DiscogsArtist `json:"artists"`    // only when they differ from the release artists
+	SubTracks []DiscogsTrack  `json:"sub_tracks"` // the tracks grouped by an index track
+}
+
+// UPC-A barcodes have 12 digits and EAN-13 ones 13, others like the ones including a price add-on are left out
+const (
+	minBarcodeLength = 12
+	maxBarcodeLength = 13
+)
+
+// maxBarcodes bounds the Spotify searches of a release, releases list the same barcode in several ways
+const maxBarcodes = 2
+
+// Barcodes returns the UPC and EAN barcodes of the release as digits only, without repeating them
+func (r *DiscogsRelease) Barcodes() []string {
+	barcodes := []string{}
+	seen := map[string]bool{}
+	for _, identifier := range r.Identifiers {
+		if !strings.EqualFold(identifier.Type, "barcode") {
+			continue
+		}
+		barcode := strings.Map(func(r rune) rune {
+			if r < '0' || r > '9' {
+				return -1
+			}
+			return r
+		}, identifier.Value)
+		if len(barcode) < minBarcodeLength || len(barcode) > maxBarcodeLength || seen[barcode] {
+			continue
+		}
+		seen[barcode] = true
+		barcodes = append(barcodes, barcode)
+		if len(barcodes) == maxBarcodes {
+			break
+		}
+	}
+	return barcodes
+}
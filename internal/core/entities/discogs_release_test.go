@@ -0,0 +1,27 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiscogsRelease_Barcodes(t *testing.T) {
+	release := DiscogsRelease{
+		Identifiers: []DiscogsIdentifier{
+			{Type: "Barcode", Value: "0 720642 442517", Description: "Text"},
+			{Type: "Barcode", Value: "720642442517", Description: "Scanned"},
+			{Type: "Matrix / Runout", Value: "DGC-24425-A"},
+			{Type: "Barcode", Value: "0720642442517"},
+			{Type: "Barcode", Value: "5 099749 150227 01"},
+			{Type: "Barcode", Value: "5099749150227"},
+		},
+	}
+
+	want := []string{"0720642442517", "720642442517"}
+	if got := release.Barcodes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := (&DiscogsRelease{}).Barcodes(); len(got) != 0 {
+		t.Errorf("got %v, want no barcodes", got)
+	}
+}
@@ -66,6 +66,106 @@ func (r *DiscogsListResponse) GetReleases() []DiscogsRelease {
 	return releases
 }
 
+type DiscogsArtistReleasesResponse struct {
+	Pagination DiscogsPagination      `json:"pagination"`
+	Releases   []DiscogsArtistRelease `json:"releases"`
+}
+
+func (r *DiscogsArtistReleasesResponse) GetPagination() DiscogsPagination {
+	return r.Pagination
+}
+
+// GetReleases keeps the masters the artist has the main role in, leaving out
+// appearances, remixes and the single releases without a master
+func (r *DiscogsArtistReleasesResponse) GetReleases() []DiscogsRelease {
+	releases := make([]DiscogsRelease, 0, len(r.Releases))
+	for _, item := range r.Releases {
+		if item.Type != "master" || item.Role != "Main" {
+			continue
+		}
+		releases = append(releases, DiscogsRelease{
+			BasicInformation: DiscogsBasicInformation{
+				ID:       item.MainRelease,
+				MasterID: item.ID,
+				Title:    item.Title,
+				Year:     item.Year,
+				Artists:  []DiscogsArtist{{Name: item.Artist}},
+			},
+		})
+	}
+	return releases
+}
+
+type DiscogsArtistRelease struct {
+	ID          int    `json:"id"`
+	Type        string `json:"type"` // master or release
+	MainRelease int    `json:"main_release"`
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	Year        int    `json:"year"`
+	Role        string `json:"role"`
+}
+
+type DiscogsLabelReleasesResponse struct {
+	Pagination DiscogsPagination     `json:"pagination"`
+	Releases   []DiscogsLabelRelease `json:"releases"`
+}
+
+func (r *DiscogsLabelReleasesResponse) GetPagination() DiscogsPagination {
+	return r.Pagination
+}
+
+func (r *DiscogsLabelReleasesResponse) GetReleases() []DiscogsRelease {
+	releases := make([]DiscogsRelease, len(r.Releases))
+	for i, item := range r.Releases {
+		releases[i] = DiscogsRelease{
+			BasicInformation: DiscogsBasicInformation{
+				ID:       item.ID,
+				MasterID: item.MasterID,
+				Title:    item.Title,
+				Year:     item.Year,
+				Artists:  []DiscogsArtist{{Name: item.Artist}},
+				Formats:  parseLabelFormat(item.Format),
+			},
+		}
+	}
+	return releases
+}
+
+// DiscogsLabelRelease is a release in the label catalog, master_id isn't always present
+type DiscogsLabelRelease struct {
+	ID       int    `json:"id"`
+	MasterID int    `json:"master_id"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	Year     int    `json:"year"`
+	Format   string `json:"format"` // like "Vinyl, 12\", EP"
+	CatNo    string `json:"catno"`
+}
+
+// parseLabelFormat reads the format summary of label releases, its first part is the format name
+// and the rest its descriptions
+func parseLabelFormat(format string) []DiscogsFormat {
+	if format == "" {
+		return nil
+	}
+	parts := strings.Split(format, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return []DiscogsFormat{{Name: parts[0], Descriptions: parts[1:]}}
+}
+
+type DiscogsFoldersResponse struct {
+	Folders []DiscogsFolder `json:"folders"`
+}
+
+type DiscogsFolder struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
 type DiscogsPagination struct {
 	Page    int `json:"page"`
 	Pages   int `json:"pages"`
@@ -82,6 +182,33 @@ type DiscogsRelease struct {
 	InstanceID       int                     `json:"instance_id"`
 	DateAdded        string                  `json:"date_added"`
 	BasicInformation DiscogsBasicInformation `json:"basic_information"`
+	// Tracklist and Identifiers come from the release details, nil when they weren't fetched
+	Tracklist   []DiscogsTrack      `json:"-"`
+	Identifiers []DiscogsIdentifier `json:"-"`
+}
+
+// MatchByTrack reports whether the release has to be matched on Spotify track by track instead of
+// as an album: compilations credited to "Various" and DJ mixes rarely exist as the same album on Spotify
+func (r *DiscogsRelease) MatchByTrack() bool {
+	for _, artist := range r.BasicInformation.Artists {
+		if isVariousArtists(artist.Name) {
+			return true
+		}
+	}
+	for _, format := range r.BasicInformation.Formats {
+		for _, description := range format.Descriptions {
+			if strings.EqualFold(description, "mixed") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isVariousArtists reports whether the artist is the one Discogs credits compilations to
+func isVariousArtists(name string) bool {
+	name = NormalizeName(name)
+	return name == "various" || name == "various artists"
 }
 
 type DiscogsBasicInformation struct {
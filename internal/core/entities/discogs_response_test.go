@@ -85,3 +85,28 @@ func TestDiscogsListResponse_GetReleases(t *testing.T) {
 		})
 	}
 }
+
+func TestDiscogsArtistReleasesResponse_GetReleases(t *testing.T) {
+	response := DiscogsArtistReleasesResponse{
+		Releases: []DiscogsArtistRelease{
+			{ID: 13814, Type: "master", MainRelease: 367113, Title: "Nevermind", Artist: "Nirvana", Year: 1991, Role: "Main"},
+			{ID: 2048, Type: "release", Title: "Sliver", Artist: "Nirvana", Year: 1990, Role: "Main"},
+			{ID: 98765, Type: "master", MainRelease: 5432, Title: "Tribute", Artist: "Various", Year: 2001, Role: "TrackAppearance"},
+		},
+	}
+
+	want := []DiscogsRelease{
+		{
+			BasicInformation: DiscogsBasicInformation{
+				ID:       367113,
+				MasterID: 13814,
+				Title:    "Nevermind",
+				Year:     1991,
+				Artists:  []DiscogsArtist{{Name: "Nirvana"}},
+			},
+		},
+	}
+	if got := response.GetReleases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiscogsArtistReleasesResponse.GetReleases() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,38 @@
+package entities
+
+import "time"
+
+type JobStage string
+
+func (s JobStage) String() string {
+	return string(s)
+}
+
+const (
+	JobQueued   JobStage = "queued"
+	JobFetching JobStage = "fetching"
+	JobMatching JobStage = "matching"
+	JobBuilding JobStage = "building"
+	JobDone     JobStage = "done"
+	JobFailed   JobStage = "failed"
+)
+
+type Job struct {
+	ID         string
+	UserID     string
+	DiscogsURL string
+	Options    PlaylistOptions
+	Stage      JobStage
+	Releases   int
+	Processed  int
+	Matched    int
+	Playlist   *Playlist
+	Err        error
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Finished reports whether the job reached a terminal stage
+func (j *Job) Finished() bool {
+	return j.Stage == JobDone || j.Stage == JobFailed
+}
@@ -0,0 +1,9 @@
+package entities
+
+// MatchOverride pins a Discogs release to a Spotify album, or skips it, in every conversion of a user
+type MatchOverride struct {
+	UserID         string `json:"user_id"`
+	DiscogsID      int    `json:"discogs_id"`
+	SpotifyAlbumID string `json:"spotify_album_id,omitempty"`
+	Skip           bool   `json:"skip,omitempty"`
+}
@@ -0,0 +1,91 @@
+package entities
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// discogsNumbering matches the suffix Discogs adds to tell apart artists with the same name, like "Nirvana (2)"
+var discogsNumbering = regexp.MustCompile(`\s*\(\d+\)$`)
+
+// letters NFKD doesn't decompose into a base letter and a mark
+var letterFolds = strings.NewReplacer(
+	"ø", "o", "Ø", "o",
+	"æ", "ae", "Æ", "ae",
+	"œ", "oe", "Œ", "oe",
+	"ß", "ss",
+	"ł", "l", "Ł", "l",
+	"đ", "d", "Đ", "d",
+	"þ", "th", "Þ", "th",
+)
+
+// apostrophes are dropped instead of split so "Don’t" and "Dont" compare equal
+var apostrophes = strings.NewReplacer("'", "", "’", "", "‘", "", "`", "", "´", "")
+
+// CleanDiscogsName removes the Discogs artist numbering, the "*" marking artist name variations
+// and trailing suffixes in brackets like "(Remastered)", keeping the name readable for searches
+func CleanDiscogsName(name string) string {
+	name = strings.TrimSpace(name)
+	for {
+		trimmed := strings.TrimSpace(strings.TrimSuffix(name, "*"))
+		trimmed = discogsNumbering.ReplaceAllString(trimmed, "")
+		trimmed = trimBracketedSuffix(trimmed)
+		if trimmed == name {
+			return name
+		}
+		name = trimmed
+	}
+}
+
+// NormalizeName reduces a Discogs or Spotify name to lowercase ASCII-like words to compare them:
+// it cleans the Discogs suffixes, folds diacritics ("Björk" is "bjork"), spells "&" as "and",
+// replaces punctuation with spaces and drops a leading "The"
+func NormalizeName(name string) string {
+	name = CleanDiscogsName(name)
+	name = foldDiacritics(name)
+	name = strings.ToLower(name)
+	name = apostrophes.Replace(name)
+	name = strings.ReplaceAll(name, "&", " and ")
+
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// foldDiacritics decomposes the name with NFKD and drops the combining marks
+func foldDiacritics(name string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, name)
+	if err != nil {
+		return letterFolds.Replace(name)
+	}
+	return letterFolds.Replace(folded)
+}
+
+// trimBracketedSuffix drops a trailing "(...)" or "[...]" unless it's the whole name
+func trimBracketedSuffix(name string) string {
+	var opener string
+	switch {
+	case strings.HasSuffix(name, ")"):
+		opener = "("
+	case strings.HasSuffix(name, "]"):
+		opener = "["
+	default:
+		return name
+	}
+
+	start := strings.LastIndex(name, opener)
+	if start <= 0 {
+		return name
+	}
+	return strings.TrimSpace(name[:start])
+}
@@ -0,0 +1,53 @@
+package entities
+
+import "testing"
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "lowercase", in: "Milo Goes To College", want: "milo goes to college"},
+		{name: "diacritics", in: "Björk", want: "bjork"},
+		{name: "letters without decomposition", in: "Mø & Sigur Rós", want: "mo and sigur ros"},
+		{name: "discogs numbering", in: "Nirvana (2)", want: "nirvana"},
+		{name: "discogs name variation", in: "Prince And The Revolution*", want: "prince and the revolution"},
+		{name: "leading the", in: "The Jim Carroll Band", want: "jim carroll band"},
+		{name: "the alone is kept", in: "The", want: "the"},
+		{name: "ampersand", in: "Simon & Garfunkel", want: "simon and garfunkel"},
+		{name: "curly quotes", in: "Don’t Stop", want: "dont stop"},
+		{name: "punctuation", in: "Sgt. Pepper's Lonely Hearts Club Band", want: "sgt peppers lonely hearts club band"},
+		{name: "bracketed suffix", in: "Catholic Boy (Remastered) [Deluxe]", want: "catholic boy"},
+		{name: "leading brackets are kept", in: "(What's The Story) Morning Glory?", want: "whats the story morning glory"},
+		{name: "compatibility characters", in: "Ｒｏｏｍｓ", want: "rooms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeName(tt.in); got != tt.want {
+				t.Errorf("NormalizeName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanDiscogsName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Nirvana (2)", want: "Nirvana"},
+		{in: "Björk*", want: "Björk"},
+		{in: "Hunky Dory (Remastered)", want: "Hunky Dory"},
+		{in: "(What's The Story) Morning Glory?", want: "(What's The Story) Morning Glory?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := CleanDiscogsName(tt.in); got != tt.want {
+				t.Errorf("CleanDiscogsName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
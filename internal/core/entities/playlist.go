@@ -4,4 +4,20 @@ type Playlist struct {
 	SpotifyPlaylist
 	DiscogsReleases int
 	SpotifyAlbums   int
+	SpotifyTracks   int // tracks matched one by one, for compilations and DJ mixes
+	Matches         []ReleaseMatch
+	Synced          bool // an existing playlist was updated instead of creating a new one
+	TracksAdded     int
+	TracksRemoved   int
+}
+
+// Unmatched returns the Discogs releases missing from the playlist
+func (p *Playlist) Unmatched() []ReleaseMatch {
+	unmatched := []ReleaseMatch{}
+	for i := range p.Matches {
+		if !p.Matches[i].Matched() {
+			unmatched = append(unmatched, p.Matches[i])
+		}
+	}
+	return unmatched
 }
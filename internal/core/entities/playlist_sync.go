@@ -0,0 +1,22 @@
+package entities
+
+import "time"
+
+// PlaylistOptions chooses between creating a new playlist or updating an existing one
+type PlaylistOptions struct {
+	Sync          bool   // update the playlist created from the same Discogs URL, if there's one
+	RemoveMissing bool   // on sync, remove the albums of releases no longer on Discogs
+	PlaylistID    string // add the albums to this existing Spotify playlist instead, as if it was synced
+}
+
+// PlaylistSync remembers the playlist created from a Discogs URL, to update it in later conversions
+type PlaylistSync struct {
+	UserID       string    `json:"user_id"`
+	Source       string    `json:"source"`
+	PlaylistID   string    `json:"playlist_id"`
+	PlaylistName string    `json:"playlist_name"`
+	PlaylistURL  string    `json:"playlist_url"`
+	AlbumIDs     []string  `json:"album_ids"`            // Spotify albums added from Discogs so far
+	TrackURIs    []string  `json:"track_uris,omitempty"` // Spotify tracks added one by one, for compilations and DJ mixes
+	UpdatedAt    time.Time `json:"updated_at"`
+}
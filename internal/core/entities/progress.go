@@ -0,0 +1,32 @@
+package entities
+
+type ProgressEventType string
+
+const (
+	ProgressStage           ProgressEventType = "stage"
+	ProgressPageFetched     ProgressEventType = "page_fetched"
+	ProgressReleasesFetched ProgressEventType = "releases_fetched"
+	ProgressAlbumMatched    ProgressEventType = "album_matched"
+	ProgressAlbumUnmatched  ProgressEventType = "album_unmatched"
+	ProgressTracksAdded     ProgressEventType = "tracks_added"
+)
+
+// ProgressEvent describes a step of a Discogs to Spotify conversion:
+//   - stage: Stage is the step the conversion moved to
+//   - page_fetched: Count and Total are the page fetched and the number of pages
+//   - releases_fetched: Count is the releases found so far, reported after every page
+//   - album_matched and album_unmatched: Album is the release searched and Score the match score
+//     of the closest Spotify album
+//   - tracks_added: Count and Total are the tracks added so far and the tracks to add
+type ProgressEvent struct {
+	Type  ProgressEventType
+	Stage JobStage
+	Count int
+	Total int
+	Album *Album
+	Score float64
+	// Processed and Matched are the releases of the job searched and found so far, set on album_matched
+	// and album_unmatched by the jobs so listeners that missed events still show the right counts
+	Processed int
+	Matched   int
+}
@@ -0,0 +1,28 @@
+package entities
+
+type MatchReason string
+
+const (
+	MatchNoResults    MatchReason = "no_results"    // the Spotify search returned no albums, or no tracks
+	MatchLowScore     MatchReason = "low_score"     // no album, or no track, reached the match threshold
+	MatchSkipped      MatchReason = "skipped"       // the user chose to leave the release out
+	MatchSearchFailed MatchReason = "search_failed" // the Spotify search failed, it's tried again next time
+	MatchNoArtist     MatchReason = "no_artist"     // Discogs credits no artist to search the album with
+)
+
+// ReleaseMatch is the outcome of looking up a Discogs release on Spotify
+type ReleaseMatch struct {
+	DiscogsID      int
+	Album          Album
+	SpotifyAlbumID string   // empty when no album matched
+	TrackURIs      []string // Spotify tracks of a release matched track by track, instead of an album
+	Candidates     int
+	Score          float64 // score of the closest candidate
+	Reason         MatchReason
+	Overridden     bool // the match comes from a user override instead of a search
+	Cached         bool // the match comes from a previous conversion
+}
+
+func (m *ReleaseMatch) Matched() bool {
+	return m.SpotifyAlbumID != "" || len(m.TrackURIs) > 0
+}
@@ -5,3 +5,9 @@ type SpotifyPlaylist struct {
 	Name string
 	URL  string
 }
+
+// SpotifyPlaylistItem is a track of a playlist and the album it belongs to
+type SpotifyPlaylistItem struct {
+	TrackURI string
+	AlbumID  string
+}
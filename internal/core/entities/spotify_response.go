@@ -32,6 +32,28 @@ type SpotifyAlbumItem struct {
 	URI                  string `json:"uri"`
 }
 
+type SpotifyTrackSearchResponse struct {
+	Tracks struct {
+		Href  string             `json:"href"`
+		Items []SpotifyTrackItem `json:"items"`
+		Limit int                `json:"limit"`
+		Next  string             `json:"next"`
+		Total int                `json:"total"`
+	} `json:"tracks"`
+}
+
+type SpotifyTrackItem struct {
+	Album struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"album"`
+	Artists    []SpotifyAlbumArtist `json:"artists"`
+	DurationMs int                  `json:"duration_ms"`
+	ID         string               `json:"id"`
+	Name       string               `json:"name"`
+	URI        string               `json:"uri"`
+}
+
 type SpotifyAlbumArtist struct {
 	ExternalURLs SpotifyExternalURLs `json:"external_urls"`
 	Href         string              `json:"href"`
@@ -95,6 +117,19 @@ type SpotifyAlbumsResponse struct {
 	} `json:"albums"`
 }
 
+type SpotifyPlaylistItemsResponse struct {
+	Items []struct {
+		// track is null for items that are no longer available
+		Track *struct {
+			URI   string `json:"uri"`
+			Album struct {
+				ID string `json:"id"`
+			} `json:"album"`
+		} `json:"track"`
+	} `json:"items"`
+	Next string `json:"next"`
+}
+
 type SpotifyExternalURLs struct {
 	Spotify string `json:"spotify"`
 }
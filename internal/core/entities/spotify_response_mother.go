@@ -83,3 +83,12 @@ func MotherSpotifyAlbums() []SpotifyAlbumItem {
 		},
 	}
 }
+
+// MotherSpotifySearchResults are the album search results of the MotherTwoDiscogsAlbums releases by title
+func MotherSpotifySearchResults() map[string][]SpotifyAlbumItem {
+	albums := MotherSpotifyAlbums()
+	return map[string][]SpotifyAlbumItem{
+		"Milo Goes to College": albums[0:2],
+		"Catholic Boy":         albums[2:4],
+	}
+}
@@ -0,0 +1,64 @@
+package entities
+
+import (
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// SyncInterval is how often a scheduled sync runs
+type SyncInterval string
+
+const (
+	SyncHourly SyncInterval = "hourly"
+	SyncDaily  SyncInterval = "daily"
+	SyncWeekly SyncInterval = "weekly"
+)
+
+func (i SyncInterval) String() string {
+	return string(i)
+}
+
+// Duration returns the time between two runs, zero when the interval is unknown
+func (i SyncInterval) Duration() time.Duration {
+	switch i {
+	case SyncHourly:
+		return time.Hour
+	case SyncDaily:
+		return 24 * time.Hour
+	case SyncWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// SyncRun records how a scheduled sync went
+type SyncRun struct {
+	JobID         string    `json:"job_id,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	Stage         JobStage  `json:"stage"`
+	Error         string    `json:"error,omitempty"`
+	TracksAdded   int       `json:"tracks_added"`
+	TracksRemoved int       `json:"tracks_removed"`
+}
+
+// SyncSchedule re-syncs the playlist of a Discogs source periodically without the user,
+// keeping their Spotify token so it can be refreshed between runs
+type SyncSchedule struct {
+	UserID        string              `json:"user_id"`
+	Source        string              `json:"source"`
+	DiscogsURL    string              `json:"discogs_url"`
+	Interval      SyncInterval        `json:"interval"`
+	RemoveMissing bool                `json:"remove_missing"`
+	Token         *oauth2.Token       `json:"token"`
+	Discogs       *DiscogsCredentials `json:"discogs,omitempty"` // linked Discogs account, for private sources
+	NextRunAt     time.Time           `json:"next_run_at"`
+	History       []SyncRun           `json:"history"` // latest runs, oldest first
+}
+
+// Due reports whether the next run time has come
+func (s *SyncSchedule) Due(now time.Time) bool {
+	return !now.Before(s.NextRunAt)
+}
@@ -0,0 +1,73 @@
+package entities
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Track is a track of a Discogs release, searched on Spotify on its own
+type Track struct {
+	Artist   string // empty when neither the track nor the release credit a single artist
+	Title    string
+	Duration int // seconds, zero when unknown
+}
+
+// Tracks returns the tracks of the tracklist, leaving out headings. Index tracks are replaced by the tracks they group.
+// Tracks without their own artists are credited to the release artist, unless it's "Various"
+func (r *DiscogsRelease) Tracks() []Track {
+	releaseArtist := ""
+	if len(r.BasicInformation.Artists) > 0 {
+		releaseArtist = CleanDiscogsName(r.BasicInformation.Artists[0].Name)
+		if isVariousArtists(releaseArtist) {
+			releaseArtist = ""
+		}
+	}
+
+	tracks := []Track{}
+	for _, entry := range r.Tracklist {
+		switch entry.Type {
+		case "", "track":
+			tracks = append(tracks, newTrack(entry, releaseArtist))
+		case "index":
+			// the sub tracks are credited to the index track artist when they have none
+			artist := releaseArtist
+			if len(entry.Artists) > 0 {
+				artist = CleanDiscogsName(entry.Artists[0].Name)
+			}
+			for _, sub := range entry.SubTracks {
+				if sub.Type == "" || sub.Type == "track" {
+					tracks = append(tracks, newTrack(sub, artist))
+				}
+			}
+		}
+	}
+	return tracks
+}
+
+// newTrack builds the track of a tracklist entry, credited to artist when the entry has no artists of its own
+func newTrack(entry DiscogsTrack, artist string) Track {
+	if len(entry.Artists) > 0 {
+		artist = CleanDiscogsName(entry.Artists[0].Name)
+	}
+	return Track{
+		Artist:   artist,
+		Title:    CleanDiscogsName(entry.Title),
+		Duration: parseTrackDuration(entry.Duration),
+	}
+}
+
+// parseTrackDuration parses Discogs durations like "4:35" or "1:02:03", returning 0 when it can't
+func parseTrackDuration(duration string) int {
+	if duration == "" {
+		return 0
+	}
+	seconds := 0
+	for _, part := range strings.Split(duration, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
@@ -0,0 +1,83 @@
+package entities
+
+import (
+	"sort"
+	"strings"
+)
+
+// weights of every signal in the track score, the artist is left out when the track has none
+const (
+	trackArtistWeight       = 0.35
+	trackTitleEditWeight    = 0.30
+	trackTitleOverlapWeight = 0.20
+	trackDurationWeight     = 0.15
+)
+
+// seconds apart at which the duration signal starts dropping and reaches zero,
+// mixes cut tracks short so only big gaps count against a candidate
+const (
+	minDurationDistance = 10
+	maxDurationDistance = 90
+)
+
+type TrackMatch struct {
+	Track SpotifyTrackItem
+	Score float64
+}
+
+// MatchTrack returns the best scored candidate for the track, ok reports whether it reaches the threshold
+func (m *AlbumMatcher) MatchTrack(track Track, candidates []SpotifyTrackItem) (match TrackMatch, ok bool) {
+	matches := make([]TrackMatch, len(candidates))
+	for i := range candidates {
+		matches[i] = TrackMatch{Track: candidates[i], Score: m.ScoreTrack(track, &candidates[i])}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if len(matches) == 0 {
+		return TrackMatch{}, false
+	}
+	return matches[0], matches[0].Score >= m.threshold
+}
+
+// ScoreTrack returns how likely the candidate is the track, from 0 to 1
+func (m *AlbumMatcher) ScoreTrack(track Track, candidate *SpotifyTrackItem) float64 {
+	inputTitle := NormalizeName(track.Title)
+	candidateTitle := NormalizeName(trimTrackVersion(track.Title, candidate.Name))
+
+	var total, weights float64
+	add := func(score, weight float64) {
+		total += score * weight
+		weights += weight
+	}
+
+	if track.Artist != "" {
+		artistScore := 0.0
+		inputArtist := NormalizeName(track.Artist)
+		for _, artist := range candidate.Artists {
+			artistScore = max(artistScore, editSimilarity(inputArtist, NormalizeName(artist.Name)))
+		}
+		add(artistScore, trackArtistWeight)
+	}
+	add(editSimilarity(inputTitle, candidateTitle), trackTitleEditWeight)
+	add(tokenOverlap(inputTitle, candidateTitle), trackTitleOverlapWeight)
+
+	if track.Duration > 0 && candidate.DurationMs > 0 {
+		distance := min(max(abs(track.Duration-candidate.DurationMs/1000)-minDurationDistance, 0), maxDurationDistance)
+		add(1-float64(distance)/maxDurationDistance, trackDurationWeight)
+	}
+
+	return total / weights
+}
+
+// trimTrackVersion drops the version Spotify appends to track names, like "Xtal - 2008 Remaster",
+// unless the Discogs title has one too
+func trimTrackVersion(title, name string) string {
+	if strings.Contains(title, " - ") {
+		return name
+	}
+	if i := strings.Index(name, " - "); i > 0 {
+		return name[:i]
+	}
+	return name
+}
@@ -0,0 +1,153 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAlbumMatcher_MatchTrack(t *testing.T) {
+	candidate := func(uri, artist, name string, durationMs int) SpotifyTrackItem {
+		return SpotifyTrackItem{
+			URI:        uri,
+			Name:       name,
+			DurationMs: durationMs,
+			Artists:    []SpotifyAlbumArtist{{Name: artist}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		track      Track
+		candidates []SpotifyTrackItem
+		wantURI    string
+		wantOK     bool
+	}{
+		{
+			name:  "exact match",
+			track: Track{Artist: "Aphex Twin", Title: "Xtal", Duration: 294},
+			candidates: []SpotifyTrackItem{
+				candidate("1", "Aphex Twin", "Xtal", 294000),
+			},
+			wantURI: "1",
+			wantOK:  true,
+		},
+		{
+			name:  "spotify version suffix",
+			track: Track{Artist: "Orbital", Title: "Chime"},
+			candidates: []SpotifyTrackItem{
+				candidate("1", "Orbital", "Chime - 2002 Remaster", 0),
+			},
+			wantURI: "1",
+			wantOK:  true,
+		},
+		{
+			name:  "duration breaks ties",
+			track: Track{Artist: "Orbital", Title: "Chime", Duration: 310},
+			candidates: []SpotifyTrackItem{
+				candidate("1", "Orbital", "Chime", 744000),
+				candidate("2", "Orbital", "Chime", 305000),
+			},
+			wantURI: "2",
+			wantOK:  true,
+		},
+		{
+			name:  "same title from another artist",
+			track: Track{Artist: "Orbital", Title: "Halcyon"},
+			candidates: []SpotifyTrackItem{
+				candidate("1", "Ellie Goulding", "Halcyon", 0),
+			},
+			wantURI: "1",
+			wantOK:  false,
+		},
+		{
+			name:  "track without artist",
+			track: Track{Title: "Polygon Window"},
+			candidates: []SpotifyTrackItem{
+				candidate("1", "Polygon Window", "Polygon Window", 0),
+			},
+			wantURI: "1",
+			wantOK:  true,
+		},
+		{
+			name:   "no candidates",
+			track:  Track{Artist: "Aphex Twin", Title: "Xtal"},
+			wantOK: false,
+		},
+	}
+
+	matcher := NewAlbumMatcher(DefaultMatchThreshold)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, ok := matcher.MatchTrack(tt.track, tt.candidates)
+			if ok != tt.wantOK {
+				t.Errorf("got ok %v with score %f, want %v", ok, match.Score, tt.wantOK)
+			}
+			if match.Track.URI != tt.wantURI {
+				t.Errorf("got track %s, want %s", match.Track.URI, tt.wantURI)
+			}
+		})
+	}
+}
+
+func TestDiscogsRelease_MatchByTrack(t *testing.T) {
+	tests := []struct {
+		name    string
+		release DiscogsBasicInformation
+		want    bool
+	}{
+		{
+			name:    "album",
+			release: DiscogsBasicInformation{Artists: []DiscogsArtist{{Name: "Descendents"}}},
+			want:    false,
+		},
+		{
+			name:    "various artists compilation",
+			release: DiscogsBasicInformation{Artists: []DiscogsArtist{{Name: "Various"}}},
+			want:    true,
+		},
+		{
+			name: "dj mix",
+			release: DiscogsBasicInformation{
+				Artists: []DiscogsArtist{{Name: "Laurent Garnier"}},
+				Formats: []DiscogsFormat{{Name: "CD", Descriptions: []string{"Compilation", "Mixed"}}},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := DiscogsRelease{BasicInformation: tt.release}
+			if got := release.MatchByTrack(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscogsRelease_Tracks(t *testing.T) {
+	release := DiscogsRelease{
+		BasicInformation: DiscogsBasicInformation{Artists: []DiscogsArtist{{Name: "Various"}}},
+		Tracklist: []DiscogsTrack{
+			{Type: "heading", Title: "Side A"},
+			{Position: "A1", Type: "track", Title: "Polygon Window", Duration: "5:21", Artists: []DiscogsArtist{{Name: "The Dice Man"}}},
+			{Position: "A2", Type: "track", Title: "Spiritual High (Remix)", Duration: "1:02:03", Artists: []DiscogsArtist{{Name: "Musicology (2)"}}},
+			{Position: "A3", Type: "track", Title: "Untitled", Duration: "?"},
+			{Position: "B1", Type: "index", Title: "Suite", Artists: []DiscogsArtist{{Name: "Orbital"}}, SubTracks: []DiscogsTrack{
+				{Position: "B1a", Type: "track", Title: "Part One", Duration: "3:00"},
+				{Position: "B1b", Type: "track", Title: "Part Two", Artists: []DiscogsArtist{{Name: "Aphex Twin"}}},
+			}},
+		},
+	}
+
+	want := []Track{
+		{Artist: "The Dice Man", Title: "Polygon Window", Duration: 321},
+		{Artist: "Musicology", Title: "Spiritual High", Duration: 3723},
+		{Title: "Untitled"},
+		{Artist: "Orbital", Title: "Part One", Duration: 180},
+		{Artist: "Aphex Twin", Title: "Part Two"},
+	}
+	if got := release.Tracks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 
 	"golang.org/x/oauth2"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
 )
 
 // ContextPort defines the interface for retrieving data from a context
 type ContextPort interface {
 	GetToken(ctx context.Context) (*oauth2.Token, error)
+	SetToken(ctx context.Context, token *oauth2.Token) error
 	GetUserID(ctx context.Context) (string, error)
 	SetUserID(ctx context.Context, userID string) error
+	// GetDiscogsCredentials returns the Discogs account linked by the user, nil when there's none
+	GetDiscogsCredentials(ctx context.Context) (*entities.DiscogsCredentials, error)
 }
@@ -0,0 +1,18 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+)
+
+// DiscogsAuthPort links Discogs accounts with the OAuth 1.0a flow and checks the credentials of linked accounts
+type DiscogsAuthPort interface {
+	// RequestToken starts a login, the user has to authorize the returned token on AuthorizeURL
+	RequestToken(ctx context.Context, callbackURL string) (token, secret string, err error)
+	AuthorizeURL(token string) string
+	// AccessToken exchanges the authorized request token for the credentials of the user
+	AccessToken(ctx context.Context, token, secret, verifier string) (*entities.DiscogsCredentials, error)
+	// Identity returns the username the credentials belong to, errors.ErrUnauthorized when Discogs rejects them
+	Identity(ctx context.Context, credentials *entities.DiscogsCredentials) (string, error)
+}
@@ -7,7 +7,48 @@ import (
 )
 
 type DiscogsPort interface {
-	GetCollectionReleases(ctx context.Context, username string) ([]entities.DiscogsRelease, error)
+	GetCollectionReleases(ctx context.Context, username string, folderID int) ([]entities.DiscogsRelease, error)
+	GetCollectionFolders(ctx context.Context, username string) ([]entities.DiscogsFolder, error)
 	GetWantlistReleases(ctx context.Context, username string) ([]entities.DiscogsRelease, error)
 	GetListReleases(ctx context.Context, listID string) ([]entities.DiscogsRelease, error)
+	GetArtistReleases(ctx context.Context, artistID string) ([]entities.DiscogsRelease, error)
+	GetLabelReleases(ctx context.Context, labelID string) ([]entities.DiscogsRelease, error)
+	GetRelease(ctx context.Context, releaseID string) (*entities.DiscogsReleaseDetail, error)
+	GetMaster(ctx context.Context, masterID string) (*entities.DiscogsMaster, error)
+}
+
+// PageFetchedFunc is notified by DiscogsPort implementations after each page they fetch
+type PageFetchedFunc func(page, pages int)
+
+type pageFetchedKey struct{}
+
+// WithPageFetched attaches a page listener to ctx, so callers can follow paginated requests
+func WithPageFetched(ctx context.Context, fn PageFetchedFunc) context.Context {
+	return context.WithValue(ctx, pageFetchedKey{}, fn)
+}
+
+// NotifyPageFetched calls the page listener attached to ctx, if any
+func NotifyPageFetched(ctx context.Context, page, pages int) {
+	if fn, ok := ctx.Value(pageFetchedKey{}).(PageFetchedFunc); ok && fn != nil {
+		fn(page, pages)
+	}
+}
+
+// PageReleasesFunc receives the releases of each page DiscogsPort implementations fetch, as soon as it's in.
+// Pages fetched at once may come out of order, so they come with their number.
+// The releases belong to the listener
+type PageReleasesFunc func(page int, releases []entities.DiscogsRelease)
+
+type pageReleasesKey struct{}
+
+// WithPageReleases attaches a page releases listener to ctx, so callers can start on a source before its last page
+func WithPageReleases(ctx context.Context, fn PageReleasesFunc) context.Context {
+	return context.WithValue(ctx, pageReleasesKey{}, fn)
+}
+
+// NotifyPageReleases calls the page releases listener attached to ctx, if any
+func NotifyPageReleases(ctx context.Context, page int, releases []entities.DiscogsRelease) {
+	if fn, ok := ctx.Value(pageReleasesKey{}).(PageReleasesFunc); ok && fn != nil {
+		fn(page, releases)
+	}
 }
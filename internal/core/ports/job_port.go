@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+)
+
+type JobPort interface {
+	Save(ctx context.Context, job *entities.Job) error
+	Get(ctx context.Context, id string) (*entities.Job, error)
+}
@@ -0,0 +1,14 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+)
+
+// MatchCachePort keeps the matches of Discogs releases for a while, Get returns
+// an errors.ErrNotFound error for keys missing or expired
+type MatchCachePort interface {
+	Get(ctx context.Context, key string) (*entities.CachedMatch, error)
+	Set(ctx context.Context, key string, match *entities.CachedMatch) error
+}
@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+)
+
+type OverridePort interface {
+	List(ctx context.Context, userID string) ([]entities.MatchOverride, error)
+	Save(ctx context.Context, override *entities.MatchOverride) error
+	Delete(ctx context.Context, userID string, discogsID int) error
+}
@@ -0,0 +1,14 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+)
+
+// PlaylistSyncPort keeps the playlist of every Discogs source by user, Get returns
+// an errors.ErrNotFound error when the source has no playlist yet
+type PlaylistSyncPort interface {
+	Get(ctx context.Context, userID, source string) (*entities.PlaylistSync, error)
+	Save(ctx context.Context, sync *entities.PlaylistSync) error
+}
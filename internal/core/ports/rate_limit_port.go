@@ -0,0 +1,8 @@
+package ports
+
+import "context"
+
+// RateLimitPort paces the requests to an API, Wait blocks until the next one can be sent or ctx is done
+type RateLimitPort interface {
+	Wait(ctx context.Context) error
+}
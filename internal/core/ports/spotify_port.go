@@ -8,8 +8,13 @@ import (
 
 type SpotifyPort interface {
 	SearchAlbum(ctx context.Context, album entities.Album) ([]entities.SpotifyAlbumItem, error)
+	SearchTrack(ctx context.Context, track entities.Track) ([]entities.SpotifyTrackItem, error)
 	GetUserID(ctx context.Context) (string, error)
+	// GetUserMarket returns the country of the user, albums available to them depend on it
+	GetUserMarket(ctx context.Context) (string, error)
 	CreatePlaylist(ctx context.Context, name string, description string) (entities.SpotifyPlaylist, error)
 	AddToPlaylist(ctx context.Context, playlistID string, uris []string) error
 	GetAlbumsTrackUris(ctx context.Context, albums []string) ([]string, error)
+	GetPlaylistItems(ctx context.Context, playlistID string) ([]entities.SpotifyPlaylistItem, error)
+	RemoveFromPlaylist(ctx context.Context, playlistID string, uris []string) error
 }
@@ -0,0 +1,17 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+)
+
+// SyncSchedulePort keeps the scheduled syncs by user and Discogs source,
+// Get and Delete return an errors.ErrNotFound error when the source isn't scheduled
+type SyncSchedulePort interface {
+	List(ctx context.Context) ([]entities.SyncSchedule, error)
+	ListByUser(ctx context.Context, userID string) ([]entities.SyncSchedule, error)
+	Get(ctx context.Context, userID, source string) (*entities.SyncSchedule, error)
+	Save(ctx context.Context, schedule *entities.SyncSchedule) error
+	Delete(ctx context.Context, userID, source string) error
+}
@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenPort exchanges the refresh token of an expired token for a new access token
+type TokenPort interface {
+	RefreshToken(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error)
+}
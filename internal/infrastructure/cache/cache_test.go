@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+)
+
+func TestMatchCache(t *testing.T) {
+	ttl := time.Hour
+	caches := map[string]func(t *testing.T, now *time.Time) ports.MatchCachePort{
+		"in memory": func(_ *testing.T, now *time.Time) ports.MatchCachePort {
+			c := NewInMemoryCache(ttl)
+			c.now = func() time.Time { return *now }
+			return c
+		},
+		"disk": func(t *testing.T, now *time.Time) ports.MatchCachePort {
+			c, err := NewDiskCache(t.TempDir(), ttl)
+			if err != nil {
+				t.Fatalf("did not expect error, got %v", err)
+			}
+			c.now = func() time.Time { return *now }
+			return c
+		},
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+			c := newCache(t, &now)
+			match := &entities.CachedMatch{SpotifyAlbumID: entities.SpotifyAlbumIDRooms, Candidates: 4, Score: 0.9}
+
+			if _, err := c.Get(ctx, "master-1"); !errorWrapper.Is(err, errorWrapper.ErrNotFound) {
+				t.Errorf("got %v, want %v", err, errorWrapper.ErrNotFound)
+			}
+			if err := c.Set(ctx, "master-1", match); err != nil {
+				t.Fatalf("did not expect error, got %v", err)
+			}
+
+			got, err := c.Get(ctx, "master-1")
+			if err != nil {
+				t.Fatalf("did not expect error, got %v", err)
+			}
+			if !reflect.DeepEqual(got, match) {
+				t.Errorf("got %v, want %v", got, match)
+			}
+
+			now = now.Add(ttl)
+			if _, err := c.Get(ctx, "master-1"); !errorWrapper.Is(err, errorWrapper.ErrNotFound) {
+				t.Errorf("got %v after the ttl, want %v", err, errorWrapper.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestInMemoryCachePrune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewInMemoryCache(time.Hour)
+	c.now = func() time.Time { return now }
+	match := &entities.CachedMatch{SpotifyAlbumID: entities.SpotifyAlbumIDRooms}
+
+	for _, key := range []string{"ES-master-1", "ES-master-2"} {
+		if err := c.Set(ctx, key, match); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+	}
+	now = now.Add(time.Minute)
+	if err := c.Set(ctx, "ES-master-3", match); err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if len(c.entries) != 3 {
+		t.Errorf("got %d entries before the ttl, want 3", len(c.entries))
+	}
+
+	now = now.Add(time.Hour)
+	if err := c.Set(ctx, "ES-master-4", match); err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if len(c.entries) != 1 {
+		t.Errorf("got %d entries after the ttl, want 1", len(c.entries))
+	}
+}
+
+func TestDiskCachePrune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	c.now = func() time.Time { return now }
+	match := &entities.CachedMatch{SpotifyAlbumID: entities.SpotifyAlbumIDRooms}
+
+	for _, key := range []string{"ES-master-1", "ES-master-2"} {
+		if err := c.Set(ctx, key, match); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+	}
+	now = now.Add(time.Minute)
+	if err := c.Set(ctx, "ES-master-3", match); err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 3 {
+		t.Errorf("got %d files before the ttl, want 3", len(files))
+	}
+
+	now = now.Add(time.Hour)
+	if err := c.Set(ctx, "ES-master-4", match); err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("got %d files after the ttl, want 1", len(files))
+	}
+}
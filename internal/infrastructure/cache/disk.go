@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/utils/file"
+)
+
+// unsafeKeyChars are replaced in keys to use them as file names
+var unsafeKeyChars = regexp.MustCompile(`[^0-9A-Za-z_-]`)
+
+type diskEntry struct {
+	Match     entities.CachedMatch `json:"match"`
+	ExpiresAt time.Time            `json:"expires_at"`
+}
+
+// DiskCache keeps every entry in its own JSON file inside dir,
+// so saving a match doesn't rewrite the whole cache
+type DiskCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+	// nextPrune is when the expired files are removed next, entries that are never read again expire there
+	mu        sync.Mutex
+	nextPrune time.Time
+}
+
+func NewDiskCache(dir string, ttl time.Duration) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "error creating match cache dir")
+	}
+	return &DiskCache{dir: dir, ttl: ttl, now: time.Now}, nil
+}
+
+func (c *DiskCache) Get(_ context.Context, key string) (*entities.CachedMatch, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errorWrapper.Wrap(errorWrapper.ErrNotFound, "cached match "+key)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading cached match")
+	}
+
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, errors.Wrap(err, "error decoding cached match")
+	}
+	if !c.now().Before(entry.ExpiresAt) {
+		_ = os.Remove(c.path(key))
+		return nil, errorWrapper.Wrap(errorWrapper.ErrNotFound, "cached match "+key)
+	}
+	return &entry.Match, nil
+}
+
+func (c *DiskCache) Set(_ context.Context, key string, match *entities.CachedMatch) error {
+	data, err := json.Marshal(diskEntry{Match: *match, ExpiresAt: c.now().Add(c.ttl)})
+	if err != nil {
+		return errors.Wrap(err, "error encoding cached match")
+	}
+
+	if err := file.WriteAtomic(c.path(key), data); err != nil {
+		return errors.Wrap(err, "error writing cached match")
+	}
+	c.pruneIfDue()
+	return nil
+}
+
+// pruneIfDue removes the expired files once every ttl, a file that can't be read or removed is left for the next time
+func (c *DiskCache) pruneIfDue() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Before(c.nextPrune) {
+		return
+	}
+	c.nextPrune = now.Add(c.ttl)
+
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(c.dir, f.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var entry diskEntry
+		if json.Unmarshal(data, &entry) == nil && !now.Before(entry.ExpiresAt) {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, unsafeKeyChars.ReplaceAllString(key, "_")+".json")
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+)
+
+type memoryEntry struct {
+	match     entities.CachedMatch
+	expiresAt time.Time
+}
+
+type InMemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+	ttl     time.Duration
+	now     func() time.Time
+	// nextPrune is when the expired entries are dropped next, so writes don't walk the whole map every time
+	nextPrune time.Time
+}
+
+func NewInMemoryCache(ttl time.Duration) *InMemoryCache {
+	return &InMemoryCache{
+		entries: make(map[string]memoryEntry),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+func (c *InMemoryCache) Get(_ context.Context, key string) (*entities.CachedMatch, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, exists := c.entries[key]
+	if !exists || !c.now().Before(entry.expiresAt) {
+		return nil, errorWrapper.Wrap(errorWrapper.ErrNotFound, "cached match "+key)
+	}
+	return &entry.match, nil
+}
+
+func (c *InMemoryCache) Set(_ context.Context, key string, match *entities.CachedMatch) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.entries[key] = memoryEntry{match: *match, expiresAt: now.Add(c.ttl)}
+	if !now.Before(c.nextPrune) {
+		c.prune(now)
+		c.nextPrune = now.Add(c.ttl)
+	}
+	return nil
+}
+
+// prune drops the expired entries, must be called with the lock held
+func (c *InMemoryCache) prune(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/joho/godotenv"
 
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
 	"github.com/martiriera/discogs-spotify/internal/utils/env"
 )
 
@@ -17,14 +18,24 @@ const (
 	defaultServerReadTimeout  = 10   // 10 seconds
 	defaultServerWriteTimeout = 120  // 120 seconds (2 minutes)
 	defaultServerIdleTimeout  = 120  // 120 seconds (2 minutes)
+	defaultJobWorkers         = 4
+	defaultMatchCacheTTL      = 30 * 24 * time.Hour
+	defaultSchedulerCheck     = time.Minute
+	defaultMatchWorkers       = 4
+	defaultDiscogsPageWorkers = 3
 )
 
 type Config struct {
 	Environment string
 	Server      ServerConfig
 	Spotify     SpotifyConfig
+	Discogs     DiscogsConfig
 	Session     SessionConfig
 	HTTP        HTTPConfig
+	Jobs        JobsConfig
+	Matching    MatchingConfig
+	Storage     StorageConfig
+	Scheduler   SchedulerConfig
 }
 
 type ServerConfig struct {
@@ -40,6 +51,20 @@ type SpotifyConfig struct {
 	RedirectURI  string
 	ProxyURL     string // Auth proxy URL for development
 	UseProxy     bool
+	UsePKCE      bool // PKCE flow, used when there's no client secret
+}
+
+// DiscogsConfig holds the application registered on Discogs, needed for users to link their account
+// with a Discogs login, personal access tokens can be linked without it
+type DiscogsConfig struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	CallbackURL    string
+}
+
+// OAuthEnabled reports whether the whole application is configured
+func (c DiscogsConfig) OAuthEnabled() bool {
+	return c.ConsumerKey != "" && c.ConsumerSecret != "" && c.CallbackURL != ""
 }
 
 type SessionConfig struct {
@@ -48,10 +73,34 @@ type SessionConfig struct {
 }
 
 type HTTPConfig struct {
-	DiscogsTimeout time.Duration
-	SpotifyTimeout time.Duration
-	RetryAttempts  int
-	RetryDelay     time.Duration
+	DiscogsTimeout     time.Duration
+	SpotifyTimeout     time.Duration
+	RetryAttempts      int
+	RetryDelay         time.Duration
+	DiscogsPageWorkers int // Discogs pages fetched at once after the first one tells how many there are
+}
+
+type JobsConfig struct {
+	Workers int
+}
+
+type StorageConfig struct {
+	OverridesFile string // JSON file keeping the match overrides, kept in memory when empty
+	MatchCacheDir string // directory keeping the cached matches, kept in memory when empty
+	SyncsFile     string // JSON file keeping the playlist of every Discogs source, kept in memory when empty
+	SchedulesFile string // JSON file keeping the scheduled syncs and their Spotify tokens, kept in memory when empty
+	EncryptionKey string // key encrypting the user credentials kept in files, kept in plain JSON when empty
+}
+
+type SchedulerConfig struct {
+	CheckInterval time.Duration // how often the scheduler looks for due syncs
+}
+
+type MatchingConfig struct {
+	Threshold float64 // minimum score, from 0 to 1, for a Spotify album to match a Discogs release
+	CacheTTL  time.Duration
+	Barcodes  bool // search Spotify by the barcodes of every release first, one more Discogs request per release
+	Workers   int  // Spotify searches running at once in every conversion
 }
 
 func LoadConfig() (*Config, error) {
@@ -63,10 +112,14 @@ func LoadConfig() (*Config, error) {
 	}
 
 	spotifyClientID := env.GetRequired("SPOTIFY_CLIENT_ID")
-	spotifyClientSecret := env.GetRequired("SPOTIFY_CLIENT_SECRET")
+	spotifyClientSecret := env.GetWithDefault("SPOTIFY_CLIENT_SECRET", "")
+	spotifyUsePKCE := env.GetAsBoolWithDefault("SPOTIFY_USE_PKCE", spotifyClientSecret == "")
 	spotifyRedirectURI := env.GetRequired("SPOTIFY_REDIRECT_URI")
 	spotifyProxyURL := env.GetWithDefault("SPOTIFY_PROXY_URL", "")
 	sessionKey := env.GetRequired("SESSION_KEY")
+	discogsConsumerKey := env.GetWithDefault("DISCOGS_CONSUMER_KEY", "")
+	discogsConsumerSecret := env.GetWithDefault("DISCOGS_CONSUMER_SECRET", "")
+	discogsCallbackURL := env.GetWithDefault("DISCOGS_CALLBACK_URL", "")
 
 	port := env.GetWithDefault("PORT", "8080")
 	environment := env.GetWithDefault("ENV", "development")
@@ -76,11 +129,31 @@ func LoadConfig() (*Config, error) {
 	spotifyTimeout := env.GetAsDurationWithDefault("SPOTIFY_TIMEOUT", defaultSpotifyTimeout*time.Second)
 	retryAttempts := env.GetAsIntWithDefault("HTTP_RETRY_ATTEMPTS", 3)
 	retryDelay := env.GetAsDurationWithDefault("HTTP_RETRY_DELAY", 1*time.Second)
+	discogsPageWorkers := env.GetAsIntWithDefault("DISCOGS_PAGE_WORKERS", defaultDiscogsPageWorkers)
 
 	readTimeout := env.GetAsDurationWithDefault("SERVER_READ_TIMEOUT", defaultServerReadTimeout*time.Second)
 	writeTimeout := env.GetAsDurationWithDefault("SERVER_WRITE_TIMEOUT", defaultServerWriteTimeout*time.Second)
 	idleTimeout := env.GetAsDurationWithDefault("SERVER_IDLE_TIMEOUT", defaultServerIdleTimeout*time.Second)
 
+	jobWorkers := env.GetAsIntWithDefault("JOB_WORKERS", defaultJobWorkers)
+	if jobWorkers < 1 {
+		// jobs queued without workers would never run
+		return nil, fmt.Errorf("JOB_WORKERS must be at least 1, got %d", jobWorkers)
+	}
+	matchThreshold := env.GetAsFloatWithDefault("MATCH_THRESHOLD", entities.DefaultMatchThreshold)
+	matchCacheTTL := env.GetAsDurationWithDefault("MATCH_CACHE_TTL", defaultMatchCacheTTL)
+	matchBarcodes := env.GetAsBoolWithDefault("MATCH_BARCODES", false)
+	matchWorkers := env.GetAsIntWithDefault("MATCH_WORKERS", defaultMatchWorkers)
+	overridesFile := env.GetWithDefault("OVERRIDES_FILE", "")
+	matchCacheDir := env.GetWithDefault("MATCH_CACHE_DIR", "")
+	syncsFile := env.GetWithDefault("SYNCS_FILE", "")
+	schedulesFile := env.GetWithDefault("SCHEDULES_FILE", "")
+	storageEncryptionKey := env.GetWithDefault("STORAGE_ENCRYPTION_KEY", "")
+	schedulerCheckInterval := env.GetAsDurationWithDefault("SCHEDULER_CHECK_INTERVAL", defaultSchedulerCheck)
+	if schedulerCheckInterval <= 0 {
+		return nil, fmt.Errorf("SCHEDULER_CHECK_INTERVAL must be positive, got %v", schedulerCheckInterval)
+	}
+
 	return &Config{
 		Environment: environment,
 		Server: ServerConfig{
@@ -95,16 +168,42 @@ func LoadConfig() (*Config, error) {
 			RedirectURI:  spotifyRedirectURI,
 			ProxyURL:     spotifyProxyURL,
 			UseProxy:     environment == "development" && spotifyProxyURL != "",
+			UsePKCE:      spotifyUsePKCE,
+		},
+		Discogs: DiscogsConfig{
+			ConsumerKey:    discogsConsumerKey,
+			ConsumerSecret: discogsConsumerSecret,
+			CallbackURL:    discogsCallbackURL,
 		},
 		Session: SessionConfig{
 			Key:       sessionKey,
 			MaxAgeSec: sessionMaxAge,
 		},
 		HTTP: HTTPConfig{
-			DiscogsTimeout: discogsTimeout,
-			SpotifyTimeout: spotifyTimeout,
-			RetryAttempts:  retryAttempts,
-			RetryDelay:     retryDelay,
+			DiscogsTimeout:     discogsTimeout,
+			SpotifyTimeout:     spotifyTimeout,
+			RetryAttempts:      retryAttempts,
+			RetryDelay:         retryDelay,
+			DiscogsPageWorkers: discogsPageWorkers,
+		},
+		Jobs: JobsConfig{
+			Workers: jobWorkers,
+		},
+		Matching: MatchingConfig{
+			Threshold: matchThreshold,
+			CacheTTL:  matchCacheTTL,
+			Barcodes:  matchBarcodes,
+			Workers:   matchWorkers,
+		},
+		Storage: StorageConfig{
+			OverridesFile: overridesFile,
+			MatchCacheDir: matchCacheDir,
+			SyncsFile:     syncsFile,
+			SchedulesFile: schedulesFile,
+			EncryptionKey: storageEncryptionKey,
+		},
+		Scheduler: SchedulerConfig{
+			CheckInterval: schedulerCheckInterval,
 		},
 	}, nil
 }
@@ -1,43 +1,71 @@
 package container
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/martiriera/discogs-spotify/internal/adapters/client"
 	"github.com/martiriera/discogs-spotify/internal/adapters/discogs"
 	"github.com/martiriera/discogs-spotify/internal/adapters/spotify"
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
 	"github.com/martiriera/discogs-spotify/internal/core/ports"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/cache"
 	"github.com/martiriera/discogs-spotify/internal/infrastructure/config"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/jobs"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/overrides"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/schedules"
 	"github.com/martiriera/discogs-spotify/internal/infrastructure/server"
 	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/syncs"
 	"github.com/martiriera/discogs-spotify/internal/usecases"
+	"github.com/martiriera/discogs-spotify/internal/utils/secret"
 )
 
 type Container struct {
-	Config             *config.Config
-	Server             *server.Server
-	HTTPServer         *http.Server
-	Session            ports.SessionPort
-	DiscogsService     ports.DiscogsPort
-	SpotifyService     ports.SpotifyPort
-	PlaylistController *usecases.Controller
-	OAuthController    *usecases.SpotifyAuthenticate
-	UserController     *usecases.GetSpotifyUser
-	HTTPClientFactory  *client.HTTPClientFactory
+	Config              *config.Config
+	Server              *server.Server
+	HTTPServer          *http.Server
+	Session             ports.SessionPort
+	ContextProvider     ports.ContextPort
+	DiscogsService      ports.DiscogsPort
+	SpotifyService      ports.SpotifyPort
+	PlaylistController  *usecases.Controller
+	PlaylistJobs        *usecases.PlaylistJobs
+	JobStore            ports.JobPort
+	OverrideStore       ports.OverridePort
+	MatchCache          ports.MatchCachePort
+	SyncStore           ports.PlaylistSyncPort
+	ScheduleStore       ports.SyncSchedulePort
+	SyncScheduler       *usecases.SyncScheduler
+	OAuthController     *usecases.SpotifyAuthenticate
+	DiscogsAuth         *usecases.DiscogsAuthenticate
+	UserController      *usecases.GetSpotifyUser
+	FoldersController   *usecases.GetDiscogsFolders
+	OverridesController *usecases.MatchOverrides
+	HTTPClientFactory   *client.HTTPClientFactory
 }
 
-func NewContainer(cfg *config.Config) *Container {
+// NewContainer wires the application, failing when a store saved on disk can't be loaded
+func NewContainer(cfg *config.Config) (*Container, error) {
 	c := &Container{
 		Config:            cfg,
 		HTTPClientFactory: client.NewHTTPClientFactory(),
 	}
 
 	c.initSession()
+	if err := c.initStores(); err != nil {
+		return nil, err
+	}
+	c.initAuth()
 	c.initServices()
 	c.initControllers()
 	c.initServer()
 
-	return c
+	c.SyncScheduler.Start()
+
+	return c, nil
 }
 
 func (c *Container) initSession() {
@@ -46,6 +74,99 @@ func (c *Container) initSession() {
 	c.Session = s
 }
 
+func (c *Container) initStores() error {
+	c.JobStore = jobs.NewInMemoryStore()
+	if err := c.initMatchCache(); err != nil {
+		return err
+	}
+	if err := c.initSyncStore(); err != nil {
+		return err
+	}
+	if err := c.initScheduleStore(); err != nil {
+		return err
+	}
+
+	if c.Config.Storage.OverridesFile == "" {
+		c.OverrideStore = overrides.NewInMemoryStore()
+		return nil
+	}
+	overrideStore, err := overrides.NewFileStore(c.Config.Storage.OverridesFile)
+	if err != nil {
+		return fmt.Errorf("failed to load match overrides: %w", err)
+	}
+	c.OverrideStore = overrideStore
+	return nil
+}
+
+func (c *Container) initSyncStore() error {
+	if c.Config.Storage.SyncsFile == "" {
+		c.SyncStore = syncs.NewInMemoryStore()
+		return nil
+	}
+	syncStore, err := syncs.NewFileStore(c.Config.Storage.SyncsFile)
+	if err != nil {
+		return fmt.Errorf("failed to load playlist syncs: %w", err)
+	}
+	c.SyncStore = syncStore
+	return nil
+}
+
+func (c *Container) initScheduleStore() error {
+	if c.Config.Storage.SchedulesFile == "" {
+		c.ScheduleStore = schedules.NewInMemoryStore()
+		return nil
+	}
+	var box *secret.Box
+	if c.Config.Storage.EncryptionKey == "" {
+		log.Println("STORAGE_ENCRYPTION_KEY is not set, the sync schedules keep the user credentials in plain JSON")
+	} else {
+		var err error
+		if box, err = secret.NewBox(c.Config.Storage.EncryptionKey); err != nil {
+			return fmt.Errorf("failed to set up the storage encryption: %w", err)
+		}
+	}
+	scheduleStore, err := schedules.NewFileStore(c.Config.Storage.SchedulesFile, box)
+	if err != nil {
+		return fmt.Errorf("failed to load sync schedules: %w", err)
+	}
+	c.ScheduleStore = scheduleStore
+	return nil
+}
+
+func (c *Container) initMatchCache() error {
+	if c.Config.Storage.MatchCacheDir == "" {
+		c.MatchCache = cache.NewInMemoryCache(c.Config.Matching.CacheTTL)
+		return nil
+	}
+	matchCache, err := cache.NewDiskCache(c.Config.Storage.MatchCacheDir, c.Config.Matching.CacheTTL)
+	if err != nil {
+		return fmt.Errorf("failed to open match cache: %w", err)
+	}
+	c.MatchCache = matchCache
+	return nil
+}
+
+func (c *Container) initAuth() {
+	redirectURI := c.Config.Spotify.RedirectURI
+	if c.Config.Spotify.UseProxy && c.Config.Spotify.ProxyURL != "" {
+		redirectURI = c.Config.Spotify.ProxyURL + "/auth/proxy/callback/spotify"
+	}
+
+	if c.Config.Spotify.UsePKCE {
+		c.OAuthController = usecases.NewSpotifyAuthenticatePKCE(
+			c.Config.Spotify.ClientID,
+			redirectURI,
+		)
+		return
+	}
+
+	c.OAuthController = usecases.NewSpotifyAuthenticate(
+		c.Config.Spotify.ClientID,
+		c.Config.Spotify.ClientSecret,
+		redirectURI,
+	)
+}
+
 func (c *Container) initServices() {
 	discogsClient := c.HTTPClientFactory.CreateDiscogsClient(
 		c.Config.HTTP.DiscogsTimeout,
@@ -59,37 +180,73 @@ func (c *Container) initServices() {
 		c.Config.HTTP.RetryDelay,
 	)
 
-	contextProvider := server.NewGinContextProvider()
+	c.ContextProvider = server.NewGinContextProvider()
+
+	consumer := discogs.OAuthConsumer{
+		Key:    c.Config.Discogs.ConsumerKey,
+		Secret: c.Config.Discogs.ConsumerSecret,
+	}
+	callbackURL := ""
+	if c.Config.Discogs.OAuthEnabled() {
+		callbackURL = c.Config.Discogs.CallbackURL
+	}
+	c.DiscogsAuth = usecases.NewDiscogsAuthenticate(discogs.NewAuthService(discogsClient, consumer), callbackURL)
 
-	c.DiscogsService = discogs.NewHTTPService(discogsClient)
-	c.SpotifyService = spotify.NewHTTPService(spotifyClient, contextProvider)
+	c.DiscogsService = discogs.NewHTTPServiceWithOptions(discogsClient, discogs.Options{
+		Credentials: c.ContextProvider,
+		Consumer:    consumer,
+		PageWorkers: c.Config.HTTP.DiscogsPageWorkers,
+	})
+	c.SpotifyService = spotify.NewHTTPService(spotifyClient, c.ContextProvider, c.OAuthController)
 }
 
 func (c *Container) initControllers() {
-	c.PlaylistController = usecases.NewPlaylistController(
+	c.PlaylistController = usecases.NewPlaylistControllerWithOptions(
 		c.DiscogsService,
 		c.SpotifyService,
+		usecases.ControllerOptions{
+			ImporterOptions: usecases.ImporterOptions{
+				Barcodes: c.Config.Matching.Barcodes,
+			},
+			ConverterOptions: usecases.ConverterOptions{
+				Matcher:   entities.NewAlbumMatcher(c.Config.Matching.Threshold),
+				Overrides: c.OverrideStore,
+				Cache:     c.MatchCache,
+				Limiter:   c.HTTPClientFactory.SpotifyLimiter(),
+				Workers:   c.Config.Matching.Workers,
+			},
+			Syncs: c.SyncStore,
+		},
 	)
 
-	redirectURI := c.Config.Spotify.RedirectURI
-	if c.Config.Spotify.UseProxy && c.Config.Spotify.ProxyURL != "" {
-		redirectURI = c.Config.Spotify.ProxyURL + "/auth/proxy/callback/spotify"
-	}
+	c.PlaylistJobs = usecases.NewPlaylistJobs(
+		c.PlaylistController,
+		c.JobStore,
+		c.Config.Jobs.Workers,
+	)
 
-	c.OAuthController = usecases.NewSpotifyAuthenticate(
-		c.Config.Spotify.ClientID,
-		c.Config.Spotify.ClientSecret,
-		redirectURI,
+	c.SyncScheduler = usecases.NewSyncScheduler(
+		c.PlaylistJobs,
+		c.ScheduleStore,
+		c.ContextProvider,
+		server.NewDetachedContext,
+		c.Config.Scheduler.CheckInterval,
 	)
 
 	c.UserController = usecases.NewGetSpotifyUser(c.SpotifyService)
+	c.FoldersController = usecases.NewGetDiscogsFolders(c.DiscogsService)
+	c.OverridesController = usecases.NewMatchOverrides(c.OverrideStore)
 }
 
 func (c *Container) initServer() {
 	c.Server = server.NewServer(
-		c.PlaylistController,
+		c.PlaylistJobs,
 		c.OAuthController,
+		c.DiscogsAuth,
 		c.UserController,
+		c.FoldersController,
+		c.OverridesController,
+		c.SyncScheduler,
 		c.Session,
 	)
 
@@ -100,8 +257,19 @@ func (c *Container) initServer() {
 		WriteTimeout: c.Config.Server.WriteTimeout,
 		IdleTimeout:  c.Config.Server.IdleTimeout,
 	}
+	// the job event streams last as long as their jobs, they are ended so the shutdown doesn't wait for them
+	c.HTTPServer.RegisterOnShutdown(c.PlaylistJobs.EndStreams)
 }
 
 func (c *Container) GetHTTPServer() *http.Server {
 	return c.HTTPServer
 }
+
+// Close stops the scheduler and the background workers, letting running jobs finish until ctx is done.
+// The scheduler stops first so no sync is submitted while the jobs close, and waits for them
+// afterwards to record the syncs that were canceled
+func (c *Container) Close(ctx context.Context) {
+	c.SyncScheduler.Stop(ctx)
+	c.PlaylistJobs.Close(ctx)
+	c.SyncScheduler.Wait()
+}
@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+)
+
+const defaultRetention = time.Hour
+
+type InMemoryStore struct {
+	mu        sync.RWMutex
+	jobs      map[string]entities.Job
+	retention time.Duration
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		jobs:      make(map[string]entities.Job),
+		retention: defaultRetention,
+	}
+}
+
+func (s *InMemoryStore) Save(_ context.Context, job *entities.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = *job
+	s.prune()
+	return nil
+}
+
+func (s *InMemoryStore) Get(_ context.Context, id string) (*entities.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return nil, errorWrapper.Wrap(errorWrapper.ErrNotFound, "job "+id)
+	}
+	return &job, nil
+}
+
+// prune drops finished jobs older than the retention period, must be called with the lock held
+func (s *InMemoryStore) prune() {
+	threshold := time.Now().Add(-s.retention)
+	for id := range s.jobs {
+		job := s.jobs[id]
+		if job.Finished() && job.UpdatedAt.Before(threshold) {
+			delete(s.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package jsonstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/martiriera/discogs-spotify/internal/utils/file"
+	"github.com/martiriera/discogs-spotify/internal/utils/secret"
+)
+
+// KeyFunc returns the user a value belongs to and its key among the values of the user
+type KeyFunc[T any] func(value *T) (userID, key string)
+
+// Store keeps values by user and key, writing them all to a JSON file after every change when it has a path.
+// Values are copied in and out, so callers only copy what they hold by reference
+type Store[T any] struct {
+	mu     sync.RWMutex
+	values map[string]map[string]T
+	key    KeyFunc[T]
+	name   string
+	path   string
+	box    *secret.Box // encrypts the file when set
+}
+
+// New returns a store kept in memory, name describes the values in errors
+func New[T any](name string, key KeyFunc[T]) *Store[T] {
+	return &Store[T]{values: make(map[string]map[string]T), key: key, name: name}
+}
+
+// Open loads the values saved at path, which doesn't need to exist yet
+func Open[T any](path, name string, key KeyFunc[T]) (*Store[T], error) {
+	return OpenEncrypted(path, name, key, nil)
+}
+
+// OpenEncrypted loads the values saved at path encrypted with box, or in plain JSON when box is nil.
+// A plain JSON file is loaded as well, to be encrypted on the next change
+func OpenEncrypted[T any](path, name string, key KeyFunc[T], box *secret.Box) (*Store[T], error) {
+	s := New(name, key)
+	s.path = path
+	s.box = box
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s file", name)
+	}
+	if box != nil && !bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if data, err = box.Open(data); err != nil {
+			return nil, errors.Wrapf(err, "error decrypting %s file", name)
+		}
+	}
+
+	var saved []T
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, errors.Wrapf(err, "error decoding %s file", name)
+	}
+	for i := range saved {
+		s.set(saved[i])
+	}
+	return s, nil
+}
+
+func (s *Store[T]) Get(userID, key string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, exists := s.values[userID][key]
+	return value, exists
+}
+
+// List returns the values of the user, in no particular order
+func (s *Store[T]) List(userID string) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := make([]T, 0, len(s.values[userID]))
+	for _, value := range s.values[userID] {
+		values = append(values, value)
+	}
+	return values
+}
+
+// All returns the values of every user, in no particular order
+func (s *Store[T]) All() []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.all()
+}
+
+func (s *Store[T]) Save(value T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set(value)
+	return s.persist()
+}
+
+// Delete removes the value, reporting whether it existed
+func (s *Store[T]) Delete(userID, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.values[userID][key]; !exists {
+		return false, nil
+	}
+	delete(s.values[userID], key)
+	return true, s.persist()
+}
+
+// set must be called with the lock held
+func (s *Store[T]) set(value T) {
+	userID, key := s.key(&value)
+	if s.values[userID] == nil {
+		s.values[userID] = make(map[string]T)
+	}
+	s.values[userID][key] = value
+}
+
+// all must be called with the lock held
+func (s *Store[T]) all() []T {
+	all := []T{}
+	for _, values := range s.values {
+		for _, value := range values {
+			all = append(all, value)
+		}
+	}
+	return all
+}
+
+// persist writes every value to the file, must be called with the lock held
+func (s *Store[T]) persist() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.all())
+	if err != nil {
+		return errors.Wrapf(err, "error encoding %s", s.name)
+	}
+	if s.box != nil {
+		if data, err = s.box.Seal(data); err != nil {
+			return errors.Wrapf(err, "error encrypting %s", s.name)
+		}
+	}
+	return errors.Wrapf(file.WriteAtomic(s.path, data), "error writing %s file", s.name)
+}
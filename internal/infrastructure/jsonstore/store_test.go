@@ -0,0 +1,102 @@
+package jsonstore
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/martiriera/discogs-spotify/internal/utils/secret"
+)
+
+type note struct {
+	UserID string `json:"user_id"`
+	ID     string `json:"id"`
+	Text   string `json:"text"`
+}
+
+func noteKey(n *note) (userID, key string) {
+	return n.UserID, n.ID
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.json")
+
+	store, err := Open(path, "notes", noteKey)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	for _, n := range []note{
+		{UserID: "wizzler", ID: "1", Text: "first"},
+		{UserID: "wizzler", ID: "2", Text: "second"},
+		{UserID: "wizzler", ID: "1", Text: "first again"},
+		{UserID: "digger", ID: "1", Text: "other user"},
+	} {
+		if err := store.Save(n); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+	}
+	if deleted, err := store.Delete("digger", "1"); !deleted || err != nil {
+		t.Fatalf("got deleted %v and error %v, want the note deleted", deleted, err)
+	}
+	if deleted, _ := store.Delete("digger", "1"); deleted {
+		t.Error("did not expect a missing note to be deleted")
+	}
+
+	reloaded, err := Open(path, "notes", noteKey)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	got := reloaded.List("wizzler")
+	sort.Slice(got, func(i, j int) bool { return got[i].ID < got[j].ID })
+	want := []note{{UserID: "wizzler", ID: "1", Text: "first again"}, {UserID: "wizzler", ID: "2", Text: "second"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if all := reloaded.All(); len(all) != 2 {
+		t.Errorf("got %d notes, want 2", len(all))
+	}
+	if _, exists := reloaded.Get("digger", "1"); exists {
+		t.Error("did not expect the deleted note to be reloaded")
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.json")
+	plain, err := Open(path, "notes", noteKey)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if err := plain.Save(note{UserID: "wizzler", ID: "1", Text: "secret"}); err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+
+	box, err := secret.NewBox("storage key")
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	// a plain file is still loaded, and encrypted on the next change
+	store, err := OpenEncrypted(path, "notes", noteKey, box)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if err := store.Save(note{UserID: "wizzler", ID: "2", Text: "secret too"}); err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "secret") {
+		t.Errorf("got the notes in plain text in %s", data)
+	}
+
+	reloaded, err := OpenEncrypted(path, "notes", noteKey, box)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if got := reloaded.List("wizzler"); len(got) != 2 {
+		t.Errorf("got %v, want both notes", got)
+	}
+	if _, err := Open(path, "notes", noteKey); err == nil {
+		t.Error("expected an error loading the encrypted notes without the key")
+	}
+}
@@ -0,0 +1,56 @@
+package overrides
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/jsonstore"
+)
+
+// Store keeps the match overrides by user and Discogs release ID
+type Store struct {
+	overrides *jsonstore.Store[entities.MatchOverride]
+}
+
+func NewInMemoryStore() *Store {
+	return &Store{overrides: jsonstore.New("overrides", overrideKey)}
+}
+
+// NewFileStore loads the overrides saved at path, which doesn't need to exist yet
+func NewFileStore(path string) (*Store, error) {
+	overrides, err := jsonstore.Open(path, "overrides", overrideKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{overrides: overrides}, nil
+}
+
+func (s *Store) List(_ context.Context, userID string) ([]entities.MatchOverride, error) {
+	overrides := s.overrides.List(userID)
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].DiscogsID < overrides[j].DiscogsID
+	})
+	return overrides, nil
+}
+
+func (s *Store) Save(_ context.Context, override *entities.MatchOverride) error {
+	return s.overrides.Save(*override)
+}
+
+func (s *Store) Delete(_ context.Context, userID string, discogsID int) error {
+	deleted, err := s.overrides.Delete(userID, strconv.Itoa(discogsID))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errorWrapper.Wrap(errorWrapper.ErrNotFound, "override "+strconv.Itoa(discogsID))
+	}
+	return nil
+}
+
+func overrideKey(override *entities.MatchOverride) (userID, key string) {
+	return override.UserID, strconv.Itoa(override.DiscogsID)
+}
@@ -0,0 +1,41 @@
+package overrides
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "overrides.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	pinned := entities.MatchOverride{UserID: "wizzler", DiscogsID: 1, SpotifyAlbumID: entities.SpotifyAlbumIDRooms}
+	skipped := entities.MatchOverride{UserID: "wizzler", DiscogsID: 2, Skip: true}
+	for _, override := range []entities.MatchOverride{skipped, pinned} {
+		if err := store.Save(ctx, &override); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+	}
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	got, _ := reloaded.List(ctx, "wizzler")
+	if want := []entities.MatchOverride{pinned, skipped}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := reloaded.Delete(ctx, "someone-else", 1); !errorWrapper.Is(err, errorWrapper.ErrNotFound) {
+		t.Errorf("got %v, want %v", err, errorWrapper.ErrNotFound)
+	}
+}
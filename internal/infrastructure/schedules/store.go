@@ -0,0 +1,98 @@
+package schedules
+
+import (
+	"context"
+	"sort"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/jsonstore"
+	"github.com/martiriera/discogs-spotify/internal/utils/secret"
+)
+
+// Store keeps the scheduled syncs by user and Discogs source
+type Store struct {
+	schedules *jsonstore.Store[entities.SyncSchedule]
+}
+
+func NewInMemoryStore() *Store {
+	return &Store{schedules: jsonstore.New("sync schedules", scheduleKey)}
+}
+
+// NewFileStore loads the schedules saved at path, which doesn't need to exist yet. The file keeps the
+// Spotify tokens and Discogs credentials of the users, encrypted with box or in plain JSON when it's nil
+func NewFileStore(path string, box *secret.Box) (*Store, error) {
+	schedules, err := jsonstore.OpenEncrypted(path, "sync schedules", scheduleKey, box)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{schedules: schedules}, nil
+}
+
+func (s *Store) List(_ context.Context) ([]entities.SyncSchedule, error) {
+	return cloneAll(s.schedules.All()), nil
+}
+
+func (s *Store) ListByUser(_ context.Context, userID string) ([]entities.SyncSchedule, error) {
+	return cloneAll(s.schedules.List(userID)), nil
+}
+
+func (s *Store) Get(_ context.Context, userID, source string) (*entities.SyncSchedule, error) {
+	schedule, exists := s.schedules.Get(userID, source)
+	if !exists {
+		return nil, errorWrapper.Wrap(errorWrapper.ErrNotFound, "sync schedule "+source)
+	}
+	schedule = clone(schedule)
+	return &schedule, nil
+}
+
+func (s *Store) Save(_ context.Context, schedule *entities.SyncSchedule) error {
+	return s.schedules.Save(clone(*schedule))
+}
+
+func (s *Store) Delete(_ context.Context, userID, source string) error {
+	deleted, err := s.schedules.Delete(userID, source)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errorWrapper.Wrap(errorWrapper.ErrNotFound, "sync schedule "+source)
+	}
+	return nil
+}
+
+func scheduleKey(schedule *entities.SyncSchedule) (userID, key string) {
+	return schedule.UserID, schedule.Source
+}
+
+// cloneAll clones the schedules and sorts them by user and source
+func cloneAll(schedules []entities.SyncSchedule) []entities.SyncSchedule {
+	for i := range schedules {
+		schedules[i] = clone(schedules[i])
+	}
+	sortSchedules(schedules)
+	return schedules
+}
+
+// clone copies the credentials and history so callers can't change the stored schedule
+func clone(schedule entities.SyncSchedule) entities.SyncSchedule {
+	if schedule.Token != nil {
+		token := *schedule.Token
+		schedule.Token = &token
+	}
+	if schedule.Discogs != nil {
+		discogs := *schedule.Discogs
+		schedule.Discogs = &discogs
+	}
+	schedule.History = append([]entities.SyncRun(nil), schedule.History...)
+	return schedule
+}
+
+func sortSchedules(schedules []entities.SyncSchedule) {
+	sort.Slice(schedules, func(i, j int) bool {
+		if schedules[i].UserID != schedules[j].UserID {
+			return schedules[i].UserID < schedules[j].UserID
+		}
+		return schedules[i].Source < schedules[j].Source
+	})
+}
@@ -0,0 +1,83 @@
+package schedules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/utils/secret"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	box, err := secret.NewBox("storage key")
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+
+	store, err := NewFileStore(path, box)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	nextRun := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	schedule := entities.SyncSchedule{
+		UserID:     "wizzler",
+		Source:     "collection/digger",
+		DiscogsURL: "https://www.discogs.com/user/digger/collection",
+		Interval:   entities.SyncDaily,
+		Token:      &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"},
+		NextRunAt:  nextRun,
+		History:    []entities.SyncRun{{JobID: "job", StartedAt: nextRun, FinishedAt: nextRun, Stage: entities.JobDone}},
+	}
+	if err := store.Save(ctx, &schedule); err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	schedule.Token.RefreshToken = "changed after saving"
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("got file mode %v, want %v", info.Mode().Perm(), os.FileMode(0o600))
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "refresh") {
+		t.Errorf("got the token in plain text in %s", data)
+	}
+	other, _ := secret.NewBox("another key")
+	if _, err := NewFileStore(path, other); err == nil {
+		t.Error("expected an error loading the schedules with another key")
+	}
+
+	reloaded, err := NewFileStore(path, box)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	got, err := reloaded.Get(ctx, "wizzler", "collection/digger")
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if got.Token.RefreshToken != "refresh" {
+		t.Errorf("got refresh token %q, want %q", got.Token.RefreshToken, "refresh")
+	}
+	if !reflect.DeepEqual(got.History, schedule.History) || !got.NextRunAt.Equal(nextRun) {
+		t.Errorf("got %+v, want %+v", got, schedule)
+	}
+
+	all, _ := reloaded.List(ctx)
+	if len(all) != 1 {
+		t.Errorf("got %d schedules, want 1", len(all))
+	}
+	if err := reloaded.Delete(ctx, "someone-else", "collection/digger"); !errorWrapper.Is(err, errorWrapper.ErrNotFound) {
+		t.Errorf("got %v, want %v", err, errorWrapper.ErrNotFound)
+	}
+}
@@ -1,14 +1,19 @@
 package server
 
 import (
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"text/template"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 
 	"github.com/martiriera/discogs-spotify/internal/adapters/discogs"
 	"github.com/martiriera/discogs-spotify/internal/adapters/spotify"
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
 	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
 	"github.com/martiriera/discogs-spotify/internal/core/ports"
 	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
@@ -16,29 +21,94 @@ import (
 )
 
 type APIRouter struct {
-	playlistController *usecases.Controller
-	userController     *usecases.GetSpotifyUser
-	session            ports.SessionPort
-	template           *template.Template
+	playlistJobs   *usecases.PlaylistJobs
+	userController *usecases.GetSpotifyUser
+	folders        *usecases.GetDiscogsFolders
+	overrides      *usecases.MatchOverrides
+	scheduler      *usecases.SyncScheduler
+	tokenRefresher ports.TokenPort
+	session        ports.SessionPort
+	template       *template.Template
 }
 
 func NewAPIRouter(
-	pc *usecases.Controller,
+	jobs *usecases.PlaylistJobs,
 	getSpotifyUserUseCase *usecases.GetSpotifyUser,
+	getDiscogsFolders *usecases.GetDiscogsFolders,
+	matchOverrides *usecases.MatchOverrides,
+	syncScheduler *usecases.SyncScheduler,
+	tokenRefresher ports.TokenPort,
 	sessionPort ports.SessionPort,
 	tmpl *template.Template) *APIRouter {
-	router := &APIRouter{playlistController: pc, userController: getSpotifyUserUseCase, session: sessionPort, template: tmpl}
+	router := &APIRouter{
+		playlistJobs:   jobs,
+		userController: getSpotifyUserUseCase,
+		folders:        getDiscogsFolders,
+		overrides:      matchOverrides,
+		scheduler:      syncScheduler,
+		tokenRefresher: tokenRefresher,
+		session:        sessionPort,
+		template:       tmpl,
+	}
 	return router
 }
 
 func (router *APIRouter) SetupRoutes(rg *gin.RouterGroup) {
 	rg.GET("/", router.handleMain)
-	rg.GET("/home", authTokenMiddleware(router.session), router.handleMain)
+	rg.GET("/home", authTokenMiddleware(router.session, router.tokenRefresher), router.handleMain)
 	rg.POST("/playlist",
-		authTokenMiddleware(router.session),
+		authTokenMiddleware(router.session, router.tokenRefresher),
 		authUserMiddleware(*router.userController),
+		discogsCredentialsMiddleware(router.session),
 		router.handlePlaylistCreate,
 	)
+	rg.GET("/jobs/:id",
+		authTokenMiddleware(router.session, router.tokenRefresher),
+		authUserMiddleware(*router.userController),
+		router.handleJobGet,
+	)
+	rg.GET("/jobs/:id/events",
+		authTokenMiddleware(router.session, router.tokenRefresher),
+		authUserMiddleware(*router.userController),
+		router.handleJobEvents,
+	)
+	rg.GET("/collection/folders",
+		authTokenMiddleware(router.session, router.tokenRefresher),
+		authUserMiddleware(*router.userController),
+		discogsCredentialsMiddleware(router.session),
+		router.handleFoldersList,
+	)
+	rg.GET("/overrides",
+		authTokenMiddleware(router.session, router.tokenRefresher),
+		authUserMiddleware(*router.userController),
+		router.handleOverridesList,
+	)
+	rg.PUT("/overrides/:discogs_id",
+		authTokenMiddleware(router.session, router.tokenRefresher),
+		authUserMiddleware(*router.userController),
+		router.handleOverrideSave,
+	)
+	rg.DELETE("/overrides/:discogs_id",
+		authTokenMiddleware(router.session, router.tokenRefresher),
+		authUserMiddleware(*router.userController),
+		router.handleOverrideDelete,
+	)
+	rg.GET("/schedules",
+		authTokenMiddleware(router.session, router.tokenRefresher),
+		authUserMiddleware(*router.userController),
+		router.handleSchedulesList,
+	)
+	rg.PUT("/schedules",
+		authTokenMiddleware(router.session, router.tokenRefresher),
+		authUserMiddleware(*router.userController),
+		discogsCredentialsMiddleware(router.session),
+		router.handleScheduleSave,
+	)
+	rg.DELETE("/schedules/*source",
+		authTokenMiddleware(router.session, router.tokenRefresher),
+		authUserMiddleware(*router.userController),
+		router.handleScheduleDelete,
+	)
 	rg.Static("/static", "./static")
 }
 
@@ -59,34 +129,368 @@ func (router *APIRouter) handleHome(ctx *gin.Context) {
 }
 
 func (router *APIRouter) handlePlaylistCreate(ctx *gin.Context) {
-	username := ctx.PostForm("discogs_url")
+	discogsURL := ctx.PostForm("discogs_url")
 
-	if username == "" {
+	if discogsURL == "" {
 		handleError(ctx, errorWrapper.ErrInvalidInput, http.StatusBadRequest)
 		return
 	}
 
-	pl, err := router.playlistController.CreatePlaylist(ctx, username)
+	userID := MustGetContextValue(ctx, session.SpotifyUserIDKey).(string)
+	options := entities.PlaylistOptions{
+		Sync:          ctx.PostForm("sync") == "true",
+		RemoveMissing: ctx.PostForm("remove_missing") == "true",
+		PlaylistID:    ctx.PostForm("playlist"),
+	}
+	job, err := router.playlistJobs.Submit(DetachedContext(ctx), userID, discogsURL, options)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecases.ErrInvalidDiscogsURL), errors.Is(err, usecases.ErrInvalidSpotifyPlaylist):
+			handleError(ctx, err, http.StatusBadRequest)
+		case errors.Is(err, usecases.ErrJobQueueFull), errors.Is(err, usecases.ErrJobsClosed):
+			handleError(ctx, err, http.StatusServiceUnavailable)
+		default:
+			handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, jobResponse(job))
+}
+
+func (router *APIRouter) handleJobGet(ctx *gin.Context) {
+	userID := MustGetContextValue(ctx, session.SpotifyUserIDKey).(string)
+	job, err := router.playlistJobs.Get(ctx, userID, ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, errorWrapper.ErrNotFound) {
+			handleError(ctx, errorWrapper.ErrNotFound, http.StatusNotFound)
+			return
+		}
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, jobResponse(job))
+}
+
+// handleJobEvents streams the job progress as Server-Sent Events until the job finishes,
+// or the server shuts down and ends the stream without a final event
+func (router *APIRouter) handleJobEvents(ctx *gin.Context) {
+	userID := MustGetContextValue(ctx, session.SpotifyUserIDKey).(string)
+	id := ctx.Param("id")
+	job, events, unsubscribe, err := router.playlistJobs.Subscribe(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, errorWrapper.ErrNotFound) {
+			handleError(ctx, errorWrapper.ErrNotFound, http.StatusNotFound)
+			return
+		}
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+	defer unsubscribe()
+
+	// the stream lasts as long as the job, beyond the server write timeout
+	if err := http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Println("error disabling write deadline for job events", err)
+	}
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+
+	ctx.SSEvent("job", jobResponse(job))
+	ctx.Writer.Flush()
+	for open := true; open; {
+		var event entities.ProgressEvent
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case event, open = <-events:
+			if open {
+				ctx.SSEvent(string(event.Type), progressEventResponse(event))
+				ctx.Writer.Flush()
+			}
+		}
+	}
+
+	// the channel is closed once the job finishes, send its final state
+	job, err = router.playlistJobs.Get(ctx, userID, id)
+	if err != nil {
+		return
+	}
+	if job.Finished() {
+		ctx.SSEvent(job.Stage.String(), jobResponse(job))
+		ctx.Writer.Flush()
+	}
+}
+
+// handleFoldersList lists the folders of the collection in the discogs_url query parameter
+func (router *APIRouter) handleFoldersList(ctx *gin.Context) {
+	discogsURL := ctx.Query("discogs_url")
+	if discogsURL == "" {
+		handleError(ctx, errorWrapper.ErrInvalidInput, http.StatusBadRequest)
+		return
+	}
+
+	folders, err := router.folders.GetFolders(ctx, discogsURL)
 	if err != nil {
 		switch {
-		case errors.Is(err, discogs.ErrUnauthorized):
-			handleError(ctx, err, http.StatusUnauthorized)
 		case errors.Is(err, usecases.ErrInvalidDiscogsURL):
 			handleError(ctx, err, http.StatusBadRequest)
-		case errors.Is(err, spotify.ErrSpotifyUnauthorized):
-			ctx.Redirect(http.StatusTemporaryRedirect, "/auth/login")
+		case errors.Is(err, discogs.ErrUnauthorized):
+			handleError(ctx, err, http.StatusForbidden)
 		default:
 			handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
 		}
 		return
 	}
 
-	responseBody := gin.H{
-		"id":               pl.ID,
-		"url":              pl.URL,
-		"discogs_releases": pl.DiscogsReleases,
-		"spotify_albums":   pl.SpotifyAlbums,
+	responseBody := make([]gin.H, len(folders))
+	for i, folder := range folders {
+		responseBody[i] = gin.H{
+			"id":    folder.ID,
+			"name":  folder.Name,
+			"count": folder.Count,
+		}
+	}
+	ctx.JSON(http.StatusOK, responseBody)
+}
+
+func (router *APIRouter) handleOverridesList(ctx *gin.Context) {
+	userID := MustGetContextValue(ctx, session.SpotifyUserIDKey).(string)
+	overrides, err := router.overrides.List(ctx, userID)
+	if err != nil {
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+
+	responseBody := make([]gin.H, len(overrides))
+	for i := range overrides {
+		responseBody[i] = overrideResponse(&overrides[i])
+	}
+	ctx.JSON(http.StatusOK, responseBody)
+}
+
+// handleOverrideSave pins the release to the spotify_album form value, or skips it when skip is true
+func (router *APIRouter) handleOverrideSave(ctx *gin.Context) {
+	discogsID, err := strconv.Atoi(ctx.Param("discogs_id"))
+	if err != nil || discogsID <= 0 {
+		handleError(ctx, errorWrapper.ErrInvalidInput, http.StatusBadRequest)
+		return
+	}
+
+	userID := MustGetContextValue(ctx, session.SpotifyUserIDKey).(string)
+	var override *entities.MatchOverride
+	switch {
+	case ctx.PostForm("skip") == "true":
+		override, err = router.overrides.Skip(ctx, userID, discogsID)
+	case ctx.PostForm("spotify_album") != "":
+		override, err = router.overrides.Pin(ctx, userID, discogsID, ctx.PostForm("spotify_album"))
+	default:
+		handleError(ctx, errorWrapper.ErrInvalidInput, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, usecases.ErrInvalidSpotifyAlbum) {
+			handleError(ctx, err, http.StatusBadRequest)
+			return
+		}
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, overrideResponse(override))
+}
+
+func (router *APIRouter) handleOverrideDelete(ctx *gin.Context) {
+	discogsID, err := strconv.Atoi(ctx.Param("discogs_id"))
+	if err != nil {
+		handleError(ctx, errorWrapper.ErrInvalidInput, http.StatusBadRequest)
+		return
 	}
 
+	userID := MustGetContextValue(ctx, session.SpotifyUserIDKey).(string)
+	if err := router.overrides.Delete(ctx, userID, discogsID); err != nil {
+		if errors.Is(err, errorWrapper.ErrNotFound) {
+			handleError(ctx, errorWrapper.ErrNotFound, http.StatusNotFound)
+			return
+		}
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (router *APIRouter) handleSchedulesList(ctx *gin.Context) {
+	userID := MustGetContextValue(ctx, session.SpotifyUserIDKey).(string)
+	schedules, err := router.scheduler.List(ctx, userID)
+	if err != nil {
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+
+	responseBody := make([]gin.H, len(schedules))
+	for i := range schedules {
+		responseBody[i] = scheduleResponse(&schedules[i])
+	}
 	ctx.JSON(http.StatusOK, responseBody)
 }
+
+// handleScheduleSave re-syncs the discogs_url form value every interval (hourly, daily or weekly)
+// with the Spotify token of the session, remove_missing as in handlePlaylistCreate
+func (router *APIRouter) handleScheduleSave(ctx *gin.Context) {
+	discogsURL := ctx.PostForm("discogs_url")
+	if discogsURL == "" {
+		handleError(ctx, errorWrapper.ErrInvalidInput, http.StatusBadRequest)
+		return
+	}
+
+	userID := MustGetContextValue(ctx, session.SpotifyUserIDKey).(string)
+	schedule, err := router.scheduler.Schedule(
+		ctx,
+		userID,
+		discogsURL,
+		entities.SyncInterval(ctx.PostForm("interval")),
+		ctx.PostForm("remove_missing") == "true",
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecases.ErrInvalidDiscogsURL), errors.Is(err, usecases.ErrInvalidSyncInterval):
+			handleError(ctx, err, http.StatusBadRequest)
+		default:
+			handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, scheduleResponse(schedule))
+}
+
+func (router *APIRouter) handleScheduleDelete(ctx *gin.Context) {
+	userID := MustGetContextValue(ctx, session.SpotifyUserIDKey).(string)
+	source := strings.TrimPrefix(ctx.Param("source"), "/")
+	if err := router.scheduler.Delete(ctx, userID, source); err != nil {
+		if errors.Is(err, errorWrapper.ErrNotFound) {
+			handleError(ctx, errorWrapper.ErrNotFound, http.StatusNotFound)
+			return
+		}
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// scheduleResponse leaves out the saved token
+func scheduleResponse(schedule *entities.SyncSchedule) gin.H {
+	history := make([]gin.H, len(schedule.History))
+	for i, run := range schedule.History {
+		history[i] = gin.H{
+			"job_id":         run.JobID,
+			"started_at":     run.StartedAt,
+			"finished_at":    run.FinishedAt,
+			"stage":          run.Stage,
+			"error":          run.Error,
+			"tracks_added":   run.TracksAdded,
+			"tracks_removed": run.TracksRemoved,
+		}
+	}
+	return gin.H{
+		"source":         schedule.Source,
+		"discogs_url":    schedule.DiscogsURL,
+		"interval":       schedule.Interval,
+		"remove_missing": schedule.RemoveMissing,
+		"next_run_at":    schedule.NextRunAt,
+		"history":        history,
+	}
+}
+
+func overrideResponse(override *entities.MatchOverride) gin.H {
+	return gin.H{
+		"discogs_id":       override.DiscogsID,
+		"spotify_album_id": override.SpotifyAlbumID,
+		"skip":             override.Skip,
+	}
+}
+
+func progressEventResponse(event entities.ProgressEvent) gin.H {
+	responseBody := gin.H{}
+	switch event.Type {
+	case entities.ProgressStage:
+		responseBody["stage"] = event.Stage
+	case entities.ProgressPageFetched:
+		responseBody["page"] = event.Count
+		responseBody["pages"] = event.Total
+	case entities.ProgressReleasesFetched:
+		responseBody["discogs_releases"] = event.Count
+	case entities.ProgressAlbumMatched, entities.ProgressAlbumUnmatched:
+		if event.Album != nil {
+			responseBody["artist"] = event.Album.Artist
+			responseBody["title"] = event.Album.Title
+		}
+		responseBody["score"] = event.Score
+		responseBody["processed"] = event.Processed
+		responseBody["matched"] = event.Matched
+	case entities.ProgressTracksAdded:
+		responseBody["added"] = event.Count
+		responseBody["tracks"] = event.Total
+	}
+	return responseBody
+}
+
+func jobResponse(job *entities.Job) gin.H {
+	responseBody := gin.H{
+		"id":               job.ID,
+		"stage":            job.Stage,
+		"discogs_releases": job.Releases,
+		"processed":        job.Processed,
+		"matched":          job.Matched,
+	}
+
+	if job.Playlist != nil {
+		responseBody["playlist"] = gin.H{
+			"id":               job.Playlist.ID,
+			"url":              job.Playlist.URL,
+			"discogs_releases": job.Playlist.DiscogsReleases,
+			"spotify_albums":   job.Playlist.SpotifyAlbums,
+			"spotify_tracks":   job.Playlist.SpotifyTracks,
+			"unmatched":        unmatchedResponse(job.Playlist.Unmatched()),
+			"synced":           job.Playlist.Synced,
+			"tracks_added":     job.Playlist.TracksAdded,
+			"tracks_removed":   job.Playlist.TracksRemoved,
+		}
+	}
+
+	if job.Err != nil {
+		responseBody["error"] = playlistError(job.Err).Error()
+	}
+
+	return responseBody
+}
+
+func unmatchedResponse(matches []entities.ReleaseMatch) []gin.H {
+	responseBody := make([]gin.H, len(matches))
+	for i := range matches {
+		responseBody[i] = gin.H{
+			"discogs_id": matches[i].DiscogsID,
+			"artist":     matches[i].Album.Artist,
+			"title":      matches[i].Album.Title,
+			"candidates": matches[i].Candidates,
+			"score":      matches[i].Score,
+			"reason":     matches[i].Reason,
+			"overridden": matches[i].Overridden,
+		}
+	}
+	return responseBody
+}
+
+// playlistError maps a failed job error to the error shown to the user
+func playlistError(err error) error {
+	switch {
+	case errors.Is(err, discogs.ErrUnauthorized):
+		return err
+	case errors.Is(err, spotify.ErrSpotifyUnauthorized):
+		return spotify.ErrSpotifyUnauthorized
+	default:
+		return errorWrapper.ErrInternal
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"net/url"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
 	"github.com/martiriera/discogs-spotify/internal/core/ports"
 	"github.com/martiriera/discogs-spotify/internal/usecases"
 	"github.com/martiriera/discogs-spotify/internal/utils/env"
@@ -14,11 +17,16 @@ import (
 
 type AuthRouter struct {
 	oauthController *usecases.SpotifyAuthenticate
+	discogsAuth     *usecases.DiscogsAuthenticate
 	session         ports.SessionPort
 }
 
-func NewAuthRouter(c *usecases.SpotifyAuthenticate, session ports.SessionPort) *AuthRouter {
-	router := &AuthRouter{oauthController: c, session: session}
+func NewAuthRouter(
+	c *usecases.SpotifyAuthenticate,
+	discogsAuth *usecases.DiscogsAuthenticate,
+	session ports.SessionPort,
+) *AuthRouter {
+	router := &AuthRouter{oauthController: c, discogsAuth: discogsAuth, session: session}
 	return router
 }
 
@@ -26,17 +34,28 @@ func (router *AuthRouter) SetupRoutes(rg *gin.RouterGroup) {
 	rg.GET("/login", router.handleLogin)
 	rg.GET("/callback", router.handleLoginCallback)
 
+	discogsGroup := rg.Group("/discogs")
+	discogsGroup.GET("", router.handleDiscogsAccount)
+	discogsGroup.GET("/login", router.handleDiscogsLogin)
+	discogsGroup.GET("/callback", router.handleDiscogsCallback)
+	discogsGroup.PUT("/token", router.handleDiscogsToken)
+	discogsGroup.DELETE("", router.handleDiscogsUnlink)
+
 	proxyGroup := rg.Group("/proxy")
 	proxyGroup.GET("/callback/spotify", router.handleProxyCallback)
 }
 
 func (router *AuthRouter) handleLogin(ctx *gin.Context) {
-	authURL := router.oauthController.GetAuthURL()
+	authURL, err := router.oauthController.StartLogin(ctx, router.session, ctx.Query("return_to"))
+	if err != nil {
+		handleError(ctx, err, http.StatusInternalServerError)
+		return
+	}
 	ctx.Redirect(http.StatusTemporaryRedirect, authURL)
 }
 
 func (router *AuthRouter) handleLoginCallback(ctx *gin.Context) {
-	token, err := router.oauthController.GenerateTokenFromGin(ctx)
+	token, returnTo, err := router.oauthController.GenerateTokenFromGin(ctx, router.session)
 	if err != nil {
 		handleError(ctx, err, http.StatusInternalServerError)
 		return
@@ -46,9 +65,82 @@ func (router *AuthRouter) handleLoginCallback(ctx *gin.Context) {
 		handleError(ctx, err, http.StatusInternalServerError)
 		return
 	}
+	ctx.Redirect(http.StatusTemporaryRedirect, returnTo)
+}
+
+// handleDiscogsAccount tells the Discogs account linked to the session and whether it can be linked with a login
+func (router *AuthRouter) handleDiscogsAccount(ctx *gin.Context) {
+	credentials, err := router.discogsAuth.LinkedAccount(ctx, router.session)
+	if err != nil {
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+	ctx.JSON(http.StatusOK, discogsAccountResponse(credentials, router.discogsAuth.OAuthEnabled()))
+}
+
+func (router *AuthRouter) handleDiscogsLogin(ctx *gin.Context) {
+	authURL, err := router.discogsAuth.StartLogin(ctx, router.session)
+	if err != nil {
+		if errors.Is(err, usecases.ErrDiscogsOAuthDisabled) {
+			handleError(ctx, err, http.StatusNotFound)
+			return
+		}
+		handleError(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	ctx.Redirect(http.StatusTemporaryRedirect, authURL)
+}
+
+// handleDiscogsCallback links the account and goes back home, where the linked account is shown
+func (router *AuthRouter) handleDiscogsCallback(ctx *gin.Context) {
+	if _, err := router.discogsAuth.CompleteLogin(ctx, router.session); err != nil {
+		switch {
+		case errors.Is(err, usecases.ErrDiscogsLoginDenied):
+			ctx.Redirect(http.StatusTemporaryRedirect, "/home")
+		case errors.Is(err, usecases.ErrDiscogsLoginMismatch), errors.Is(err, usecases.ErrRejectedDiscogsLink):
+			handleError(ctx, err, http.StatusBadRequest)
+		default:
+			handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		}
+		return
+	}
 	ctx.Redirect(http.StatusTemporaryRedirect, "/home")
 }
 
+// handleDiscogsToken links the account of the personal access token in the token form value
+func (router *AuthRouter) handleDiscogsToken(ctx *gin.Context) {
+	credentials, err := router.discogsAuth.LinkPersonalToken(ctx, router.session, ctx.PostForm("token"))
+	if err != nil {
+		if errors.Is(err, usecases.ErrInvalidDiscogsToken) {
+			handleError(ctx, err, http.StatusBadRequest)
+			return
+		}
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+	ctx.JSON(http.StatusOK, discogsAccountResponse(credentials, router.discogsAuth.OAuthEnabled()))
+}
+
+func (router *AuthRouter) handleDiscogsUnlink(ctx *gin.Context) {
+	if err := router.discogsAuth.Unlink(ctx, router.session); err != nil {
+		handleError(ctx, errorWrapper.ErrInternal, http.StatusInternalServerError)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// discogsAccountResponse leaves out the credentials, credentials is nil when no account is linked
+func discogsAccountResponse(credentials *entities.DiscogsCredentials, oauthEnabled bool) gin.H {
+	responseBody := gin.H{
+		"linked": credentials != nil,
+		"oauth":  oauthEnabled,
+	}
+	if credentials != nil {
+		responseBody["username"] = credentials.Username
+	}
+	return responseBody
+}
+
 // handleProxyCallback acts as an auth proxy for local development
 // It receives the OAuth callback from Spotify and redirects to the local dev server
 func (*AuthRouter) handleProxyCallback(ctx *gin.Context) {
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,27 +13,71 @@ import (
 	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
 )
 
-func authTokenMiddleware(service ports.SessionPort) gin.HandlerFunc {
+func authTokenMiddleware(service ports.SessionPort, refresher ports.TokenPort) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		if _, exists := GetContextValue(ctx, session.SpotifyTokenKey); exists {
 			ctx.Next()
 			return
 		}
 
-		token, err := service.GetData(ctx.Request, session.SpotifyTokenKey)
+		data, err := service.GetData(ctx.Request, session.SpotifyTokenKey)
+		token, ok := data.(*oauth2.Token)
 
-		if err != nil || token == nil || isExpired(token) {
-			ctx.Redirect(http.StatusFound, "/auth/login")
+		if err != nil || !ok || token == nil {
+			ctx.Redirect(http.StatusFound, loginURL(ctx))
 			ctx.Abort()
 			return
 		}
 
+		if refreshed, ok := takeRefreshedToken(token); ok {
+			if err := service.SetData(ctx.Request, ctx.Writer, session.SpotifyTokenKey, refreshed); err != nil {
+				log.Println(err)
+			} else {
+				token = refreshed
+			}
+		}
+
+		if isExpired(token) {
+			token, err = refreshSessionToken(ctx, service, refresher, token)
+			if err != nil {
+				log.Println(err)
+				ctx.Redirect(http.StatusFound, loginURL(ctx))
+				ctx.Abort()
+				return
+			}
+		}
+
 		SetContextValue(ctx, session.SpotifyTokenKey, token)
+		SetContextValue(ctx, sessionRefreshTokenKey, token.RefreshToken)
 		ctx.Next()
 	}
 }
 
-func isExpired(token any) bool {
-	oauth2Token := token.(*oauth2.Token)
-	return oauth2Token.Expiry.Before(time.Now())
+// refreshSessionToken gets a new access token and writes it back to the session
+func refreshSessionToken(
+	ctx *gin.Context,
+	service ports.SessionPort,
+	refresher ports.TokenPort,
+	token *oauth2.Token,
+) (*oauth2.Token, error) {
+	refreshed, err := refresher.RefreshToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.SetData(ctx.Request, ctx.Writer, session.SpotifyTokenKey, refreshed); err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// loginURL sends the user back to the requested page after logging in, when it's a page to navigate to
+func loginURL(ctx *gin.Context) string {
+	if ctx.Request.Method != http.MethodGet {
+		return "/auth/login"
+	}
+	return "/auth/login?return_to=" + url.QueryEscape(ctx.Request.URL.RequestURI())
+}
+
+func isExpired(token *oauth2.Token) bool {
+	return token.Expiry.Before(time.Now())
 }
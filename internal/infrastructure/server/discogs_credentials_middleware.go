@@ -0,0 +1,21 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
+)
+
+// discogsCredentialsMiddleware loads the Discogs account linked to the session,
+// the Discogs requests of users without one are sent anonymously
+func discogsCredentialsMiddleware(service ports.SessionPort) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := service.GetData(ctx.Request, session.DiscogsCredentialsKey)
+		if credentials, ok := data.(*entities.DiscogsCredentials); err == nil && ok && credentials.Linked() {
+			SetContextValue(ctx, session.DiscogsCredentialsKey, credentials)
+		}
+		ctx.Next()
+	}
+}
@@ -3,10 +3,12 @@ package server
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
 
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
 	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
 )
 
@@ -22,6 +24,82 @@ func MustGetContextValue(ctx *gin.Context, key session.ContextKey) any {
 	return ctx.MustGet(string(key))
 }
 
+// detachedValues holds the request values of a detached context,
+// they can be updated as background work refreshes the token
+type detachedValues struct {
+	mu     sync.RWMutex
+	values map[session.ContextKey]any
+}
+
+type detachedValuesKey struct{}
+
+// sessionRefreshTokenKey keeps the refresh token of the session the request comes from,
+// the tokens refreshed on its behalf are written back to that session
+const sessionRefreshTokenKey session.ContextKey = "session-refresh-token"
+
+// refreshedTokens keeps the tokens refreshed after the session was read, like the ones of background jobs,
+// keyed by the refresh token of the session. The next request of the user writes them back to the session
+var refreshedTokens sync.Map
+
+// DetachedContext copies the Spotify and Discogs credentials of the request into a context
+// that outlives it, so background work can keep calling both on behalf of the user
+func DetachedContext(ctx *gin.Context) context.Context {
+	values := &detachedValues{values: make(map[session.ContextKey]any)}
+	keys := []session.ContextKey{
+		session.SpotifyTokenKey, session.SpotifyUserIDKey, session.DiscogsCredentialsKey, sessionRefreshTokenKey,
+	}
+	for _, key := range keys {
+		if value, exists := GetContextValue(ctx, key); exists {
+			values.values[key] = value
+		}
+	}
+	return context.WithValue(context.Background(), detachedValuesKey{}, values)
+}
+
+// NewDetachedContext builds a detached context for the user outside of any request,
+// like the scheduled syncs running with the credentials saved when they were scheduled.
+// discogs is nil when the user didn't link a Discogs account
+func NewDetachedContext(userID string, token *oauth2.Token, discogs *entities.DiscogsCredentials) context.Context {
+	values := &detachedValues{values: map[session.ContextKey]any{
+		session.SpotifyTokenKey:  token,
+		session.SpotifyUserIDKey: userID,
+	}}
+	if discogs != nil {
+		values.values[session.DiscogsCredentialsKey] = discogs
+	}
+	return context.WithValue(context.Background(), detachedValuesKey{}, values)
+}
+
+// getValue reads a key from a gin.Context, a detached context or a plain context value
+func getValue(ctx context.Context, key session.ContextKey) (any, bool) {
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		return GetContextValue(ginCtx, key)
+	}
+	if values, ok := ctx.Value(detachedValuesKey{}).(*detachedValues); ok {
+		values.mu.RLock()
+		defer values.mu.RUnlock()
+		value, exists := values.values[key]
+		return value, exists
+	}
+	value := ctx.Value(key)
+	return value, value != nil
+}
+
+// setValue writes a key to a gin.Context or a detached context
+func setValue(ctx context.Context, key session.ContextKey, value any) error {
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		SetContextValue(ginCtx, key, value)
+		return nil
+	}
+	if values, ok := ctx.Value(detachedValuesKey{}).(*detachedValues); ok {
+		values.mu.Lock()
+		defer values.mu.Unlock()
+		values.values[key] = value
+		return nil
+	}
+	return fmt.Errorf("context is neither a gin.Context nor a detached context")
+}
+
 type GinContextProvider struct{}
 
 func NewGinContextProvider() *GinContextProvider {
@@ -29,12 +107,7 @@ func NewGinContextProvider() *GinContextProvider {
 }
 
 func (*GinContextProvider) GetToken(ctx context.Context) (*oauth2.Token, error) {
-	ginCtx, ok := ctx.(*gin.Context)
-	if !ok {
-		return nil, fmt.Errorf("context is not a gin.Context")
-	}
-
-	value, exists := GetContextValue(ginCtx, session.SpotifyTokenKey)
+	value, exists := getValue(ctx, session.SpotifyTokenKey)
 	if !exists {
 		return nil, fmt.Errorf("token not found in context")
 	}
@@ -48,12 +121,7 @@ func (*GinContextProvider) GetToken(ctx context.Context) (*oauth2.Token, error)
 }
 
 func (*GinContextProvider) GetUserID(ctx context.Context) (string, error) {
-	ginCtx, ok := ctx.(*gin.Context)
-	if !ok {
-		return "", fmt.Errorf("context is not a gin.Context")
-	}
-
-	value, exists := GetContextValue(ginCtx, session.SpotifyUserIDKey)
+	value, exists := getValue(ctx, session.SpotifyUserIDKey)
 	if !exists {
 		return "", fmt.Errorf("user ID not found in context")
 	}
@@ -66,12 +134,46 @@ func (*GinContextProvider) GetUserID(ctx context.Context) (string, error) {
 	return userID, nil
 }
 
+// SetToken replaces the token of the context, when the context comes from a session the token
+// is kept until the next request of the user writes it back to the session
+func (*GinContextProvider) SetToken(ctx context.Context, token *oauth2.Token) error {
+	if err := setValue(ctx, session.SpotifyTokenKey, token); err != nil {
+		return err
+	}
+	if refreshToken, ok := getValue(ctx, sessionRefreshTokenKey); ok && refreshToken != "" {
+		refreshedTokens.Store(refreshToken, token)
+	}
+	return nil
+}
+
+// takeRefreshedToken returns the token refreshed on behalf of the session holding token,
+// when it's newer than the one in the session
+func takeRefreshedToken(token *oauth2.Token) (*oauth2.Token, bool) {
+	if token.RefreshToken == "" {
+		return nil, false
+	}
+	value, ok := refreshedTokens.LoadAndDelete(token.RefreshToken)
+	if !ok {
+		return nil, false
+	}
+	refreshed := value.(*oauth2.Token)
+	return refreshed, refreshed.Expiry.After(token.Expiry)
+}
+
 func (*GinContextProvider) SetUserID(ctx context.Context, userID string) error {
-	ginCtx, ok := ctx.(*gin.Context)
+	return setValue(ctx, session.SpotifyUserIDKey, userID)
+}
+
+func (*GinContextProvider) GetDiscogsCredentials(ctx context.Context) (*entities.DiscogsCredentials, error) {
+	value, exists := getValue(ctx, session.DiscogsCredentialsKey)
+	if !exists {
+		return nil, nil
+	}
+
+	credentials, ok := value.(*entities.DiscogsCredentials)
 	if !ok {
-		return fmt.Errorf("context is not a gin.Context")
+		return nil, fmt.Errorf("discogs credentials in context are not of type *entities.DiscogsCredentials")
 	}
 
-	SetContextValue(ginCtx, session.SpotifyUserIDKey, userID)
-	return nil
+	return credentials, nil
 }
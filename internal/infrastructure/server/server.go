@@ -23,17 +23,21 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 var templateFS embed.FS
 
 func NewServer(
-	playlistController *usecases.Controller,
+	playlistJobs *usecases.PlaylistJobs,
 	authenticateSpotify *usecases.SpotifyAuthenticate,
+	authenticateDiscogs *usecases.DiscogsAuthenticate,
 	getSpotifyUser *usecases.GetSpotifyUser,
+	getDiscogsFolders *usecases.GetDiscogsFolders,
+	matchOverrides *usecases.MatchOverrides,
+	syncScheduler *usecases.SyncScheduler,
 	session ports.SessionPort,
 ) *Server {
 	s := &Server{Engine: gin.Default()}
 
 	tmpl := template.Must(template.ParseFS(templateFS, "templates/*.html"))
 
-	apiRouter := NewAPIRouter(playlistController, getSpotifyUser, session, tmpl)
-	authRouter := NewAuthRouter(authenticateSpotify, session)
+	apiRouter := NewAPIRouter(playlistJobs, getSpotifyUser, getDiscogsFolders, matchOverrides, syncScheduler, authenticateSpotify, session, tmpl)
+	authRouter := NewAuthRouter(authenticateSpotify, authenticateDiscogs, session)
 
 	authGroup := s.Group("/auth")
 	authRouter.SetupRoutes(authGroup)
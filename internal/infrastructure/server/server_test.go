@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -9,11 +11,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
 
 	"github.com/martiriera/discogs-spotify/internal/adapters/discogs"
 	"github.com/martiriera/discogs-spotify/internal/adapters/spotify"
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/jobs"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/overrides"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/schedules"
 	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
 	"github.com/martiriera/discogs-spotify/internal/usecases"
 )
@@ -23,10 +30,7 @@ func TestAcceptance(t *testing.T) {
 		Response: entities.MotherTwoDiscogsAlbums(),
 	}
 	spotifyServiceMock := &spotify.ServiceMock{
-		SearchAlbumResponses: [][]entities.SpotifyAlbumItem{
-			entities.MotherSpotifyAlbums()[0:2],
-			entities.MotherSpotifyAlbums()[2:4],
-		},
+		SearchAlbumResults: entities.MotherSpotifySearchResults(),
 	}
 	oauthController := usecases.NewSpotifyAuthenticate(
 		"client_id",
@@ -34,13 +38,19 @@ func TestAcceptance(t *testing.T) {
 		"http://localhost:8080/auth/callback",
 	)
 	userController := usecases.NewGetSpotifyUser(spotifyServiceMock)
+	overridesController := usecases.NewMatchOverrides(overrides.NewInMemoryStore())
+	foldersController := usecases.NewGetDiscogsFolders(discogsServiceMock)
+	discogsAuth := usecases.NewDiscogsAuthenticate(
+		&discogs.AuthServiceMock{Tokens: map[string]string{"personal_token": "martireir"}},
+		"",
+	)
 
 	t.Run("api main get 200", func(t *testing.T) {
 		sessionMock := initSessionMock()
 		request := httptest.NewRequest("GET", "/", http.NoBody)
 		response := httptest.NewRecorder()
-		playlistController := usecases.NewPlaylistController(discogsServiceMock, spotifyServiceMock)
-		server := NewServer(playlistController, oauthController, userController, sessionMock)
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
 
 		server.ServeHTTP(response, request)
 
@@ -51,8 +61,8 @@ func TestAcceptance(t *testing.T) {
 		sessionMock := initSessionMock()
 		request := httptest.NewRequest("GET", "/auth/login", http.NoBody)
 		response := httptest.NewRecorder()
-		playlistController := usecases.NewPlaylistController(discogsServiceMock, spotifyServiceMock)
-		server := NewServer(playlistController, oauthController, userController, sessionMock)
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
 
 		server.ServeHTTP(response, request)
 
@@ -64,7 +74,7 @@ func TestAcceptance(t *testing.T) {
 		request := httptest.NewRequest("POST", "/playlist", strings.NewReader("discogs_url=https://www.discogs.com/user/martireir/collection"))
 		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		response := httptest.NewRecorder()
-		playlistController := usecases.NewPlaylistController(discogsServiceMock, spotifyServiceMock)
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
 
 		token := &oauth2.Token{
 			AccessToken:  "access_token",
@@ -74,12 +84,67 @@ func TestAcceptance(t *testing.T) {
 		}
 		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, token)
 
-		server := NewServer(playlistController, oauthController, userController, sessionMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+		server.ServeHTTP(response, request)
+
+		assertResponseStatus(t, response.Code, 202)
+		var submitted struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(response.Body.Bytes(), &submitted); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+
+		job := waitForJob(t, server, submitted.ID)
+		want := "{\"discogs_releases\":2,\"id\":\"6rqhFgbbKwnb9MLmUQDhG6\",\"spotify_albums\":2,\"spotify_tracks\":0,\"synced\":false,\"tracks_added\":2,\"tracks_removed\":0,\"unmatched\":[],\"url\":\"https://open.spotify.com/playlist/6rqhFgbbKwnb9MLmUQDhG6\"}"
+		assertResponseBody(t, string(job["playlist"]), want)
+	})
+
+	t.Run("api job events stream", func(t *testing.T) {
+		discogsServiceMock.Error = nil
+		sessionMock := initSessionMock()
+		request := httptest.NewRequest("POST", "/playlist", strings.NewReader("discogs_url=https://www.discogs.com/user/martireir/collection"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Minute)})
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 202)
+		var submitted struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(response.Body.Bytes(), &submitted); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+
+		request = httptest.NewRequest("GET", "/jobs/"+submitted.ID+"/events", http.NoBody)
+		response = httptest.NewRecorder()
 		server.ServeHTTP(response, request)
 
 		assertResponseStatus(t, response.Code, 200)
-		want := "{\"discogs_releases\":2,\"id\":\"6rqhFgbbKwnb9MLmUQDhG6\",\"spotify_albums\":2,\"url\":\"https://open.spotify.com/playlist/6rqhFgbbKwnb9MLmUQDhG6\"}"
-		assertResponseBody(t, response.Body.String(), want)
+		body := response.Body.String()
+		if !strings.HasPrefix(body, "event:job\n") {
+			t.Errorf("got %q, want it to start with the job event", body)
+		}
+		if !strings.Contains(body, "event:done\n") {
+			t.Errorf("got %q, want it to contain the done event", body)
+		}
+	})
+
+	t.Run("api job get 404 unknown id", func(t *testing.T) {
+		sessionMock := initSessionMock()
+		request := httptest.NewRequest("GET", "/jobs/unknown", http.NoBody)
+		response := httptest.NewRecorder()
+		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Minute)})
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+
+		server.ServeHTTP(response, request)
+
+		assertResponseStatus(t, response.Code, 404)
+		assertResponseBody(t, response.Body.String(), "{\"error\":\"resource not found error\"}")
 	})
 
 	t.Run("api playlist post 400 no username", func(t *testing.T) {
@@ -87,8 +152,8 @@ func TestAcceptance(t *testing.T) {
 		request := httptest.NewRequest("POST", "/playlist", http.NoBody)
 		response := httptest.NewRecorder()
 		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Minute)})
-		playlistController := usecases.NewPlaylistController(discogsServiceMock, spotifyServiceMock)
-		server := NewServer(playlistController, oauthController, userController, sessionMock)
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
 
 		server.ServeHTTP(response, request)
 
@@ -96,7 +161,21 @@ func TestAcceptance(t *testing.T) {
 		assertResponseBody(t, response.Body.String(), "{\"error\":\"invalid input error\"}")
 	})
 
-	t.Run("api playlist post 500 discogs error", func(t *testing.T) {
+	t.Run("api playlist post 400 invalid url", func(t *testing.T) {
+		sessionMock := initSessionMock()
+		request := httptest.NewRequest("POST", "/playlist", strings.NewReader("discogs_url=https://www.discogs.com/user/martireir"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Minute)})
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+
+		server.ServeHTTP(response, request)
+
+		assertResponseStatus(t, response.Code, 400)
+	})
+
+	t.Run("api job failed discogs error", func(t *testing.T) {
 		discogsServiceMock.Error = discogs.ErrUnexpectedStatus
 		sessionMock := initSessionMock()
 
@@ -104,13 +183,22 @@ func TestAcceptance(t *testing.T) {
 		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		response := httptest.NewRecorder()
 		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Minute)})
-		playlistController := usecases.NewPlaylistController(discogsServiceMock, spotifyServiceMock)
-		server := NewServer(playlistController, oauthController, userController, sessionMock)
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
 
 		server.ServeHTTP(response, request)
 
-		assertResponseStatus(t, response.Code, 500)
-		assertResponseBody(t, response.Body.String(), "{\"error\":\"internal server error\"}")
+		assertResponseStatus(t, response.Code, 202)
+		var submitted struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(response.Body.Bytes(), &submitted); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+
+		job := waitForJob(t, server, submitted.ID)
+		assertResponseBody(t, string(job["stage"]), "\"failed\"")
+		assertResponseBody(t, string(job["error"]), "\"internal server error\"")
 	})
 
 	t.Run("api get home 200", func(t *testing.T) {
@@ -118,8 +206,8 @@ func TestAcceptance(t *testing.T) {
 		request := httptest.NewRequest("GET", "/home", http.NoBody)
 		response := httptest.NewRecorder()
 		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Minute)})
-		playlistController := usecases.NewPlaylistController(discogsServiceMock, spotifyServiceMock)
-		server := NewServer(playlistController, oauthController, userController, sessionMock)
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
 		fmt.Println(os.Getwd())
 		server.ServeHTTP(response, request)
 
@@ -131,8 +219,8 @@ func TestAcceptance(t *testing.T) {
 		request := httptest.NewRequest("GET", "/home", http.NoBody)
 		response := httptest.NewRecorder()
 		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Second)})
-		playlistController := usecases.NewPlaylistController(discogsServiceMock, spotifyServiceMock)
-		server := NewServer(playlistController, oauthController, userController, sessionMock)
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
 
 		time.Sleep(1 * time.Second)
 		server.ServeHTTP(response, request)
@@ -140,14 +228,197 @@ func TestAcceptance(t *testing.T) {
 		assertResponseStatus(t, response.Code, 302)
 	})
 
+	t.Run("api get home 200 refreshes expired token", func(t *testing.T) {
+		sessionMock := initSessionMock()
+		request := httptest.NewRequest("GET", "/home", http.NoBody)
+		response := httptest.NewRecorder()
+		expired := &oauth2.Token{AccessToken: "test", RefreshToken: "refresh_token", Expiry: time.Now().Add(-time.Minute)}
+		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, expired)
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		refreshingController := usecases.NewSpotifyAuthenticateWithConfig(&stubOAuth2Config{})
+		server := NewServer(playlistJobs, refreshingController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+
+		server.ServeHTTP(response, request)
+
+		assertResponseStatus(t, response.Code, 200)
+		stored, _ := sessionMock.GetData(request, session.SpotifyTokenKey)
+		if stored.(*oauth2.Token).AccessToken != "refreshed" {
+			t.Errorf("got %s, want refreshed token stored in session", stored.(*oauth2.Token).AccessToken)
+		}
+	})
+
+	t.Run("api get home writes back a token refreshed by a job", func(t *testing.T) {
+		sessionMock := initSessionMock()
+		request := httptest.NewRequest("GET", "/home", http.NoBody)
+		response := httptest.NewRecorder()
+		stale := &oauth2.Token{AccessToken: "test", RefreshToken: "job_refresh_token", Expiry: time.Now().Add(time.Minute)}
+		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, stale)
+		ginCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		SetContextValue(ginCtx, session.SpotifyTokenKey, stale)
+		SetContextValue(ginCtx, sessionRefreshTokenKey, stale.RefreshToken)
+		refreshed := &oauth2.Token{AccessToken: "refreshed_by_job", RefreshToken: "job_refresh_token", Expiry: time.Now().Add(time.Hour)}
+		if err := NewGinContextProvider().SetToken(DetachedContext(ginCtx), refreshed); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+
+		server.ServeHTTP(response, request)
+
+		assertResponseStatus(t, response.Code, 200)
+		stored, _ := sessionMock.GetData(request, session.SpotifyTokenKey)
+		if stored.(*oauth2.Token).AccessToken != "refreshed_by_job" {
+			t.Errorf("got %s, want the token refreshed by the job stored in session", stored.(*oauth2.Token).AccessToken)
+		}
+	})
+
+	t.Run("api collection folders", func(t *testing.T) {
+		sessionMock := initSessionMock()
+		request := httptest.NewRequest("GET", "/collection/folders?discogs_url=https://www.discogs.com/user/digger/collection", http.NoBody)
+		response := httptest.NewRecorder()
+		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Hour)})
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		foldersController := usecases.NewGetDiscogsFolders(&discogs.ServiceMock{
+			Folders: []entities.DiscogsFolder{{ID: 0, Name: "All", Count: 2}, {ID: 123, Name: "Jazz", Count: 1}},
+		})
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 200)
+		want := "[{\"count\":2,\"id\":0,\"name\":\"All\"},{\"count\":1,\"id\":123,\"name\":\"Jazz\"}]"
+		assertResponseBody(t, response.Body.String(), want)
+
+		request = httptest.NewRequest("GET", "/collection/folders?discogs_url=https://www.discogs.com/wantlist?user=digger", http.NoBody)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 400)
+	})
+
+	t.Run("api overrides save list and delete", func(t *testing.T) {
+		sessionMock := initSessionMock()
+		request := httptest.NewRequest("PUT", "/overrides/123", strings.NewReader("spotify_album=https://open.spotify.com/album/"+entities.SpotifyAlbumIDRooms+"?si=abc"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Hour)})
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		overridesController := usecases.NewMatchOverrides(overrides.NewInMemoryStore())
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 200)
+
+		request = httptest.NewRequest("PUT", "/overrides/456", strings.NewReader("skip=true"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 200)
+
+		request = httptest.NewRequest("PUT", "/overrides/789", strings.NewReader("spotify_album=https://open.spotify.com/track/"+entities.SpotifyAlbumIDRooms))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 400)
+
+		request = httptest.NewRequest("DELETE", "/overrides/456", http.NoBody)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 204)
+
+		request = httptest.NewRequest("GET", "/overrides", http.NoBody)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 200)
+		want := "[{\"discogs_id\":123,\"skip\":false,\"spotify_album_id\":\"" + entities.SpotifyAlbumIDRooms + "\"}]"
+		assertResponseBody(t, response.Body.String(), want)
+	})
+
+	t.Run("api schedules save list and delete", func(t *testing.T) {
+		sessionMock := initSessionMock()
+		request := httptest.NewRequest("PUT", "/schedules", strings.NewReader("discogs_url=https://www.discogs.com/user/digger/collection&interval=weekly"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Hour)})
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 200)
+		if strings.Contains(response.Body.String(), "token") {
+			t.Errorf("got %s, want the token left out", response.Body.String())
+		}
+
+		request = httptest.NewRequest("PUT", "/schedules", strings.NewReader("discogs_url=https://www.discogs.com/user/digger/wantlist&interval=monthly"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 400)
+
+		request = httptest.NewRequest("GET", "/schedules", http.NoBody)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 200)
+		var listed []map[string]any
+		if err := json.Unmarshal(response.Body.Bytes(), &listed); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if len(listed) != 1 || listed[0]["source"] != "collection/digger" || listed[0]["interval"] != "weekly" {
+			t.Errorf("got %v, want the weekly collection/digger schedule", listed)
+		}
+
+		request = httptest.NewRequest("DELETE", "/schedules/collection/digger", http.NoBody)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 204)
+
+		request = httptest.NewRequest("DELETE", "/schedules/collection/digger", http.NoBody)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 404)
+	})
+
+	t.Run("auth discogs link and unlink personal token", func(t *testing.T) {
+		sessionMock := initSessionMock()
+		request := httptest.NewRequest("PUT", "/auth/discogs/token", strings.NewReader("token=revoked_token"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
+
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 400)
+
+		request = httptest.NewRequest("PUT", "/auth/discogs/token", strings.NewReader("token=personal_token"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 200)
+		assertResponseBody(t, response.Body.String(), `{"linked":true,"oauth":false,"username":"martireir"}`)
+
+		request = httptest.NewRequest("GET", "/auth/discogs/login", http.NoBody)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 404)
+
+		request = httptest.NewRequest("DELETE", "/auth/discogs", http.NoBody)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 204)
+
+		request = httptest.NewRequest("GET", "/auth/discogs", http.NoBody)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 200)
+		assertResponseBody(t, response.Body.String(), `{"linked":false,"oauth":false}`)
+	})
+
 	t.Run("api get home 302 expired session", func(t *testing.T) {
 		sessionMock := initSessionMock()
 		sessionMock.Init(1)
 		request := httptest.NewRequest("GET", "/home", http.NoBody)
 		response := httptest.NewRecorder()
 		setSessionData(t, sessionMock, request, response, session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", Expiry: time.Now().Add(time.Minute)})
-		playlistController := usecases.NewPlaylistController(discogsServiceMock, spotifyServiceMock)
-		server := NewServer(playlistController, oauthController, userController, sessionMock)
+		playlistJobs := newPlaylistJobs(t, discogsServiceMock, spotifyServiceMock)
+		server := NewServer(playlistJobs, oauthController, discogsAuth, userController, foldersController, overridesController, newSyncScheduler(playlistJobs), sessionMock)
 
 		// TODO: Find a way to avoid sleep
 		time.Sleep(2 * time.Second)
@@ -157,6 +428,21 @@ func TestAcceptance(t *testing.T) {
 	})
 }
 
+// stubOAuth2Config refreshes every token without calling Spotify
+type stubOAuth2Config struct{}
+
+func (*stubOAuth2Config) AuthCodeURL(_ string, _ ...oauth2.AuthCodeOption) string {
+	return ""
+}
+
+func (*stubOAuth2Config) Exchange(_ context.Context, _ string, _ ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	return nil, nil
+}
+
+func (*stubOAuth2Config) TokenSource(_ context.Context, _ *oauth2.Token) oauth2.TokenSource {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "refreshed", Expiry: time.Now().Add(time.Hour)})
+}
+
 func assertResponseStatus(t testing.TB, got, want int) {
 	t.Helper()
 	if got != want {
@@ -171,6 +457,42 @@ func assertResponseBody(t testing.TB, got, want string) {
 	}
 }
 
+func newPlaylistJobs(t testing.TB, discogsService ports.DiscogsPort, spotifyService ports.SpotifyPort) *usecases.PlaylistJobs {
+	t.Helper()
+	playlistController := usecases.NewPlaylistController(discogsService, spotifyService)
+	playlistJobs := usecases.NewPlaylistJobs(playlistController, jobs.NewInMemoryStore(), 1)
+	t.Cleanup(func() { playlistJobs.Close(context.Background()) })
+	return playlistJobs
+}
+
+func newSyncScheduler(playlistJobs *usecases.PlaylistJobs) *usecases.SyncScheduler {
+	return usecases.NewSyncScheduler(playlistJobs, schedules.NewInMemoryStore(), NewGinContextProvider(), NewDetachedContext, time.Minute)
+}
+
+// waitForJob polls the job endpoint until the job finishes, reusing the session of the last request
+func waitForJob(t testing.TB, server *Server, id string) map[string]json.RawMessage {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		request := httptest.NewRequest("GET", "/jobs/"+id, http.NoBody)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatus(t, response.Code, 200)
+
+		var job map[string]json.RawMessage
+		if err := json.Unmarshal(response.Body.Bytes(), &job); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		stage := string(job["stage"])
+		if stage == "\"done\"" || stage == "\"failed\"" {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish in time", id)
+	return nil
+}
+
 func initSessionMock() *session.InMemorySession {
 	sessionMock := session.NewInMemorySession()
 	sessionMock.Init(90)
@@ -19,7 +19,7 @@ func authUserMiddleware(uc usecases.GetSpotifyUser) gin.HandlerFunc {
 		userID, err := uc.GetUserID(ctx)
 
 		if err != nil || userID == "" {
-			ctx.Redirect(http.StatusFound, "/auth/login")
+			ctx.Redirect(http.StatusFound, loginURL(ctx))
 			ctx.Abort()
 			return
 		}
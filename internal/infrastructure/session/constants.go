@@ -9,4 +9,21 @@ type ContextKey string
 const (
 	SpotifyTokenKey  ContextKey = "spotify-token"
 	SpotifyUserIDKey ContextKey = "spotify-user-id"
+	LoginStateKey    ContextKey = "login-state"
+
+	DiscogsCredentialsKey ContextKey = "discogs-credentials"
+	DiscogsLoginKey       ContextKey = "discogs-login"
 )
+
+// LoginState is kept in the session between the login redirect and the OAuth callback
+type LoginState struct {
+	State    string
+	ReturnTo string
+	Verifier string // PKCE code verifier, only set on the PKCE flow
+}
+
+// DiscogsLoginState keeps the request token of a Discogs login until the user authorizes it
+type DiscogsLoginState struct {
+	Token  string
+	Secret string
+}
@@ -1,12 +1,15 @@
 package session
 
 import (
+	"crypto/sha256"
 	"encoding/gob"
 	"net/http"
 	"os"
 
 	"github.com/gorilla/sessions"
 	"golang.org/x/oauth2"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
 )
 
 type GorillaSession struct {
@@ -21,10 +24,24 @@ func NewGorillaSession() *GorillaSession {
 
 func (gs *GorillaSession) Init(maxAgeSecs int) {
 	gob.Register(&oauth2.Token{})
-	gs.store = sessions.NewCookieStore([]byte(os.Getenv("SESSION_KEY")))
+	gob.Register(LoginState{})
+	gob.Register(&entities.DiscogsCredentials{})
+	gob.Register(DiscogsLoginState{})
+	gs.store = sessions.NewCookieStore([]byte(os.Getenv("SESSION_KEY")), encryptionKey())
 	gs.store.MaxAge(maxAgeSecs)
 }
 
+// encryptionKey returns the AES-256 key encrypting the cookies, which keep the Spotify token and the linked
+// Discogs credentials. It's derived from SESSION_ENCRYPTION_KEY, or from SESSION_KEY when that isn't set
+func encryptionKey() []byte {
+	secret := os.Getenv("SESSION_ENCRYPTION_KEY")
+	if secret == "" {
+		secret = "encryption " + os.Getenv("SESSION_KEY")
+	}
+	key := sha256.Sum256([]byte(secret))
+	return key[:]
+}
+
 func (gs *GorillaSession) Get(r *http.Request, sessionName string) (map[any]any, error) {
 	session, err := gs.store.Get(r, sessionName)
 	if err != nil {
@@ -42,8 +59,9 @@ func (gs *GorillaSession) GetData(r *http.Request, key ContextKey) (any, error)
 }
 
 func (gs *GorillaSession) SetData(r *http.Request, w http.ResponseWriter, key ContextKey, value any) error {
+	// a cookie that can't be decoded anymore, like one saved before the keys changed, is replaced by a new session
 	session, err := gs.store.Get(r, AuthSessionName)
-	if err != nil {
+	if session == nil {
 		return err
 	}
 	session.Values[string(key)] = value
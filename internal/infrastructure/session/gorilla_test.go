@@ -0,0 +1,61 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+)
+
+func TestGorillaSessionEncryptsCookies(t *testing.T) {
+	t.Setenv("SESSION_KEY", "session_key")
+	s := NewGorillaSession()
+	s.Init(60)
+
+	recorder := httptest.NewRecorder()
+	credentials := &entities.DiscogsCredentials{Username: "digger", PersonalToken: "personal-token"}
+	err := s.SetData(httptest.NewRequest(http.MethodGet, "/", http.NoBody), recorder, DiscogsCredentialsKey, credentials)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+
+	// a cookie only signed with the session key would decode
+	values := map[any]any{}
+	signedOnly := securecookie.New([]byte("session_key"), nil)
+	if err := signedOnly.Decode(AuthSessionName, cookies[0].Value, &values); err == nil {
+		t.Errorf("got the session decoded without the encryption key: %v", values)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	r.AddCookie(cookies[0])
+	data, err := s.GetData(r, DiscogsCredentialsKey)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if got, ok := data.(*entities.DiscogsCredentials); !ok || got.PersonalToken != "personal-token" {
+		t.Errorf("got %v, want %v", data, credentials)
+	}
+}
+
+func TestGorillaSessionReplacesUndecodableCookies(t *testing.T) {
+	t.Setenv("SESSION_KEY", "session_key")
+	s := NewGorillaSession()
+	s.Init(60)
+
+	r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	r.AddCookie(&http.Cookie{Name: AuthSessionName, Value: "saved-with-other-keys"})
+	recorder := httptest.NewRecorder()
+	if err := s.SetData(r, recorder, LoginStateKey, LoginState{}); err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if len(recorder.Result().Cookies()) != 1 {
+		t.Error("expected a new session cookie")
+	}
+}
@@ -0,0 +1,51 @@
+package syncs
+
+import (
+	"context"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/jsonstore"
+)
+
+// Store keeps the synced playlists by user and Discogs source
+type Store struct {
+	syncs *jsonstore.Store[entities.PlaylistSync]
+}
+
+func NewInMemoryStore() *Store {
+	return &Store{syncs: jsonstore.New("playlist syncs", syncKey)}
+}
+
+// NewFileStore loads the playlists saved at path, which doesn't need to exist yet
+func NewFileStore(path string) (*Store, error) {
+	syncs, err := jsonstore.Open(path, "playlist syncs", syncKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{syncs: syncs}, nil
+}
+
+func (s *Store) Get(_ context.Context, userID, source string) (*entities.PlaylistSync, error) {
+	playlistSync, exists := s.syncs.Get(userID, source)
+	if !exists {
+		return nil, errorWrapper.Wrap(errorWrapper.ErrNotFound, "playlist sync "+source)
+	}
+	playlistSync = clone(playlistSync)
+	return &playlistSync, nil
+}
+
+func (s *Store) Save(_ context.Context, playlistSync *entities.PlaylistSync) error {
+	return s.syncs.Save(clone(*playlistSync))
+}
+
+func syncKey(playlistSync *entities.PlaylistSync) (userID, key string) {
+	return playlistSync.UserID, playlistSync.Source
+}
+
+// clone copies the albums and tracks so callers can't change the stored playlist
+func clone(playlistSync entities.PlaylistSync) entities.PlaylistSync {
+	playlistSync.AlbumIDs = append([]string(nil), playlistSync.AlbumIDs...)
+	playlistSync.TrackURIs = append([]string(nil), playlistSync.TrackURIs...)
+	return playlistSync
+}
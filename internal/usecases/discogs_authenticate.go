@@ -0,0 +1,146 @@
+package usecases
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
+)
+
+var (
+	ErrDiscogsOAuthDisabled = errors.New("discogs: login with discogs is not configured")
+	ErrDiscogsLoginMismatch = errors.New("discogs: callback doesn't match the login")
+	ErrDiscogsLoginDenied   = errors.New("discogs: login denied")
+	ErrInvalidDiscogsToken  = errors.New("discogs: invalid personal access token")
+	ErrSavingDiscogsAccount = errors.New("discogs: error saving the linked account")
+	ErrRejectedDiscogsLink  = errors.New("discogs: credentials rejected")
+)
+
+// DiscogsAuthenticate links the Discogs account of the user to the session, with an OAuth 1.0a login
+// or a personal access token, so Discogs requests can read their private collection and wantlist
+type DiscogsAuthenticate struct {
+	auth        ports.DiscogsAuthPort
+	callbackURL string
+}
+
+// NewDiscogsAuthenticate creates a DiscogsAuthenticate, callbackURL is empty when the application
+// has no Discogs consumer key and only personal tokens can be linked
+func NewDiscogsAuthenticate(auth ports.DiscogsAuthPort, callbackURL string) *DiscogsAuthenticate {
+	return &DiscogsAuthenticate{auth: auth, callbackURL: callbackURL}
+}
+
+func (d *DiscogsAuthenticate) OAuthEnabled() bool {
+	return d.callbackURL != ""
+}
+
+// StartLogin stores a request token in the session and returns the Discogs URL the user has to authorize it on
+func (d *DiscogsAuthenticate) StartLogin(ctx *gin.Context, s ports.SessionPort) (string, error) {
+	if !d.OAuthEnabled() {
+		return "", ErrDiscogsOAuthDisabled
+	}
+
+	token, secret, err := d.auth.RequestToken(ctx, d.callbackURL)
+	if err != nil {
+		return "", err
+	}
+	loginState := session.DiscogsLoginState{Token: token, Secret: secret}
+	if err := s.SetData(ctx.Request, ctx.Writer, session.DiscogsLoginKey, loginState); err != nil {
+		return "", errors.Wrap(ErrSavingDiscogsAccount, err.Error())
+	}
+	return d.auth.AuthorizeURL(token), nil
+}
+
+// CompleteLogin exchanges the request token of the login in the session, which can only be used once,
+// for the credentials of the user and links them
+func (d *DiscogsAuthenticate) CompleteLogin(ctx *gin.Context, s ports.SessionPort) (*entities.DiscogsCredentials, error) {
+	data, err := s.GetData(ctx.Request, session.DiscogsLoginKey)
+	if err != nil {
+		return nil, ErrDiscogsLoginMismatch
+	}
+	loginState, _ := data.(session.DiscogsLoginState)
+	if err := s.SetData(ctx.Request, ctx.Writer, session.DiscogsLoginKey, session.DiscogsLoginState{}); err != nil {
+		return nil, errors.Wrap(ErrSavingDiscogsAccount, err.Error())
+	}
+
+	values := ctx.Request.URL.Query()
+	if values.Get("denied") != "" {
+		return nil, ErrDiscogsLoginDenied
+	}
+	if loginState.Token == "" || values.Get("oauth_token") != loginState.Token {
+		return nil, ErrDiscogsLoginMismatch
+	}
+	verifier := values.Get("oauth_verifier")
+	if verifier == "" {
+		return nil, ErrDiscogsLoginDenied
+	}
+
+	credentials, err := d.auth.AccessToken(ctx, loginState.Token, loginState.Secret, verifier)
+	if err != nil {
+		return nil, err
+	}
+	return d.link(ctx, s, credentials)
+}
+
+// LinkPersonalToken links the account of a personal access token, once Discogs accepts it
+func (d *DiscogsAuthenticate) LinkPersonalToken(
+	ctx *gin.Context,
+	s ports.SessionPort,
+	token string,
+) (*entities.DiscogsCredentials, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrInvalidDiscogsToken
+	}
+
+	credentials, err := d.link(ctx, s, &entities.DiscogsCredentials{PersonalToken: token})
+	if errors.Is(err, ErrRejectedDiscogsLink) {
+		return nil, ErrInvalidDiscogsToken
+	}
+	return credentials, err
+}
+
+// LinkedAccount returns the credentials linked to the session, nil when there are none
+func (*DiscogsAuthenticate) LinkedAccount(ctx *gin.Context, s ports.SessionPort) (*entities.DiscogsCredentials, error) {
+	data, err := s.GetData(ctx.Request, session.DiscogsCredentialsKey)
+	if err != nil {
+		return nil, err
+	}
+	credentials, _ := data.(*entities.DiscogsCredentials)
+	if !credentials.Linked() {
+		return nil, nil
+	}
+	return credentials, nil
+}
+
+func (*DiscogsAuthenticate) Unlink(ctx *gin.Context, s ports.SessionPort) error {
+	if err := s.SetData(ctx.Request, ctx.Writer, session.DiscogsCredentialsKey, &entities.DiscogsCredentials{}); err != nil {
+		return errors.Wrap(ErrSavingDiscogsAccount, err.Error())
+	}
+	return nil
+}
+
+// link checks the credentials with Discogs, which also tells the account they belong to, and stores them
+func (d *DiscogsAuthenticate) link(
+	ctx *gin.Context,
+	s ports.SessionPort,
+	credentials *entities.DiscogsCredentials,
+) (*entities.DiscogsCredentials, error) {
+	username, err := d.auth.Identity(ctx, credentials)
+	if err != nil {
+		if errorWrapper.Is(err, errorWrapper.ErrUnauthorized) {
+			return nil, errors.Wrap(ErrRejectedDiscogsLink, err.Error())
+		}
+		return nil, err
+	}
+	credentials.Username = username
+
+	if err := s.SetData(ctx.Request, ctx.Writer, session.DiscogsCredentialsKey, credentials); err != nil {
+		return nil, errors.Wrap(ErrSavingDiscogsAccount, err.Error())
+	}
+	return credentials, nil
+}
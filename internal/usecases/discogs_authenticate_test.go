@@ -0,0 +1,145 @@
+package usecases
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/martiriera/discogs-spotify/internal/adapters/discogs"
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
+)
+
+const testDiscogsCallback = "http://localhost:8080/auth/discogs/callback"
+
+func newDiscogsAuthenticate() *DiscogsAuthenticate {
+	auth := &discogs.AuthServiceMock{Tokens: map[string]string{
+		"personal_token": "digger",
+		"request_token":  "digger",
+	}}
+	return NewDiscogsAuthenticate(auth, testDiscogsCallback)
+}
+
+func newTestGinContext(target string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", target, http.NoBody)
+	return ctx
+}
+
+func TestDiscogsAuthenticate_LinkPersonalToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "valid token", token: " personal_token "},
+		{name: "rejected token", token: "revoked_token", wantErr: ErrInvalidDiscogsToken},
+		{name: "empty token", token: "", wantErr: ErrInvalidDiscogsToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newDiscogsAuthenticate()
+			s := &mockSession{}
+			ctx := newTestGinContext("/auth/discogs/token")
+
+			credentials, err := auth.LinkPersonalToken(ctx, s, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			linked, _ := auth.LinkedAccount(ctx, s)
+			if tt.wantErr != nil {
+				if linked != nil {
+					t.Errorf("got linked account %v, want none", linked)
+				}
+				return
+			}
+			if credentials.PersonalToken != "personal_token" || credentials.Username != "digger" {
+				t.Errorf("got credentials %v, want the token of digger", credentials)
+			}
+			if linked != credentials {
+				t.Errorf("got linked account %v, want %v", linked, credentials)
+			}
+		})
+	}
+}
+
+func TestDiscogsAuthenticate_Login(t *testing.T) {
+	auth := newDiscogsAuthenticate()
+	s := &mockSession{}
+
+	authURL, err := auth.StartLogin(newTestGinContext("/auth/discogs/login"), s)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if authURL != "https://www.discogs.com/oauth/authorize?oauth_token=request_token" {
+		t.Errorf("got authorize URL %s", authURL)
+	}
+
+	ctx := newTestGinContext("/auth/discogs/callback?oauth_token=request_token&oauth_verifier=verifier")
+	credentials, err := auth.CompleteLogin(ctx, s)
+	if err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if !credentials.IsOAuth() || credentials.Username != "digger" {
+		t.Errorf("got credentials %v, want the OAuth token of digger", credentials)
+	}
+
+	// the request token can only be used once
+	if _, err := auth.CompleteLogin(ctx, s); !errors.Is(err, ErrDiscogsLoginMismatch) {
+		t.Errorf("got error %v, want %v", err, ErrDiscogsLoginMismatch)
+	}
+}
+
+func TestDiscogsAuthenticate_CompleteLoginErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		wantErr error
+	}{
+		{name: "denied", target: "/auth/discogs/callback?denied=request_token", wantErr: ErrDiscogsLoginDenied},
+		{name: "no verifier", target: "/auth/discogs/callback?oauth_token=request_token", wantErr: ErrDiscogsLoginDenied},
+		{
+			name:    "another token",
+			target:  "/auth/discogs/callback?oauth_token=other_token&oauth_verifier=verifier",
+			wantErr: ErrDiscogsLoginMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockSession{data: map[session.ContextKey]any{
+				session.DiscogsLoginKey: session.DiscogsLoginState{Token: "request_token", Secret: "request_secret"},
+			}}
+			if _, err := newDiscogsAuthenticate().CompleteLogin(newTestGinContext(tt.target), s); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiscogsAuthenticate_OAuthDisabled(t *testing.T) {
+	auth := NewDiscogsAuthenticate(&discogs.AuthServiceMock{}, "")
+	if _, err := auth.StartLogin(newTestGinContext("/auth/discogs/login"), &mockSession{}); !errors.Is(err, ErrDiscogsOAuthDisabled) {
+		t.Errorf("got error %v, want %v", err, ErrDiscogsOAuthDisabled)
+	}
+}
+
+func TestDiscogsAuthenticate_Unlink(t *testing.T) {
+	auth := newDiscogsAuthenticate()
+	s := &mockSession{data: map[session.ContextKey]any{
+		session.DiscogsCredentialsKey: &entities.DiscogsCredentials{PersonalToken: "personal_token", Username: "digger"},
+	}}
+	ctx := newTestGinContext("/auth/discogs")
+
+	if err := auth.Unlink(ctx, s); err != nil {
+		t.Fatalf("did not expect error, got %v", err)
+	}
+	if linked, err := auth.LinkedAccount(ctx, s); err != nil || linked != nil {
+		t.Errorf("got linked account %v, %v, want none", linked, err)
+	}
+}
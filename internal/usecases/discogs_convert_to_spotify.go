@@ -2,7 +2,8 @@ package usecases
 
 import (
 	"context"
-	"fmt"
+	"log"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -10,141 +11,543 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
 	"github.com/martiriera/discogs-spotify/internal/core/ports"
 )
 
 const (
-	spotifyAPIRateLimit = 200 * time.Millisecond
+	// spotifyAPIRateLimit paces the searches of converters without a shared limiter
+	spotifyAPIRateLimit  = 200 * time.Millisecond
+	defaultSearchWorkers = 4
 )
 
+// ConverterOptions tunes how releases are matched on Spotify, zero values keep the defaults
+type ConverterOptions struct {
+	Matcher   *entities.AlbumMatcher
+	Overrides ports.OverridePort   // user overrides, none when nil
+	Cache     ports.MatchCachePort // matches of previous conversions, every release is searched when nil
+	Limiter   ports.RateLimitPort  // paces the Spotify searches, shared with the other conversions
+	Workers   int                  // Spotify searches running at once
+}
+
 type DiscogsConvertToSpotify struct {
 	spotifyService ports.SpotifyPort
+	matcher        *entities.AlbumMatcher
+	overrides      ports.OverridePort
+	cache          ports.MatchCachePort
+	limiter        ports.RateLimitPort
+	workers        int
 }
 
 func NewDiscogsConvertToSpotify(s ports.SpotifyPort) *DiscogsConvertToSpotify {
-	return &DiscogsConvertToSpotify{spotifyService: s}
+	return NewDiscogsConvertToSpotifyWithOptions(s, ConverterOptions{})
 }
 
-func (c *DiscogsConvertToSpotify) getSpotifyAlbumIDs(ctx context.Context, releases []entities.DiscogsRelease) ([]string, error) {
-	urisChan := make(chan string, len(releases))
-	errChan := make(chan error, len(releases))
+func NewDiscogsConvertToSpotifyWithOptions(s ports.SpotifyPort, options ConverterOptions) *DiscogsConvertToSpotify {
+	matcher := options.Matcher
+	if matcher == nil {
+		matcher = entities.NewAlbumMatcher(entities.DefaultMatchThreshold)
+	}
+	limiter := options.Limiter
+	if limiter == nil {
+		limiter = &intervalLimiter{interval: spotifyAPIRateLimit}
+	}
+	workers := options.Workers
+	if workers <= 0 {
+		workers = defaultSearchWorkers
+	}
+	return &DiscogsConvertToSpotify{
+		spotifyService: s,
+		matcher:        matcher,
+		overrides:      options.Overrides,
+		cache:          options.Cache,
+		limiter:        limiter,
+		workers:        workers,
+	}
+}
 
-	var wg sync.WaitGroup
-	rateLimiter := time.Tick(spotifyAPIRateLimit)
+// matchReleases looks up every release on Spotify with a pool of workers, returning their matches in the
+// same order. A failed search only fails its release, the run fails when ctx is done or every search failed
+func (c *DiscogsConvertToSpotify) matchReleases(
+	ctx context.Context,
+	releases []entities.DiscogsRelease,
+	progress ProgressFunc,
+) ([]entities.ReleaseMatch, error) {
+	in := make(chan entities.DiscogsRelease)
+	out := make(chan entities.ReleaseMatch)
+	go func() {
+		defer close(in)
+		for i := range releases {
+			select {
+			case in <- releases[i]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-	for _, release := range releases {
-		album := getAlbumFromRelease(&release)
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-rateLimiter:
-			wg.Add(1)
-			go func(album entities.Album) {
-				defer wg.Done()
-				albums, err := c.spotifyService.SearchAlbum(ctx, album)
-				if albums == nil {
-					return
-				}
-				if err != nil {
-					errChan <- errors.Wrap(err, "error getting album id")
-					return
-				}
-				uri := getMatchingAlbumURI(album, albums)
-				urisChan <- uri
-			}(album)
+	matches := make([]entities.ReleaseMatch, 0, len(releases))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for match := range out {
+			matches = append(matches, match)
 		}
+	}()
+
+	err := c.streamMatches(ctx, in, out, progress)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// streamMatches looks up the releases received on in with a pool of workers while they keep coming,
+// sending their matches to out in the same order and closing out once every release is matched.
+// A failed search only fails its release, the run fails when ctx is done or every search failed
+func (c *DiscogsConvertToSpotify) streamMatches(
+	ctx context.Context,
+	in <-chan entities.DiscogsRelease,
+	out chan<- entities.ReleaseMatch,
+	progress ProgressFunc,
+) error {
+	defer close(out)
+	overrides, err := c.userOverrides(ctx)
+	if err != nil {
+		return err
 	}
+	market := c.userMarket(ctx)
 
+	// matches are queued in the order of the releases and sent once their search is done
+	queue := make(chan *pendingMatch, c.workers)
+	sent := make(chan struct{})
 	go func() {
-		wg.Wait()
-		close(urisChan)
-		close(errChan)
+		defer close(sent)
+		for pending := range queue {
+			<-pending.done
+			select {
+			case out <- pending.match:
+			case <-ctx.Done():
+			}
+		}
 	}()
 
-	var uris []string
-	for uri := range urisChan {
-		uris = append(uris, uri)
+	var mu sync.Mutex
+	searched := 0
+	failed := []error{}
+	searches := make(chan *pendingMatch)
+	var wg sync.WaitGroup
+	for range c.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pending := range searches {
+				result := &pending.match
+				if err := c.search(ctx, result, pending.search); err != nil {
+					mu.Lock()
+					failed = append(failed, err)
+					mu.Unlock()
+					*result = entities.ReleaseMatch{DiscogsID: result.DiscogsID, Album: result.Album, Reason: entities.MatchSearchFailed}
+					log.Printf("error searching %s - %s on spotify: %v", result.Album.Artist, result.Album.Title, err)
+				}
+				progress.report(matchProgressEvent(result))
+				close(pending.done)
+			}
+		}()
 	}
 
-	var errs []error
-	for err := range errChan {
-		errs = append(errs, err)
+	for release := range in {
+		pending := &pendingMatch{
+			match: entities.ReleaseMatch{
+				DiscogsID: release.BasicInformation.ID,
+				Album:     getAlbumFromRelease(&release),
+			},
+			done: make(chan struct{}),
+		}
+		if err = c.enqueue(ctx, queue, searches, pending, overrides, market, &release, progress); err != nil {
+			break
+		}
+		if pending.searched {
+			searched++
+		}
 	}
-	if len(errs) > 0 {
-		return nil, fmt.Errorf("encountered errors: %v", errs)
+	close(searches)
+	wg.Wait()
+	close(queue)
+	<-sent
+
+	if err != nil {
+		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if searched > 0 && len(failed) == searched {
+		return errors.Wrapf(failed[0], "every spotify search failed, %d errors", len(failed))
+	}
+	return nil
+}
 
-	return uris, nil
+// pendingMatch is the match of a release, done once its search is
+type pendingMatch struct {
+	match    entities.ReleaseMatch
+	search   releaseSearch
+	searched bool
+	done     chan struct{}
 }
 
-func getAlbumFromRelease(release *entities.DiscogsRelease) entities.Album {
-	// TODO: Move this logic to domain
-	// David Bowie Hunky Dory = A Pedir De Boca = A Pedir De Boca
-	artistName := release.BasicInformation.Artists[0].Name
-	artistName = strings.TrimSpace(strings.Split(artistName, " (")[0])
+// enqueue queues the match of the release and hands its search to the workers, overridden and
+// cached releases don't need a search so they don't wait for the rate limiter. Albums without
+// an artist can't be searched, they are left unmatched
+func (c *DiscogsConvertToSpotify) enqueue(
+	ctx context.Context,
+	queue chan<- *pendingMatch,
+	searches chan<- *pendingMatch,
+	pending *pendingMatch,
+	overrides map[int]entities.MatchOverride,
+	market string,
+	release *entities.DiscogsRelease,
+	progress ProgressFunc,
+) error {
+	select {
+	case queue <- pending:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
-	titleName := release.BasicInformation.Title
-	titleName = strings.TrimSpace(strings.Split(titleName, " (")[0])
+	result := &pending.match
+	if override, exists := overrides[result.DiscogsID]; exists {
+		applyOverride(result, override)
+		progress.report(matchProgressEvent(result))
+		close(pending.done)
+		return nil
+	}
+	search := releaseSearch{cacheKey: c.matchCacheKey(market, release), tracks: releaseTracks(release)}
+	if result.Album.Artist == "" && len(search.tracks) == 0 {
+		result.Reason = entities.MatchNoArtist
+		progress.report(matchProgressEvent(result))
+		close(pending.done)
+		return nil
+	}
+	if c.applyCachedMatch(ctx, search.cacheKey, result) {
+		progress.report(matchProgressEvent(result))
+		close(pending.done)
+		return nil
+	}
 
-	album := entities.Album{
-		Artist: artistName,
-		Title:  titleName,
-		Year:   release.BasicInformation.Year,
+	// a queued match that won't be searched is done already, so the queue doesn't wait for it
+	err := c.wait(ctx)
+	if err == nil {
+		pending.search = search
+		select {
+		case searches <- pending:
+			pending.searched = true
+			return nil
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
 	}
-	return album
+	close(pending.done)
+	return err
 }
 
-// compares album name and artist from Discogs with Spotify to discard unrelated albums
-func getMatchingAlbumURI(album entities.Album, spotifyAlbums []entities.SpotifyAlbumItem) string {
-	inputArtist := normalizeName(album.Artist)
-	inputAlbumName := normalizeName(album.Title)
+// releaseSearch is a release to look up on Spotify, track by track when it has tracks
+type releaseSearch struct {
+	cacheKey string
+	tracks   []entities.Track
+}
+
+// search matches the release on Spotify and caches the match
+func (c *DiscogsConvertToSpotify) search(ctx context.Context, result *entities.ReleaseMatch, search releaseSearch) error {
+	if len(search.tracks) > 0 {
+		if err := c.matchTracks(ctx, result, search.tracks); err != nil {
+			return err
+		}
+	} else {
+		albums, err := c.spotifyService.SearchAlbum(ctx, result.Album)
+		if err != nil {
+			return errors.Wrap(err, "error searching album")
+		}
+		c.matchAlbum(result, albums)
+	}
+	c.cacheMatch(ctx, search.cacheKey, result)
+	return nil
+}
 
-	// Case 1: Exact artist and album name match
-	for i := range spotifyAlbums {
-		spotifyAlbum := &spotifyAlbums[i]
-		normalizedSpotifyAlbumName := normalizeName(spotifyAlbum.Name)
+// matchAlbum scores the Spotify albums found for the release and keeps the closest one if it's good enough
+func (c *DiscogsConvertToSpotify) matchAlbum(result *entities.ReleaseMatch, albums []entities.SpotifyAlbumItem) {
+	if len(albums) == 0 {
+		result.Reason = entities.MatchNoResults
+		return
+	}
 
-		for _, artist := range spotifyAlbum.Artists {
-			normalizedSpotifyArtist := normalizeName(artist.Name)
+	match, ok := c.matcher.Match(result.Album, albums)
+	result.Candidates = len(albums)
+	result.Score = match.Score
+	if !ok {
+		result.Reason = entities.MatchLowScore
+		return
+	}
+	result.SpotifyAlbumID = match.Album.ID
+}
 
-			if strings.EqualFold(normalizedSpotifyArtist, inputArtist) &&
-				strings.EqualFold(normalizedSpotifyAlbumName, inputAlbumName) {
-				return spotifyAlbum.ID
+// matchTracks searches every track of the release on its own, keeping the ones good enough.
+// The caller waits for the rate limiter before the first search, matchTracks before the others
+func (c *DiscogsConvertToSpotify) matchTracks(
+	ctx context.Context,
+	result *entities.ReleaseMatch,
+	tracks []entities.Track,
+) error {
+	var total, best float64
+	for i, track := range tracks {
+		if i > 0 {
+			if err := c.wait(ctx); err != nil {
+				return err
 			}
 		}
+		items, err := c.spotifyService.SearchTrack(ctx, track)
+		if err != nil {
+			return errors.Wrap(err, "error searching track")
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		result.Candidates++
+		match, ok := c.matcher.MatchTrack(track, items)
+		best = max(best, match.Score)
+		if ok {
+			result.TrackURIs = append(result.TrackURIs, match.Track.URI)
+			total += match.Score
+		}
 	}
 
-	// Case 2: Artist match and at least one word album name match
-	for i := range spotifyAlbums {
-		spotifyAlbum := &spotifyAlbums[i]
-		normalizedSpotifyAlbumName := normalizeName(spotifyAlbum.Name)
+	switch {
+	case len(result.TrackURIs) > 0:
+		result.Score = total / float64(len(result.TrackURIs))
+	case result.Candidates == 0:
+		result.Reason = entities.MatchNoResults
+	default:
+		result.Score = best
+		result.Reason = entities.MatchLowScore
+	}
+	return nil
+}
 
-		for _, artist := range spotifyAlbum.Artists {
-			normalizedSpotifyArtist := normalizeName(artist.Name)
+// wait blocks until the limiter lets the next Spotify search through
+func (c *DiscogsConvertToSpotify) wait(ctx context.Context) error {
+	return c.limiter.Wait(ctx)
+}
 
-			if strings.EqualFold(normalizedSpotifyArtist, inputArtist) {
-				inputWords := strings.Fields(inputAlbumName)
-				spotifyWords := strings.Fields(normalizedSpotifyAlbumName)
+// intervalLimiter lets a search through every interval
+type intervalLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
 
-				for _, inputWord := range inputWords {
-					for _, spotifyWord := range spotifyWords {
-						if strings.EqualFold(inputWord, spotifyWord) && len(inputWord) > 1 {
-							return spotifyAlbum.ID
-						}
-					}
-				}
-			}
+func (l *intervalLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	at := time.Now()
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// releaseTracks returns the tracks to search one by one, none when the release is searched as an album
+func releaseTracks(release *entities.DiscogsRelease) []entities.Track {
+	if !release.MatchByTrack() {
+		return nil
+	}
+	return release.Tracks()
+}
+
+// userOverrides returns the overrides of the current user by Discogs release ID
+func (c *DiscogsConvertToSpotify) userOverrides(ctx context.Context) (map[int]entities.MatchOverride, error) {
+	if c.overrides == nil {
+		return nil, nil
+	}
+
+	userID, err := c.spotifyService.GetUserID(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting spotify user id")
+	}
+	list, err := c.overrides.List(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting match overrides")
+	}
+
+	overrides := make(map[int]entities.MatchOverride, len(list))
+	for _, override := range list {
+		overrides[override.DiscogsID] = override
+	}
+	return overrides, nil
+}
+
+// matchCacheKey keys matches by master when the release has one, so every version of an album shares the match.
+// Releases with barcodes are matched to their exact edition, so they are keyed by release instead.
+// The albums found depend on the market of the user, so matches are only shared within a market
+// and aren't cached at all when it's unknown. The threshold is part of the key too, changing it matches again
+func (c *DiscogsConvertToSpotify) matchCacheKey(market string, release *entities.DiscogsRelease) string {
+	if market == "" {
+		return ""
+	}
+	prefix := market + "-" + strconv.FormatFloat(c.matcher.Threshold(), 'f', -1, 64)
+	if release.BasicInformation.MasterID > 0 && len(release.Barcodes()) == 0 {
+		return prefix + "-master-" + strconv.Itoa(release.BasicInformation.MasterID)
+	}
+	return prefix + "-release-" + strconv.Itoa(release.BasicInformation.ID)
+}
+
+// userMarket gets the market the matches of the user are cached by, empty when there is no cache or it's unknown
+func (c *DiscogsConvertToSpotify) userMarket(ctx context.Context) string {
+	if c.cache == nil {
+		return ""
+	}
+
+	market, err := c.spotifyService.GetUserMarket(ctx)
+	if err != nil {
+		log.Println("error getting spotify market, matches won't be cached", err)
+		return ""
+	}
+	return market
+}
+
+// applyCachedMatch fills the result from the cache, reporting whether it was found
+func (c *DiscogsConvertToSpotify) applyCachedMatch(ctx context.Context, key string, result *entities.ReleaseMatch) bool {
+	if c.cache == nil || key == "" {
+		return false
+	}
+
+	cached, err := c.cache.Get(ctx, key)
+	if err != nil {
+		if !errorWrapper.Is(err, errorWrapper.ErrNotFound) {
+			log.Println("error reading cached match", key, err)
 		}
+		return false
 	}
 
-	// Case 3: All other cases are considered not OK
-	return ""
+	result.SpotifyAlbumID = cached.SpotifyAlbumID
+	result.TrackURIs = append([]string(nil), cached.TrackURIs...)
+	result.Candidates = cached.Candidates
+	result.Score = cached.Score
+	result.Reason = cached.Reason
+	result.Cached = true
+	return true
+}
+
+// cacheMatch saves the result for the following conversions, a failure only costs a new search next time.
+// Misses aren't cached, Spotify may have the album by the next conversion
+func (c *DiscogsConvertToSpotify) cacheMatch(ctx context.Context, key string, result *entities.ReleaseMatch) {
+	if c.cache == nil || key == "" || !result.Matched() {
+		return
+	}
+
+	err := c.cache.Set(ctx, key, &entities.CachedMatch{
+		SpotifyAlbumID: result.SpotifyAlbumID,
+		TrackURIs:      result.TrackURIs,
+		Candidates:     result.Candidates,
+		Score:          result.Score,
+		Reason:         result.Reason,
+	})
+	if err != nil {
+		log.Println("error caching match", key, err)
+	}
+}
+
+func applyOverride(result *entities.ReleaseMatch, override entities.MatchOverride) {
+	result.Overridden = true
+	if override.Skip {
+		result.Reason = entities.MatchSkipped
+		return
+	}
+	result.SpotifyAlbumID = override.SpotifyAlbumID
+	result.Score = 1
+}
+
+func matchProgressEvent(result *entities.ReleaseMatch) entities.ProgressEvent {
+	eventType := entities.ProgressAlbumUnmatched
+	if result.Matched() {
+		eventType = entities.ProgressAlbumMatched
+	}
+	return entities.ProgressEvent{Type: eventType, Album: &result.Album, Score: result.Score}
+}
+
+func anySearchFailed(matches []entities.ReleaseMatch) bool {
+	for i := range matches {
+		if matches[i].Reason == entities.MatchSearchFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// matchedAlbumIDs returns the Spotify album of every release matched as an album
+func matchedAlbumIDs(matches []entities.ReleaseMatch) []string {
+	ids := []string{}
+	for i := range matches {
+		if matches[i].SpotifyAlbumID != "" {
+			ids = append(ids, matches[i].SpotifyAlbumID)
+		}
+	}
+	return ids
+}
+
+// matchedTrackURIs returns the Spotify tracks of every release matched track by track
+func matchedTrackURIs(matches []entities.ReleaseMatch) []string {
+	uris := []string{}
+	for i := range matches {
+		uris = append(uris, matches[i].TrackURIs...)
+	}
+	return uris
 }
 
-// normalizeName removes common suffixes and normalizes the artist name
-func normalizeName(name string) string {
-	name = strings.ToLower(name)
-	name = strings.Split(name, "(")[0]
-	name = strings.TrimSpace(name)
-	return name
+// getAlbumFromRelease builds the album to search, the number of tracks is only known
+// when the tracklist came with the release or its details were fetched. The artist is empty when Discogs credits none
+func getAlbumFromRelease(release *entities.DiscogsRelease) entities.Album {
+	artist := ""
+	if len(release.BasicInformation.Artists) > 0 {
+		artist = entities.CleanDiscogsName(release.BasicInformation.Artists[0].Name)
+	}
+	return entities.Album{
+		Artist:   artist,
+		Title:    entities.CleanDiscogsName(release.BasicInformation.Title),
+		Year:     release.BasicInformation.Year,
+		Tracks:   len(release.Tracks()),
+		Type:     getAlbumType(release.BasicInformation.Formats),
+		Barcodes: release.Barcodes(),
+	}
+}
+
+// getAlbumType maps the Discogs format descriptions to the Spotify album types,
+// Spotify lists EPs as singles
+func getAlbumType(formats []entities.DiscogsFormat) string {
+	descriptions := map[string]bool{}
+	for _, format := range formats {
+		for _, description := range format.Descriptions {
+			descriptions[strings.ToLower(description)] = true
+		}
+	}
+
+	switch {
+	case descriptions["compilation"]:
+		return entities.AlbumTypeCompilation
+	case descriptions["single"], descriptions["ep"], descriptions["maxi-single"]:
+		return entities.AlbumTypeSingle
+	case descriptions["album"], descriptions["lp"], descriptions["mini-album"]:
+		return entities.AlbumTypeAlbum
+	}
+	return ""
 }
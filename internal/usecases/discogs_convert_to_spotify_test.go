@@ -1,9 +1,12 @@
 package usecases
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"golang.org/x/oauth2"
 
 	"github.com/martiriera/discogs-spotify/internal/adapters/spotify"
@@ -15,11 +18,8 @@ import (
 func BenchmarkGetAlbumUris(b *testing.B) {
 	discogsResponses := entities.MotherNAlbums(300)
 	spotifyServiceMock := &spotify.ServiceMock{
-		SearchAlbumResponses: [][]entities.SpotifyAlbumItem{
-			entities.MotherSpotifyAlbums()[0:2],
-			entities.MotherSpotifyAlbums()[2:4],
-		},
-		SleepMillis: 600,
+		SearchAlbumResults: entities.MotherSpotifySearchResults(),
+		SleepMillis:        600,
 	}
 	controller := NewDiscogsConvertToSpotify(spotifyServiceMock)
 	ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
@@ -27,7 +27,7 @@ func BenchmarkGetAlbumUris(b *testing.B) {
 	b.ResetTimer()
 	for i := range b.N {
 		start := time.Now()
-		_, err := controller.getSpotifyAlbumIDs(ctx, discogsResponses)
+		_, err := controller.matchReleases(ctx, discogsResponses, nil)
 		if err != nil {
 			b.Errorf("did not expect error, got %v", err)
 		}
@@ -35,3 +35,106 @@ func BenchmarkGetAlbumUris(b *testing.B) {
 		b.Logf("Iteration %d took %f seconds", i, elapsed)
 	}
 }
+
+// unlimited lets every search through at once
+type unlimited struct{}
+
+func (unlimited) Wait(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func TestMatchReleases(t *testing.T) {
+	ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+	errSearch := errors.New("spotify is down")
+
+	t.Run("a failed search only fails its release", func(t *testing.T) {
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResponses: [][]entities.SpotifyAlbumItem{entities.MotherSpotifyAlbums()[0:2]},
+			SearchAlbumErrors:    map[string]error{"Catholic Boy": errSearch},
+		}
+		converter := NewDiscogsConvertToSpotifyWithOptions(spotifyServiceMock, ConverterOptions{Limiter: unlimited{}, Workers: 1})
+
+		matches, err := converter.matchReleases(ctx, entities.MotherTwoDiscogsAlbums(), nil)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if matches[0].SpotifyAlbumID != entities.SpotifyAlbumIDMiloGoesToCollege {
+			t.Errorf("got album %s, want %s", matches[0].SpotifyAlbumID, entities.SpotifyAlbumIDMiloGoesToCollege)
+		}
+		if matches[1].Album.Title != "Catholic Boy" || matches[1].Reason != entities.MatchSearchFailed {
+			t.Errorf("got %+v, want the search of Catholic Boy failed", matches[1])
+		}
+		if !anySearchFailed(matches) {
+			t.Errorf("got no failed searches, want one")
+		}
+	})
+
+	t.Run("every search failed", func(t *testing.T) {
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumErrors: map[string]error{"Milo Goes to College": errSearch, "Catholic Boy": errSearch},
+		}
+		converter := NewDiscogsConvertToSpotifyWithOptions(spotifyServiceMock, ConverterOptions{Limiter: unlimited{}})
+
+		if _, err := converter.matchReleases(ctx, entities.MotherTwoDiscogsAlbums(), nil); !errors.Is(err, errSearch) {
+			t.Errorf("got error %v, want %v", err, errSearch)
+		}
+	})
+
+	t.Run("the number of tracks tells apart otherwise equal albums", func(t *testing.T) {
+		releases := entities.MotherTwoDiscogsAlbums()[0:1]
+		releases[0].Tracklist = []entities.DiscogsTrack{
+			{Position: "1", Type: "track", Title: "Myage"},
+			{Position: "2", Type: "track", Title: "I Wanna Be a Bear"},
+			{Position: "3", Type: "track", Title: "I'm Not a Loser"},
+		}
+		deluxe := entities.MotherSpotifyAlbums()[0]
+		deluxe.ID, deluxe.URI, deluxe.TotalTracks = "deluxe", "spotify:album:deluxe", 30
+		original := entities.MotherSpotifyAlbums()[0]
+		original.TotalTracks = 3
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResponses: [][]entities.SpotifyAlbumItem{{deluxe, original}},
+		}
+		converter := NewDiscogsConvertToSpotifyWithOptions(spotifyServiceMock, ConverterOptions{Limiter: unlimited{}})
+
+		matches, err := converter.matchReleases(ctx, releases, nil)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if matches[0].SpotifyAlbumID != entities.SpotifyAlbumIDMiloGoesToCollege {
+			t.Errorf("got album %s, want %s", matches[0].SpotifyAlbumID, entities.SpotifyAlbumIDMiloGoesToCollege)
+		}
+	})
+
+	t.Run("a release without artists is left unmatched", func(t *testing.T) {
+		releases := entities.MotherTwoDiscogsAlbums()
+		releases[1].BasicInformation.Artists = nil
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults(),
+		}
+		converter := NewDiscogsConvertToSpotifyWithOptions(spotifyServiceMock, ConverterOptions{Limiter: unlimited{}})
+
+		matches, err := converter.matchReleases(ctx, releases, nil)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if matches[0].SpotifyAlbumID != entities.SpotifyAlbumIDMiloGoesToCollege {
+			t.Errorf("got album %s, want %s", matches[0].SpotifyAlbumID, entities.SpotifyAlbumIDMiloGoesToCollege)
+		}
+		if matches[1].Matched() || matches[1].Reason != entities.MatchNoArtist {
+			t.Errorf("got %+v, want unmatched for having no artist", matches[1])
+		}
+		if spotifyServiceMock.Searches != 1 {
+			t.Errorf("got %d searches, want 1", spotifyServiceMock.Searches)
+		}
+	})
+
+	t.Run("stop when the context is done", func(t *testing.T) {
+		converter := NewDiscogsConvertToSpotifyWithOptions(&spotify.ServiceMock{}, ConverterOptions{Limiter: unlimited{}})
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		if _, err := converter.matchReleases(cancelled, entities.MotherNAlbums(10), nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v, want %v", err, context.Canceled)
+		}
+	})
+}
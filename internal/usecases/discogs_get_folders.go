@@ -0,0 +1,35 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+)
+
+type GetDiscogsFolders struct {
+	discogsService ports.DiscogsPort
+}
+
+func NewGetDiscogsFolders(s ports.DiscogsPort) *GetDiscogsFolders {
+	return &GetDiscogsFolders{discogsService: s}
+}
+
+// GetFolders lists the folders of the collection in the URL, so users can convert just one of them
+func (c *GetDiscogsFolders) GetFolders(ctx context.Context, discogsURL string) ([]entities.DiscogsFolder, error) {
+	parsedURL, err := parseDiscogsURL(discogsURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing Discogs URL")
+	}
+	if parsedURL.Type != entities.CollectionType {
+		return nil, errors.Wrap(ErrInvalidDiscogsURL, "not a collection URL")
+	}
+
+	folders, err := c.discogsService.GetCollectionFolders(ctx, parsedURL.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting collection folders")
+	}
+	return folders, nil
+}
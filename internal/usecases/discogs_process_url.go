@@ -2,9 +2,13 @@ package usecases
 
 import (
 	"context"
+	"maps"
 	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -14,38 +18,206 @@ import (
 
 var ErrInvalidDiscogsURL = errors.New("invalid Discogs URL")
 
+// ImporterOptions tunes what is fetched from Discogs besides the releases of the source
+type ImporterOptions struct {
+	// Barcodes fetches the details of every release to search Spotify by barcode first,
+	// it costs a Discogs request per release
+	Barcodes bool
+}
+
 type DiscogsProcessURL struct {
 	discogsService ports.DiscogsPort
+	barcodes       bool
 }
 
 func NewDiscogsProcessURL(discogsService ports.DiscogsPort) *DiscogsProcessURL {
+	return NewDiscogsProcessURLWithOptions(discogsService, ImporterOptions{})
+}
+
+func NewDiscogsProcessURLWithOptions(discogsService ports.DiscogsPort, options ImporterOptions) *DiscogsProcessURL {
 	return &DiscogsProcessURL{
 		discogsService: discogsService,
+		barcodes:       options.Barcodes,
 	}
 }
 
-func (c *DiscogsProcessURL) processDiscogsURL(
+// streamReleases sends the releases of the source to out in their order as their pages come in,
+// closing out once they are all sent and reporting how many were sent so far after every page.
+// Sources without pages are sent at once when they are in
+func (c *DiscogsProcessURL) streamReleases(
+	ctx context.Context,
+	parsedDiscogsURL *entities.ParsedDiscogsURL,
+	progress ProgressFunc,
+	out chan<- entities.DiscogsRelease,
+) (int, error) {
+	defer close(out)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// pages are held until they are sent so fetching never waits for the releases before them to be matched,
+	// pages fetched at once can also come out of order and wait for the ones before them
+	var mu sync.Mutex
+	held := map[int][]entities.DiscogsRelease{}
+	streamed := false
+	ready := make(chan struct{}, 1)
+	pageCtx := ports.WithPageReleases(ctx, func(page int, releases []entities.DiscogsRelease) {
+		mu.Lock()
+		held[page] = releases
+		streamed = true
+		mu.Unlock()
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
+	})
+	// the release details aren't pages of the source, so they are fetched without reporting them
+	if progress != nil {
+		pageCtx = ports.WithPageFetched(pageCtx, func(page, pages int) {
+			progress.report(entities.ProgressEvent{Type: entities.ProgressPageFetched, Count: page, Total: pages})
+		})
+	}
+
+	var fetched []entities.DiscogsRelease
+	var fetchErr error
+	fetchDone := make(chan struct{})
+	go func() {
+		defer close(fetchDone)
+		fetched, fetchErr = c.fetchSource(pageCtx, parsedDiscogsURL)
+	}()
+
+	next, sent := 1, 0
+	send := func(releases []entities.DiscogsRelease) error {
+		n, err := c.sendReleases(ctx, parsedDiscogsURL.Years, releases, out)
+		sent += n
+		if err == nil {
+			progress.report(entities.ProgressEvent{Type: entities.ProgressReleasesFetched, Count: sent})
+		}
+		return err
+	}
+	// nextPage takes the page to send next once it's in
+	nextPage := func() ([]entities.DiscogsRelease, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		releases, exists := held[next]
+		if exists {
+			delete(held, next)
+			next++
+		}
+		return releases, exists
+	}
+
+	for fetching := true; fetching; {
+		select {
+		case <-ready:
+		case <-fetchDone:
+			fetching = false
+		}
+		for releases, exists := nextPage(); exists; releases, exists = nextPage() {
+			if err := send(releases); err != nil {
+				// the source stops on ctx
+				cancel()
+				<-fetchDone
+				return sent, err
+			}
+		}
+	}
+	if fetchErr != nil {
+		return sent, fetchErr
+	}
+
+	if !streamed {
+		held[next] = fetched
+	}
+	for _, page := range slices.Sorted(maps.Keys(held)) {
+		if err := send(held[page]); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// fetchSource fetches the releases of every page of the source
+func (c *DiscogsProcessURL) fetchSource(
 	ctx context.Context,
 	parsedDiscogsURL *entities.ParsedDiscogsURL,
 ) ([]entities.DiscogsRelease, error) {
-	var releases []entities.DiscogsRelease
-	var err error
 	switch parsedDiscogsURL.Type {
 	case entities.CollectionType:
-		releases, err = c.discogsService.GetCollectionReleases(ctx, parsedDiscogsURL.ID)
+		return c.discogsService.GetCollectionReleases(ctx, parsedDiscogsURL.ID, parsedDiscogsURL.FolderID)
 	case entities.WantlistType:
-		releases, err = c.discogsService.GetWantlistReleases(ctx, parsedDiscogsURL.ID)
+		return c.discogsService.GetWantlistReleases(ctx, parsedDiscogsURL.ID)
 	case entities.ListType:
-		releases, err = c.discogsService.GetListReleases(ctx, parsedDiscogsURL.ID)
+		return c.discogsService.GetListReleases(ctx, parsedDiscogsURL.ID)
+	case entities.ArtistType:
+		return c.discogsService.GetArtistReleases(ctx, parsedDiscogsURL.ID)
+	case entities.LabelType:
+		return c.discogsService.GetLabelReleases(ctx, parsedDiscogsURL.ID)
+	case entities.ReleaseType:
+		release, err := c.discogsService.GetRelease(ctx, parsedDiscogsURL.ID)
+		if err != nil {
+			return nil, err
+		}
+		return []entities.DiscogsRelease{release.ToRelease()}, nil
+	case entities.MasterType:
+		master, err := c.discogsService.GetMaster(ctx, parsedDiscogsURL.ID)
+		if err != nil {
+			return nil, err
+		}
+		return []entities.DiscogsRelease{master.ToRelease()}, nil
 	default:
 		return nil, errors.New("unrecognized URL type")
 	}
+}
 
-	if err != nil {
-		return nil, err
+// sendReleases sends the releases of a page within the years of the source to out, with their details
+func (c *DiscogsProcessURL) sendReleases(
+	ctx context.Context,
+	years entities.YearRange,
+	releases []entities.DiscogsRelease,
+	out chan<- entities.DiscogsRelease,
+) (int, error) {
+	releases = filterYears(releases, years)
+	if err := c.fetchDetails(ctx, releases); err != nil {
+		return 0, err
+	}
+	for i := range releases {
+		select {
+		case out <- releases[i]:
+		case <-ctx.Done():
+			return i, ctx.Err()
+		}
+	}
+	return len(releases), nil
+}
+
+// fetchDetails adds the tracklist to the releases matched track by track, and the barcodes to
+// every release when enabled. Sources list releases without them so they come from the release details
+func (c *DiscogsProcessURL) fetchDetails(ctx context.Context, releases []entities.DiscogsRelease) error {
+	for i := range releases {
+		if releases[i].Tracklist != nil || (!c.barcodes && !releases[i].MatchByTrack()) {
+			continue
+		}
+		detail, err := c.discogsService.GetRelease(ctx, strconv.Itoa(releases[i].BasicInformation.ID))
+		if err != nil {
+			return errors.Wrap(err, "error getting release details")
+		}
+		releases[i].Tracklist = detail.Tracklist
+		releases[i].Identifiers = detail.Identifiers
 	}
+	return nil
+}
 
-	return releases, nil
+func filterYears(releases []entities.DiscogsRelease, years entities.YearRange) []entities.DiscogsRelease {
+	if years.IsZero() {
+		return releases
+	}
+	filtered := make([]entities.DiscogsRelease, 0, len(releases))
+	for _, release := range releases {
+		if years.Contains(release.BasicInformation.Year) {
+			filtered = append(filtered, release)
+		}
+	}
+	return filtered
 }
 
 func parseDiscogsURL(inputURL string) (*entities.ParsedDiscogsURL, error) {
@@ -68,8 +240,8 @@ func parseDiscogsURL(inputURL string) (*entities.ParsedDiscogsURL, error) {
 	cleanPath := cleanURLPath(parsedURL.Path)
 
 	// Try to parse as a collection URL
-	// https://www.discogs.com/es/user/digger/collection
-	if collectionURL := parseCollectionURL(cleanPath); collectionURL != nil {
+	// https://www.discogs.com/es/user/digger/collection?folder=123
+	if collectionURL := parseCollectionURL(parsedURL, cleanPath); collectionURL != nil {
 		return collectionURL, nil
 	}
 
@@ -79,6 +251,24 @@ func parseDiscogsURL(inputURL string) (*entities.ParsedDiscogsURL, error) {
 		return listURL, nil
 	}
 
+	// Try to parse as an artist URL
+	// https://www.discogs.com/es/artist/125246-Nirvana
+	if artistURL := parseArtistURL(cleanPath); artistURL != nil {
+		return artistURL, nil
+	}
+
+	// Try to parse as a label URL
+	// https://www.discogs.com/es/label/23528-Warp-Records?year_from=1990&year_to=1999
+	if labelURL := parseLabelURL(parsedURL, cleanPath); labelURL != nil {
+		return labelURL, nil
+	}
+
+	// Try to parse as a master or release URL
+	// https://www.discogs.com/es/release/367113-Nirvana-Nevermind
+	if releaseURL := parseReleaseURL(cleanPath); releaseURL != nil {
+		return releaseURL, nil
+	}
+
 	return nil, ErrInvalidDiscogsURL
 }
 
@@ -111,13 +301,27 @@ func cleanURLPath(path string) string {
 	return matches[1]
 }
 
-func parseCollectionURL(cleanPath string) *entities.ParsedDiscogsURL {
+// parseCollectionURL reads the folder from the folder or folder_id query parameter, the "All" folder when missing
+func parseCollectionURL(parsedURL *url.URL, cleanPath string) *entities.ParsedDiscogsURL {
 	collectionRe := regexp.MustCompile(`^user/([^/]+)/collection$`)
 	collectionMatches := collectionRe.FindStringSubmatch(cleanPath)
-	if len(collectionMatches) > 1 {
-		return &entities.ParsedDiscogsURL{ID: collectionMatches[1], Type: entities.CollectionType}
+	if len(collectionMatches) < 2 {
+		return nil
 	}
-	return nil
+
+	folder := parsedURL.Query().Get("folder")
+	if folder == "" {
+		folder = parsedURL.Query().Get("folder_id")
+	}
+	folderID := 0
+	if folder != "" {
+		var err error
+		folderID, err = strconv.Atoi(folder)
+		if err != nil || folderID < 0 {
+			return nil
+		}
+	}
+	return &entities.ParsedDiscogsURL{ID: collectionMatches[1], Type: entities.CollectionType, FolderID: folderID}
 }
 
 func parseListURL(cleanPath string) *entities.ParsedDiscogsURL {
@@ -128,3 +332,62 @@ func parseListURL(cleanPath string) *entities.ParsedDiscogsURL {
 	}
 	return nil
 }
+
+// parseArtistURL reads the artist name from the slug after the ID, which is optional
+func parseArtistURL(cleanPath string) *entities.ParsedDiscogsURL {
+	artistRe := regexp.MustCompile(`^artist/(\d+)(?:-([^/]*))?$`)
+	artistMatches := artistRe.FindStringSubmatch(cleanPath)
+	if len(artistMatches) > 1 {
+		name := strings.ReplaceAll(artistMatches[2], "-", " ")
+		return &entities.ParsedDiscogsURL{ID: artistMatches[1], Type: entities.ArtistType, Name: name}
+	}
+	return nil
+}
+
+// parseLabelURL reads the optional year range from the year_from and year_to query parameters
+func parseLabelURL(parsedURL *url.URL, cleanPath string) *entities.ParsedDiscogsURL {
+	labelRe := regexp.MustCompile(`^label/(\d+)(?:-([^/]*))?$`)
+	labelMatches := labelRe.FindStringSubmatch(cleanPath)
+	if len(labelMatches) < 2 {
+		return nil
+	}
+
+	var years entities.YearRange
+	for param, year := range map[string]*int{"year_from": &years.From, "year_to": &years.To} {
+		value := parsedURL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return nil
+		}
+		*year = parsed
+	}
+	if years.From != 0 && years.To != 0 && years.From > years.To {
+		return nil
+	}
+
+	name := strings.ReplaceAll(labelMatches[2], "-", " ")
+	return &entities.ParsedDiscogsURL{ID: labelMatches[1], Type: entities.LabelType, Name: name, Years: years}
+}
+
+// parseReleaseURL reads master and release URLs, also in their older form with the slug first,
+// like discogs.com/Nirvana-Nevermind/master/13814
+func parseReleaseURL(cleanPath string) *entities.ParsedDiscogsURL {
+	releaseRe := regexp.MustCompile(`^(?:([^/]+)/)?(master|release)/(\d+)(?:-([^/]*))?$`)
+	releaseMatches := releaseRe.FindStringSubmatch(cleanPath)
+	if len(releaseMatches) < 4 {
+		return nil
+	}
+
+	slug := releaseMatches[4]
+	if slug == "" {
+		slug = releaseMatches[1]
+	}
+	return &entities.ParsedDiscogsURL{
+		ID:   releaseMatches[3],
+		Type: entities.URLType(releaseMatches[2]),
+		Name: strings.ReplaceAll(slug, "-", " "),
+	}
+}
@@ -1,9 +1,12 @@
 package usecases
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/martiriera/discogs-spotify/internal/adapters/discogs"
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
 )
 
@@ -61,6 +64,18 @@ func TestProcessDiscogsURL(t *testing.T) {
 					expected:    &entities.ParsedDiscogsURL{ID: "digger", Type: entities.CollectionType},
 					expectError: false,
 				},
+				{
+					name:        "collection URL with folder",
+					url:         "https://www.discogs.com/user/digger/collection?folder=123",
+					expected:    &entities.ParsedDiscogsURL{ID: "digger", Type: entities.CollectionType, FolderID: 123},
+					expectError: false,
+				},
+				{
+					name:        "collection URL with folder_id and other parameters",
+					url:         "https://www.discogs.com/es/user/digger/collection?header=1&folder_id=456",
+					expected:    &entities.ParsedDiscogsURL{ID: "digger", Type: entities.CollectionType, FolderID: 456},
+					expectError: false,
+				},
 				{
 					name:        "collection URL with subdomain",
 					url:         "https://m.discogs.com/user/digger/collection",
@@ -103,6 +118,100 @@ func TestProcessDiscogsURL(t *testing.T) {
 				},
 			},
 		},
+		{
+			category: "Artist URLs",
+			testCases: []struct {
+				name        string
+				url         string
+				expected    *entities.ParsedDiscogsURL
+				expectError bool
+			}{
+				{
+					name:        "https artist URL",
+					url:         "https://www.discogs.com/artist/125246-Nirvana",
+					expected:    &entities.ParsedDiscogsURL{ID: "125246", Type: entities.ArtistType, Name: "Nirvana"},
+					expectError: false,
+				},
+				{
+					name:        "artist URL with language code and several words",
+					url:         "www.discogs.com/es/artist/288440-The-Jim-Carroll-Band",
+					expected:    &entities.ParsedDiscogsURL{ID: "288440", Type: entities.ArtistType, Name: "The Jim Carroll Band"},
+					expectError: false,
+				},
+				{
+					name:        "artist URL without name",
+					url:         "https://www.discogs.com/artist/125246",
+					expected:    &entities.ParsedDiscogsURL{ID: "125246", Type: entities.ArtistType},
+					expectError: false,
+				},
+			},
+		},
+		{
+			category: "Label URLs",
+			testCases: []struct {
+				name        string
+				url         string
+				expected    *entities.ParsedDiscogsURL
+				expectError bool
+			}{
+				{
+					name:        "https label URL",
+					url:         "https://www.discogs.com/label/23528-Warp-Records",
+					expected:    &entities.ParsedDiscogsURL{ID: "23528", Type: entities.LabelType, Name: "Warp Records"},
+					expectError: false,
+				},
+				{
+					name: "label URL with year range",
+					url:  "www.discogs.com/es/label/23528-Warp-Records?year_from=1990&year_to=1999",
+					expected: &entities.ParsedDiscogsURL{
+						ID: "23528", Type: entities.LabelType, Name: "Warp Records", Years: entities.YearRange{From: 1990, To: 1999},
+					},
+					expectError: false,
+				},
+				{
+					name: "label URL with open year range",
+					url:  "https://www.discogs.com/label/23528-Warp-Records?year_from=2000",
+					expected: &entities.ParsedDiscogsURL{
+						ID: "23528", Type: entities.LabelType, Name: "Warp Records", Years: entities.YearRange{From: 2000},
+					},
+					expectError: false,
+				},
+			},
+		},
+		{
+			category: "Master and release URLs",
+			testCases: []struct {
+				name        string
+				url         string
+				expected    *entities.ParsedDiscogsURL
+				expectError bool
+			}{
+				{
+					name:        "https release URL",
+					url:         "https://www.discogs.com/release/367113-Nirvana-Nevermind",
+					expected:    &entities.ParsedDiscogsURL{ID: "367113", Type: entities.ReleaseType, Name: "Nirvana Nevermind"},
+					expectError: false,
+				},
+				{
+					name:        "master URL with language code",
+					url:         "www.discogs.com/es/master/13814-Nirvana-Nevermind",
+					expected:    &entities.ParsedDiscogsURL{ID: "13814", Type: entities.MasterType, Name: "Nirvana Nevermind"},
+					expectError: false,
+				},
+				{
+					name:        "release URL without name",
+					url:         "https://www.discogs.com/release/367113",
+					expected:    &entities.ParsedDiscogsURL{ID: "367113", Type: entities.ReleaseType},
+					expectError: false,
+				},
+				{
+					name:        "older master URL with the name first",
+					url:         "https://www.discogs.com/Nirvana-Nevermind/master/13814",
+					expected:    &entities.ParsedDiscogsURL{ID: "13814", Type: entities.MasterType, Name: "Nirvana Nevermind"},
+					expectError: false,
+				},
+			},
+		},
 		{
 			category: "Wantlist URLs",
 			testCases: []struct {
@@ -169,12 +278,36 @@ func TestProcessDiscogsURL(t *testing.T) {
 					expected:    nil,
 					expectError: true,
 				},
+				{
+					name:        "collection URL with invalid folder",
+					url:         "https://www.discogs.com/user/digger/collection?folder=jazz",
+					expected:    nil,
+					expectError: true,
+				},
 				{
 					name:        "wantlist without user parameter",
 					url:         "https://www.discogs.com/wantlist?digger",
 					expected:    nil,
 					expectError: true,
 				},
+				{
+					name:        "artist URL without ID",
+					url:         "https://www.discogs.com/artist/Nirvana",
+					expected:    nil,
+					expectError: true,
+				},
+				{
+					name:        "label URL with reversed year range",
+					url:         "https://www.discogs.com/label/23528-Warp-Records?year_from=1999&year_to=1990",
+					expected:    nil,
+					expectError: true,
+				},
+				{
+					name:        "label URL with invalid year",
+					url:         "https://www.discogs.com/label/23528-Warp-Records?year_to=nineties",
+					expected:    nil,
+					expectError: true,
+				},
 				{
 					name:        "invalid lists URL",
 					url:         "https://www.discogs.com/user/digger/lists",
@@ -223,3 +356,169 @@ func TestProcessDiscogsURL(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterYears(t *testing.T) {
+	release := func(id, year int) entities.DiscogsRelease {
+		return entities.DiscogsRelease{BasicInformation: entities.DiscogsBasicInformation{ID: id, Year: year}}
+	}
+	releases := []entities.DiscogsRelease{release(1, 0), release(2, 1989), release(3, 1990), release(4, 1999), release(5, 2000)}
+
+	got := filterYears(releases, entities.YearRange{From: 1990, To: 1999})
+	if want := []entities.DiscogsRelease{release(3, 1990), release(4, 1999)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := filterYears(releases, entities.YearRange{}); !reflect.DeepEqual(got, releases) {
+		t.Errorf("got %v, want every release", got)
+	}
+}
+
+func TestFetchDetails(t *testing.T) {
+	compilation := entities.DiscogsRelease{
+		BasicInformation: entities.DiscogsBasicInformation{ID: 10, Artists: []entities.DiscogsArtist{{Name: "Various"}}},
+	}
+	album := entities.MotherTwoDiscogsAlbums()[0]
+	discogsServiceMock := &discogs.ServiceMock{
+		Release: &entities.DiscogsReleaseDetail{
+			Tracklist:   []entities.DiscogsTrack{{Position: "A1", Type: "track", Title: "Polygon Window"}},
+			Identifiers: []entities.DiscogsIdentifier{{Type: "Barcode", Value: "5 021603 065624"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		options ImporterOptions
+		want    []bool // whether each release got its details
+	}{
+		{name: "only compilations", options: ImporterOptions{}, want: []bool{false, true}},
+		{name: "every release for barcodes", options: ImporterOptions{Barcodes: true}, want: []bool{true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releases := []entities.DiscogsRelease{album, compilation}
+			importer := NewDiscogsProcessURLWithOptions(discogsServiceMock, tt.options)
+			if err := importer.fetchDetails(context.Background(), releases); err != nil {
+				t.Fatalf("did not expect error, got %v", err)
+			}
+			for i := range releases {
+				if got := releases[i].Tracklist != nil && len(releases[i].Barcodes()) == 1; got != tt.want[i] {
+					t.Errorf("release %d got details %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStreamReleases(t *testing.T) {
+	pageReleases := func(ids ...int) []entities.DiscogsRelease {
+		releases := []entities.DiscogsRelease{}
+		for _, id := range ids {
+			releases = append(releases, entities.DiscogsRelease{BasicInformation: entities.DiscogsBasicInformation{ID: id}})
+		}
+		return releases
+	}
+
+	tests := []struct {
+		name    string
+		service *discogs.ServiceMock
+		want    []int
+		counts  []int // releases fetched reported
+	}{
+		{
+			name:    "pages in order",
+			service: &discogs.ServiceMock{Pages: [][]entities.DiscogsRelease{pageReleases(1, 2), pageReleases(3)}},
+			want:    []int{1, 2, 3},
+			counts:  []int{2, 3},
+		},
+		{
+			name: "pages out of order",
+			service: &discogs.ServiceMock{
+				Pages:     [][]entities.DiscogsRelease{pageReleases(1, 2), pageReleases(3, 4), pageReleases(5)},
+				PageOrder: []int{3, 1, 2},
+			},
+			want:   []int{1, 2, 3, 4, 5},
+			counts: []int{2, 4, 5},
+		},
+		{
+			name:    "source without pages",
+			service: &discogs.ServiceMock{Response: pageReleases(1, 2)},
+			want:    []int{1, 2},
+			counts:  []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			importer := NewDiscogsProcessURL(tt.service)
+			out := make(chan entities.DiscogsRelease)
+			got := []int{}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for release := range out {
+					got = append(got, release.BasicInformation.ID)
+				}
+			}()
+
+			counts := []int{}
+			progress := func(event entities.ProgressEvent) {
+				if event.Type == entities.ProgressReleasesFetched {
+					counts = append(counts, event.Count)
+				}
+			}
+
+			parsed := &entities.ParsedDiscogsURL{ID: "digger", Type: entities.CollectionType}
+			sent, err := importer.streamReleases(context.Background(), parsed, progress, out)
+			<-done
+			if err != nil {
+				t.Fatalf("did not expect error, got %v", err)
+			}
+			if sent != len(tt.want) {
+				t.Errorf("got %d releases sent, want %d", sent, len(tt.want))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got releases %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(counts, tt.counts) {
+				t.Errorf("got releases fetched reported %v, want %v", counts, tt.counts)
+			}
+		})
+	}
+
+	t.Run("pages keep coming while the releases wait to be matched", func(t *testing.T) {
+		service := &fetchedDiscogsService{
+			ServiceMock: &discogs.ServiceMock{Pages: [][]entities.DiscogsRelease{pageReleases(1), pageReleases(2), pageReleases(3)}},
+			fetched:     make(chan struct{}),
+		}
+		importer := NewDiscogsProcessURL(service)
+		out := make(chan entities.DiscogsRelease)
+		parsed := &entities.ParsedDiscogsURL{ID: "digger", Type: entities.CollectionType}
+		go func() {
+			_, _ = importer.streamReleases(context.Background(), parsed, nil, out)
+		}()
+
+		select {
+		case <-service.fetched:
+		case <-time.After(time.Second):
+			t.Fatal("expected every page to be fetched before the first release is taken")
+		}
+		got := []int{}
+		for release := range out {
+			got = append(got, release.BasicInformation.ID)
+		}
+		if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got releases %v, want %v", got, want)
+		}
+	})
+}
+
+// fetchedDiscogsService tells when the collection is fetched
+type fetchedDiscogsService struct {
+	*discogs.ServiceMock
+	fetched chan struct{}
+}
+
+func (s *fetchedDiscogsService) GetCollectionReleases(ctx context.Context, username string, folderID int) ([]entities.DiscogsRelease, error) {
+	defer close(s.fetched)
+	return s.ServiceMock.GetCollectionReleases(ctx, username, folderID)
+}
@@ -0,0 +1,108 @@
+package usecases
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+)
+
+var ErrInvalidSpotifyAlbum = errors.New("invalid Spotify album, use an album link, URI or ID")
+var ErrInvalidSpotifyPlaylist = errors.New("invalid Spotify playlist, use a playlist link, URI or ID")
+
+var spotifyIDPattern = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+// MatchOverrides manages the releases users pin to a Spotify album or skip
+type MatchOverrides struct {
+	store ports.OverridePort
+}
+
+func NewMatchOverrides(store ports.OverridePort) *MatchOverrides {
+	return &MatchOverrides{store: store}
+}
+
+func (o *MatchOverrides) List(ctx context.Context, userID string) ([]entities.MatchOverride, error) {
+	overrides, err := o.store.List(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing overrides")
+	}
+	return overrides, nil
+}
+
+// Pin matches the Discogs release to the Spotify album in the following conversions
+func (o *MatchOverrides) Pin(
+	ctx context.Context,
+	userID string,
+	discogsID int,
+	spotifyAlbum string,
+) (*entities.MatchOverride, error) {
+	albumID, err := parseSpotifyAlbumID(spotifyAlbum)
+	if err != nil {
+		return nil, err
+	}
+	return o.save(ctx, &entities.MatchOverride{UserID: userID, DiscogsID: discogsID, SpotifyAlbumID: albumID})
+}
+
+// Skip leaves the Discogs release out of the following conversions
+func (o *MatchOverrides) Skip(ctx context.Context, userID string, discogsID int) (*entities.MatchOverride, error) {
+	return o.save(ctx, &entities.MatchOverride{UserID: userID, DiscogsID: discogsID, Skip: true})
+}
+
+// Delete goes back to matching the Discogs release automatically
+func (o *MatchOverrides) Delete(ctx context.Context, userID string, discogsID int) error {
+	return o.store.Delete(ctx, userID, discogsID)
+}
+
+func (o *MatchOverrides) save(ctx context.Context, override *entities.MatchOverride) (*entities.MatchOverride, error) {
+	if err := o.store.Save(ctx, override); err != nil {
+		return nil, errors.Wrap(err, "error saving override")
+	}
+	return override, nil
+}
+
+// parseSpotifyAlbumID accepts album links like https://open.spotify.com/album/<id>, URIs like spotify:album:<id> and bare IDs
+func parseSpotifyAlbumID(input string) (string, error) {
+	id, ok := parseSpotifyID(input, "album")
+	if !ok {
+		return "", ErrInvalidSpotifyAlbum
+	}
+	return id, nil
+}
+
+// parseSpotifyPlaylistID accepts playlist links, URIs and bare IDs like parseSpotifyAlbumID
+func parseSpotifyPlaylistID(input string) (string, error) {
+	id, ok := parseSpotifyID(input, "playlist")
+	if !ok {
+		return "", ErrInvalidSpotifyPlaylist
+	}
+	return id, nil
+}
+
+// parseSpotifyID reads the ID of a Spotify link or URI of the given type, like album or playlist
+func parseSpotifyID(input, resource string) (string, bool) {
+	input = strings.TrimSpace(input)
+
+	id := input
+	switch {
+	case strings.HasPrefix(input, "spotify:"+resource+":"):
+		id = strings.TrimPrefix(input, "spotify:"+resource+":")
+	case strings.Contains(input, "/"):
+		parsedURL, err := url.Parse(input)
+		if err != nil || parsedURL.Host != "open.spotify.com" {
+			return "", false
+		}
+		// links shared from the apps may have a locale before the type, like /intl-es/album/<id>
+		parts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+		if len(parts) < 2 || parts[len(parts)-2] != resource {
+			return "", false
+		}
+		id = parts[len(parts)-1]
+	}
+
+	return id, spotifyIDPattern.MatchString(id)
+}
@@ -0,0 +1,63 @@
+package usecases
+
+import (
+	"testing"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+)
+
+func TestParseSpotifyAlbumID(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "bare id", input: entities.SpotifyAlbumIDRooms, want: entities.SpotifyAlbumIDRooms},
+		{name: "uri", input: "spotify:album:" + entities.SpotifyAlbumIDRooms, want: entities.SpotifyAlbumIDRooms},
+		{name: "link", input: "https://open.spotify.com/album/" + entities.SpotifyAlbumIDRooms + "?si=abc", want: entities.SpotifyAlbumIDRooms},
+		{name: "localized link", input: "https://open.spotify.com/intl-es/album/" + entities.SpotifyAlbumIDRooms, want: entities.SpotifyAlbumIDRooms},
+		{name: "track link", input: "https://open.spotify.com/track/" + entities.SpotifyAlbumIDRooms, wantErr: ErrInvalidSpotifyAlbum},
+		{name: "other host", input: "https://example.com/album/" + entities.SpotifyAlbumIDRooms, wantErr: ErrInvalidSpotifyAlbum},
+		{name: "short id", input: "abc", wantErr: ErrInvalidSpotifyAlbum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSpotifyAlbumID(tt.input)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSpotifyPlaylistID(t *testing.T) {
+	const playlistID = "6rqhFgbbKwnb9MLmUQDhG6"
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "bare id", input: playlistID, want: playlistID},
+		{name: "uri", input: "spotify:playlist:" + playlistID, want: playlistID},
+		{name: "link", input: "https://open.spotify.com/playlist/" + playlistID + "?si=abc", want: playlistID},
+		{name: "album link", input: "https://open.spotify.com/album/" + playlistID, wantErr: ErrInvalidSpotifyPlaylist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSpotifyPlaylistID(tt.input)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,30 +2,64 @@ package usecases
 
 import (
 	"context"
+	"log"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
 	"github.com/martiriera/discogs-spotify/internal/core/ports"
 )
 
+// ControllerOptions adds playlist sync to the importer and converter options
+type ControllerOptions struct {
+	ImporterOptions
+	ConverterOptions
+	Syncs ports.PlaylistSyncPort // playlists created from every Discogs source, sync is disabled when nil
+}
+
 type Controller struct {
-	importer  *DiscogsProcessURL
-	builder   *SpotifyCreatePlaylist
-	converter *DiscogsConvertToSpotify
+	importer       *DiscogsProcessURL
+	converter      *DiscogsConvertToSpotify
+	syncer         *SpotifySyncPlaylist
+	syncs          ports.PlaylistSyncPort
+	spotifyService ports.SpotifyPort
 }
 
 func NewPlaylistController(discogsService ports.DiscogsPort, spotifyService ports.SpotifyPort) *Controller {
+	return NewPlaylistControllerWithOptions(discogsService, spotifyService, ControllerOptions{})
+}
+
+func NewPlaylistControllerWithOptions(
+	discogsService ports.DiscogsPort,
+	spotifyService ports.SpotifyPort,
+	options ControllerOptions,
+) *Controller {
 	return &Controller{
-		importer:  NewDiscogsProcessURL(discogsService),
-		builder:   NewSpotifyCreatePlaylist(spotifyService),
-		converter: NewDiscogsConvertToSpotify(spotifyService),
+		importer:       NewDiscogsProcessURLWithOptions(discogsService, options.ImporterOptions),
+		converter:      NewDiscogsConvertToSpotifyWithOptions(spotifyService, options.ConverterOptions),
+		syncer:         NewSpotifySyncPlaylist(spotifyService),
+		syncs:          options.Syncs,
+		spotifyService: spotifyService,
 	}
 }
 
 func (c *Controller) CreatePlaylist(ctx context.Context, discogsURL string) (*entities.Playlist, error) {
+	return c.CreatePlaylistWithProgress(ctx, discogsURL, entities.PlaylistOptions{}, nil)
+}
+
+// CreatePlaylistWithProgress creates the playlist, or syncs the previous one when asked to,
+// reporting every conversion step to progress
+func (c *Controller) CreatePlaylistWithProgress(
+	ctx context.Context,
+	discogsURL string,
+	options entities.PlaylistOptions,
+	progress ProgressFunc,
+) (*entities.Playlist, error) {
 	stop := StartTimer("CreatePlaylist")
 	defer stop()
 
@@ -34,42 +68,312 @@ func (c *Controller) CreatePlaylist(ctx context.Context, discogsURL string) (*en
 		return nil, errors.Wrap(err, "error parsing Discogs URL")
 	}
 
-	// fetch releases
-	releases, err := c.importer.processDiscogsURL(ctx, parsedDiscogsURL)
+	previous, err := c.previousSync(ctx, parsedDiscogsURL, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// releases are matched while the Discogs pages come in, and the tracks of a new playlist
+	// are looked up as the albums are matched
+	run, err := c.runPipeline(ctx, parsedDiscogsURL, previous == nil, progress)
 	if err != nil {
 		return nil, err
 	}
+	matches := run.matches
+	albumIDs := run.albumIDs
+	trackURIs := c.filterValidUnique(matchedTrackURIs(matches))
+	// the releases whose search failed would look missing from Discogs, so nothing is removed this time
+	if anySearchFailed(matches) {
+		options.RemoveMissing = false
+	}
+
+	progress.stage(entities.JobBuilding)
+	var playlist *entities.Playlist
+	if previous != nil {
+		playlist, err = c.syncPlaylist(ctx, previous, albumIDs, trackURIs, options, progress)
+		// the playlist may have been deleted since the last sync, one chosen by the user has to exist
+		if errorWrapper.Is(err, errorWrapper.ErrNotFound) && options.PlaylistID == "" {
+			previous = nil
+			run.builder = NewSpotifyCreatePlaylist(c.spotifyService)
+			if err := run.builder.AppendAlbumsTracks(ctx, albumIDs); err != nil {
+				return nil, errors.Wrap(err, "error adding albums to playlist builder")
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if previous == nil {
+		playlist, err = c.newPlaylist(ctx, parsedDiscogsURL, discogsURL, run.builder, albumIDs, trackURIs, progress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	playlist.DiscogsReleases = run.releases
+	playlist.SpotifyAlbums = len(albumIDs)
+	playlist.SpotifyTracks = len(trackURIs)
+	playlist.Matches = matches
+	return playlist, nil
+}
 
-	if len(releases) == 0 {
+// pipelineRun is what a pipeline run made of the releases of a Discogs source
+type pipelineRun struct {
+	releases int
+	matches  []entities.ReleaseMatch
+	albumIDs []string
+	// builder holds the tracks of the albums matched when they were looked up along the way
+	builder *SpotifyCreatePlaylist
+}
+
+// runPipeline fetches the releases of the source, matches them on Spotify and, with resolveTracks,
+// looks up the tracks of the albums matched, every stage taking what the one before it sends while
+// it keeps going. The first stage to fail stops the others
+func (c *Controller) runPipeline(
+	ctx context.Context,
+	parsedDiscogsURL *entities.ParsedDiscogsURL,
+	resolveTracks bool,
+	progress ProgressFunc,
+) (*pipelineRun, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	releases := make(chan entities.DiscogsRelease)
+	matches := make(chan entities.ReleaseMatch)
+	run := &pipelineRun{albumIDs: []string{}}
+	var fetchErr, matchErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	progress.stage(entities.JobFetching)
+	go func() {
+		defer wg.Done()
+		run.releases, fetchErr = c.importer.streamReleases(ctx, parsedDiscogsURL, progress, releases)
+		if fetchErr != nil {
+			cancel()
+			return
+		}
+		progress.stage(entities.JobMatching)
+	}()
+	go func() {
+		defer wg.Done()
+		if matchErr = c.converter.streamMatches(ctx, releases, matches, progress); matchErr != nil {
+			cancel()
+		}
+	}()
+
+	resolveErr := c.collectMatches(ctx, run, matches, resolveTracks)
+	if resolveErr != nil {
+		cancel()
+		// the matches left are drained so the matcher can stop
+		for range matches {
+		}
+	}
+	wg.Wait()
+
+	// the stage that failed first is the one reported, the others stopped on ctx
+	switch {
+	case fetchErr != nil:
+		return nil, fetchErr
+	case run.releases == 0:
 		return nil, errors.New("no releases found on Discogs list")
+	case matchErr != nil:
+		return nil, errors.Wrap(matchErr, "error getting spotify album uris")
+	case resolveErr != nil:
+		return nil, errors.Wrap(resolveErr, "error adding albums to playlist builder")
+	}
+	return run, nil
+}
+
+// collectMatches keeps the matches in the order they come and the albums matched without duplicates.
+// With resolveTracks the tracks of the albums are looked up in batches while the matches keep coming
+func (c *Controller) collectMatches(
+	ctx context.Context,
+	run *pipelineRun,
+	matches <-chan entities.ReleaseMatch,
+	resolveTracks bool,
+) error {
+	// the builder keeps the tracks of a single playlist so it can't be shared between jobs
+	run.builder = NewSpotifyCreatePlaylist(c.spotifyService)
+	seen := map[string]bool{}
+	batch := []string{}
+	for match := range matches {
+		run.matches = append(run.matches, match)
+		id := match.SpotifyAlbumID
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		run.albumIDs = append(run.albumIDs, id)
+		if !resolveTracks {
+			continue
+		}
+		batch = append(batch, id)
+		if len(batch) == albumTracksBatchSize {
+			if err := run.builder.AppendAlbumsTracks(ctx, batch); err != nil {
+				return err
+			}
+			batch = []string{}
+		}
 	}
+	if len(batch) > 0 && ctx.Err() == nil {
+		return run.builder.AppendAlbumsTracks(ctx, batch)
+	}
+	return nil
+}
+
+// previousSync returns the playlist to sync, nil when a new one has to be created
+func (c *Controller) previousSync(
+	ctx context.Context,
+	parsedDiscogsURL *entities.ParsedDiscogsURL,
+	options entities.PlaylistOptions,
+) (*entities.PlaylistSync, error) {
+	if options.PlaylistID != "" {
+		return c.targetPlaylist(ctx, parsedDiscogsURL, options.PlaylistID)
+	}
+	if !options.Sync || c.syncs == nil {
+		return nil, nil
+	}
+
+	userID, err := c.spotifyService.GetUserID(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting spotify user id")
+	}
+	previous, err := c.syncs.Get(ctx, userID, parsedDiscogsURL.Source())
+	if errorWrapper.Is(err, errorWrapper.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting playlist to sync")
+	}
+	return previous, nil
+}
 
-	// process album IDs
-	albumIDs, err := c.converter.getSpotifyAlbumIDs(ctx, releases)
+// targetPlaylist syncs the existing playlist chosen by the user, keeping the albums of
+// the previous sync when the source was already synced to it
+func (c *Controller) targetPlaylist(
+	ctx context.Context,
+	parsedDiscogsURL *entities.ParsedDiscogsURL,
+	playlistID string,
+) (*entities.PlaylistSync, error) {
+	userID, err := c.spotifyService.GetUserID(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "error getting spotify album uris")
+		return nil, errors.Wrap(err, "error getting spotify user id")
 	}
-	albumIDs = c.filterValidUnique(albumIDs)
 
-	// create playlist
-	err = c.builder.AppendAlbumsTracks(ctx, albumIDs)
+	if c.syncs != nil {
+		previous, err := c.syncs.Get(ctx, userID, parsedDiscogsURL.Source())
+		if err == nil && previous.PlaylistID == playlistID {
+			return previous, nil
+		}
+	}
+	return &entities.PlaylistSync{
+		UserID:      userID,
+		Source:      parsedDiscogsURL.Source(),
+		PlaylistID:  playlistID,
+		PlaylistURL: "https://open.spotify.com/playlist/" + playlistID,
+	}, nil
+}
+
+func (c *Controller) syncPlaylist(
+	ctx context.Context,
+	previous *entities.PlaylistSync,
+	albumIDs []string,
+	trackURIs []string,
+	options entities.PlaylistOptions,
+	progress ProgressFunc,
+) (*entities.Playlist, error) {
+	result, err := c.syncer.Sync(ctx, previous, albumIDs, trackURIs, options.RemoveMissing, progress)
 	if err != nil {
-		return nil, errors.Wrap(err, "error adding albums to playlist builder")
+		return nil, errors.Wrap(err, "error syncing playlist")
 	}
-	playlist, err := c.builder.CreateAndPopulate(
+
+	playlist := &entities.Playlist{
+		SpotifyPlaylist: entities.SpotifyPlaylist{
+			ID:   previous.PlaylistID,
+			Name: previous.PlaylistName,
+			URL:  previous.PlaylistURL,
+		},
+		Synced:        true,
+		TracksAdded:   result.AddedTracks,
+		TracksRemoved: result.RemovedTracks,
+	}
+	previous.AlbumIDs = result.AlbumIDs
+	previous.TrackURIs = result.TrackURIs
+	c.saveSync(ctx, previous)
+	return playlist, nil
+}
+
+// newPlaylist creates the playlist and remembers it for later syncs
+func (c *Controller) newPlaylist(
+	ctx context.Context,
+	parsedDiscogsURL *entities.ParsedDiscogsURL,
+	discogsURL string,
+	builder *SpotifyCreatePlaylist,
+	albumIDs []string,
+	trackURIs []string,
+	progress ProgressFunc,
+) (*entities.Playlist, error) {
+	builder.AppendTracks(trackURIs)
+	created, err := builder.CreateAndPopulate(
 		ctx,
-		"Discogs "+cases.Title(language.English).String(parsedDiscogsURL.Type.String())+" by "+parsedDiscogsURL.ID,
+		playlistName(parsedDiscogsURL),
 		"Created from: "+discogsURL,
+		progress,
 	)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating and populating playlist")
 	}
 
-	return &entities.Playlist{
-		DiscogsReleases: len(releases),
-		SpotifyAlbums:   len(albumIDs),
-		SpotifyPlaylist: *playlist,
-	}, nil
+	if c.syncs != nil {
+		userID, err := c.spotifyService.GetUserID(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting spotify user id")
+		}
+		c.saveSync(ctx, &entities.PlaylistSync{
+			UserID:       userID,
+			Source:       parsedDiscogsURL.Source(),
+			PlaylistID:   created.ID,
+			PlaylistName: created.Name,
+			PlaylistURL:  created.URL,
+			AlbumIDs:     albumIDs,
+			TrackURIs:    trackURIs,
+		})
+	}
+
+	return &entities.Playlist{SpotifyPlaylist: *created, TracksAdded: len(builder.tracks)}, nil
+}
+
+// playlistName names the playlist after the Discogs source, like "Discogs Collection by digger"
+func playlistName(parsedDiscogsURL *entities.ParsedDiscogsURL) string {
+	name := parsedDiscogsURL.Name
+	if name == "" {
+		name = parsedDiscogsURL.ID
+	}
+
+	switch parsedDiscogsURL.Type {
+	case entities.ArtistType:
+		return "Discogs Discography of " + name
+	case entities.MasterType, entities.ReleaseType:
+		return "Discogs " + name
+	case entities.LabelType:
+		if !parsedDiscogsURL.Years.IsZero() {
+			return "Discogs Catalog of " + name + " (" + parsedDiscogsURL.Years.String() + ")"
+		}
+		return "Discogs Catalog of " + name
+	default:
+		return "Discogs " + cases.Title(language.English).String(parsedDiscogsURL.Type.String()) + " by " + parsedDiscogsURL.ID
+	}
+}
+
+// saveSync remembers the playlist, a failure only means the next sync creates a new playlist
+func (c *Controller) saveSync(ctx context.Context, playlistSync *entities.PlaylistSync) {
+	if c.syncs == nil {
+		return
+	}
+	playlistSync.UpdatedAt = time.Now()
+	if err := c.syncs.Save(ctx, playlistSync); err != nil {
+		log.Println("error saving playlist sync", playlistSync.Source, err)
+	}
 }
 
 func (*Controller) filterValidUnique(uris []string) []string {
@@ -3,13 +3,18 @@ package usecases
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
 
 	"github.com/martiriera/discogs-spotify/internal/adapters/discogs"
 	"github.com/martiriera/discogs-spotify/internal/adapters/spotify"
 	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/cache"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/overrides"
 	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/syncs"
 	"github.com/martiriera/discogs-spotify/util"
 )
 
@@ -19,10 +24,7 @@ func TestPlaylistController(t *testing.T) {
 			Response: entities.MotherTwoDiscogsAlbums(),
 		}
 		spotifyServiceMock := &spotify.ServiceMock{
-			SearchAlbumResponses: [][]entities.SpotifyAlbumItem{
-				entities.MotherSpotifyAlbums()[0:2],
-				entities.MotherSpotifyAlbums()[2:4],
-			}}
+			SearchAlbumResults: entities.MotherSpotifySearchResults()}
 		controller := NewPlaylistController(discogsServiceMock, spotifyServiceMock)
 		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
 
@@ -44,6 +46,484 @@ func TestPlaylistController(t *testing.T) {
 		}
 	})
 
+	t.Run("report unmatched releases", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: append(entities.MotherTwoDiscogsAlbums(), entities.MotherNAlbums(1)...),
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: map[string][]entities.SpotifyAlbumItem{
+				"Milo Goes to College": entities.MotherSpotifyAlbums()[0:2],
+				"Catholic Boy":         entities.MotherSpotifyAlbums()[0:2],
+			}}
+		controller := NewPlaylistController(discogsServiceMock, spotifyServiceMock)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		playlist, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if len(playlist.Matches) != 3 {
+			t.Fatalf("got %d matches, want 3", len(playlist.Matches))
+		}
+		if playlist.Matches[0].SpotifyAlbumID != entities.SpotifyAlbumIDMiloGoesToCollege {
+			t.Errorf("got album %s, want %s", playlist.Matches[0].SpotifyAlbumID, entities.SpotifyAlbumIDMiloGoesToCollege)
+		}
+
+		unmatched := playlist.Unmatched()
+		if len(unmatched) != 2 {
+			t.Fatalf("got %d unmatched, want 2", len(unmatched))
+		}
+		if unmatched[0].Album.Title != "Catholic Boy" || unmatched[0].Reason != entities.MatchLowScore || unmatched[0].Candidates != 2 {
+			t.Errorf("got %+v, want Catholic Boy rejected for low score among 2 candidates", unmatched[0])
+		}
+		if unmatched[1].Reason != entities.MatchNoResults {
+			t.Errorf("got reason %s, want %s", unmatched[1].Reason, entities.MatchNoResults)
+		}
+	})
+
+	t.Run("apply user overrides before searching", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums(),
+		}
+		discogsServiceMock.Response[0].BasicInformation.ID = 1
+		discogsServiceMock.Response[1].BasicInformation.ID = 2
+		spotifyServiceMock := &spotify.ServiceMock{}
+		store := overrides.NewInMemoryStore()
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+		_ = store.Save(ctx, &entities.MatchOverride{UserID: "wizzler", DiscogsID: 1, Skip: true})
+		_ = store.Save(ctx, &entities.MatchOverride{UserID: "wizzler", DiscogsID: 2, SpotifyAlbumID: entities.SpotifyAlbumIDRooms})
+		_ = store.Save(ctx, &entities.MatchOverride{UserID: "someone-else", DiscogsID: 2, Skip: true})
+		controller := NewPlaylistControllerWithOptions(
+			discogsServiceMock,
+			spotifyServiceMock,
+			ControllerOptions{ConverterOptions: ConverterOptions{Overrides: store}},
+		)
+
+		playlist, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if playlist.Matches[0].Reason != entities.MatchSkipped || !playlist.Matches[0].Overridden {
+			t.Errorf("got %+v, want skipped by override", playlist.Matches[0])
+		}
+		if playlist.Matches[1].SpotifyAlbumID != entities.SpotifyAlbumIDRooms || !playlist.Matches[1].Overridden {
+			t.Errorf("got %+v, want pinned to %s", playlist.Matches[1], entities.SpotifyAlbumIDRooms)
+		}
+		if playlist.SpotifyAlbums != 1 {
+			t.Errorf("got %d albums, want 1", playlist.SpotifyAlbums)
+		}
+	})
+
+	t.Run("reuse cached matches", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums(),
+		}
+		discogsServiceMock.Response[0].BasicInformation.MasterID = 1
+		discogsServiceMock.Response[1].BasicInformation.ID = 2
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults()}
+		options := ControllerOptions{ConverterOptions: ConverterOptions{Cache: cache.NewInMemoryCache(time.Hour)}}
+		controller := NewPlaylistControllerWithOptions(discogsServiceMock, spotifyServiceMock, options)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		if _, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection"); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		searches := spotifyServiceMock.Searches
+		playlist, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if spotifyServiceMock.Searches != searches {
+			t.Errorf("got %d searches, want none", spotifyServiceMock.Searches-searches)
+		}
+		for _, match := range playlist.Matches {
+			if !match.Cached || !match.Matched() {
+				t.Errorf("got %+v, want a cached match", match)
+			}
+		}
+		if playlist.SpotifyAlbums != 2 {
+			t.Errorf("got %d albums, want 2", playlist.SpotifyAlbums)
+		}
+	})
+
+	t.Run("cached matches are not shared with another market", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums(),
+		}
+		discogsServiceMock.Response[0].BasicInformation.MasterID = 1
+		discogsServiceMock.Response[1].BasicInformation.ID = 2
+		matchCache := cache.NewInMemoryCache(time.Hour)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		spain := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults()}
+		options := ControllerOptions{ConverterOptions: ConverterOptions{Cache: matchCache}}
+		controller := NewPlaylistControllerWithOptions(discogsServiceMock, spain, options)
+		if _, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection"); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+
+		unitedStates := &spotify.ServiceMock{
+			Market:             "US",
+			SearchAlbumResults: entities.MotherSpotifySearchResults()}
+		controller = NewPlaylistControllerWithOptions(discogsServiceMock, unitedStates, options)
+		playlist, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		for _, match := range playlist.Matches {
+			if match.Cached {
+				t.Errorf("got %+v, want a match searched again", match)
+			}
+		}
+		if unitedStates.Searches == 0 {
+			t.Errorf("got no searches, want the releases searched in the new market")
+		}
+	})
+
+	t.Run("misses are searched again", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums(),
+		}
+		discogsServiceMock.Response[0].BasicInformation.MasterID = 1
+		discogsServiceMock.Response[1].BasicInformation.ID = 2
+		results := entities.MotherSpotifySearchResults()
+		delete(results, "Catholic Boy")
+		spotifyServiceMock := &spotify.ServiceMock{SearchAlbumResults: results}
+		options := ControllerOptions{ConverterOptions: ConverterOptions{Cache: cache.NewInMemoryCache(time.Hour)}}
+		controller := NewPlaylistControllerWithOptions(discogsServiceMock, spotifyServiceMock, options)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		if _, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection"); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		searches := spotifyServiceMock.Searches
+		playlist, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if spotifyServiceMock.Searches != searches+1 {
+			t.Errorf("got %d searches, want only the miss searched again", spotifyServiceMock.Searches-searches)
+		}
+		if !playlist.Matches[0].Cached || playlist.Matches[1].Cached {
+			t.Errorf("got %+v, want the match cached and the miss searched again", playlist.Matches)
+		}
+	})
+
+	t.Run("cached matches are not shared with another threshold", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums(),
+		}
+		discogsServiceMock.Response[0].BasicInformation.MasterID = 1
+		discogsServiceMock.Response[1].BasicInformation.ID = 2
+		matchCache := cache.NewInMemoryCache(time.Hour)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults()}
+
+		options := ControllerOptions{ConverterOptions: ConverterOptions{Cache: matchCache}}
+		controller := NewPlaylistControllerWithOptions(discogsServiceMock, spotifyServiceMock, options)
+		if _, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection"); err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+
+		options.ConverterOptions.Matcher = entities.NewAlbumMatcher(0.5)
+		controller = NewPlaylistControllerWithOptions(discogsServiceMock, spotifyServiceMock, options)
+		playlist, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		for _, match := range playlist.Matches {
+			if match.Cached {
+				t.Errorf("got %+v, want a match searched again", match)
+			}
+		}
+	})
+
+	t.Run("sync adds new albums and removes the missing ones", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums(),
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults(),
+			AlbumTracks: map[string][]string{
+				entities.SpotifyAlbumIDMiloGoesToCollege: {"spotify:track:milo"},
+				entities.SpotifyAlbumIDCatholicBoy:       {"spotify:track:catholic"},
+			},
+			PlaylistItems: []entities.SpotifyPlaylistItem{
+				{TrackURI: "spotify:track:milo", AlbumID: entities.SpotifyAlbumIDMiloGoesToCollege},
+				{TrackURI: "spotify:track:sucks", AlbumID: entities.SpotifyAlbumIDEverythingSucks},
+				{TrackURI: "spotify:track:by-hand", AlbumID: "added-by-hand"},
+			},
+		}
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+		store := syncs.NewInMemoryStore()
+		_ = store.Save(ctx, &entities.PlaylistSync{
+			UserID:     "wizzler",
+			Source:     "collection/digger",
+			PlaylistID: "synced-playlist",
+			AlbumIDs:   []string{entities.SpotifyAlbumIDMiloGoesToCollege, entities.SpotifyAlbumIDEverythingSucks},
+		})
+		controller := NewPlaylistControllerWithOptions(discogsServiceMock, spotifyServiceMock, ControllerOptions{Syncs: store})
+
+		playlist, err := controller.CreatePlaylistWithProgress(
+			ctx,
+			"https://www.discogs.com/user/digger/collection",
+			entities.PlaylistOptions{Sync: true, RemoveMissing: true},
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if !playlist.Synced || playlist.ID != "synced-playlist" {
+			t.Errorf("got playlist %s synced %v, want synced-playlist synced", playlist.ID, playlist.Synced)
+		}
+		if want := []string{"spotify:track:catholic"}; !reflect.DeepEqual(spotifyServiceMock.AddedUris, want) {
+			t.Errorf("got added %v, want %v", spotifyServiceMock.AddedUris, want)
+		}
+		if want := []string{"spotify:track:sucks"}; !reflect.DeepEqual(spotifyServiceMock.RemovedUris, want) {
+			t.Errorf("got removed %v, want %v", spotifyServiceMock.RemovedUris, want)
+		}
+
+		saved, err := store.Get(ctx, "wizzler", "collection/digger")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		want := []string{entities.SpotifyAlbumIDMiloGoesToCollege, entities.SpotifyAlbumIDCatholicBoy}
+		if !reflect.DeepEqual(saved.AlbumIDs, want) {
+			t.Errorf("got synced albums %v, want %v", saved.AlbumIDs, want)
+		}
+	})
+
+	t.Run("sync without a previous playlist creates and remembers one", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums(),
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults()}
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+		store := syncs.NewInMemoryStore()
+		controller := NewPlaylistControllerWithOptions(discogsServiceMock, spotifyServiceMock, ControllerOptions{Syncs: store})
+
+		playlist, err := controller.CreatePlaylistWithProgress(
+			ctx,
+			"https://www.discogs.com/user/digger/collection",
+			entities.PlaylistOptions{Sync: true},
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if playlist.Synced {
+			t.Errorf("got a synced playlist, want a new one")
+		}
+		saved, err := store.Get(ctx, "wizzler", "collection/digger")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if saved.PlaylistID != playlist.ID || len(saved.AlbumIDs) != 2 {
+			t.Errorf("got %+v, want playlist %s with 2 albums", saved, playlist.ID)
+		}
+	})
+
+	t.Run("add a release to an existing playlist", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Release: &entities.DiscogsReleaseDetail{
+				ID:       1,
+				MasterID: 2,
+				Title:    "Catholic Boy",
+				Year:     1980,
+				Artists:  []entities.DiscogsArtist{{Name: "The Jim Carroll Band"}},
+			},
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResponses: [][]entities.SpotifyAlbumItem{
+				entities.MotherSpotifyAlbums()[2:4],
+			},
+			AlbumTracks: map[string][]string{
+				entities.SpotifyAlbumIDCatholicBoy: {"spotify:track:catholic"},
+			},
+		}
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+		controller := NewPlaylistController(discogsServiceMock, spotifyServiceMock)
+
+		playlist, err := controller.CreatePlaylistWithProgress(
+			ctx,
+			"https://www.discogs.com/release/1-The-Jim-Carroll-Band-Catholic-Boy",
+			entities.PlaylistOptions{PlaylistID: "existing-playlist"},
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if playlist.ID != "existing-playlist" || !playlist.Synced {
+			t.Errorf("got playlist %s synced %v, want existing-playlist synced", playlist.ID, playlist.Synced)
+		}
+		if want := []string{"spotify:track:catholic"}; !reflect.DeepEqual(spotifyServiceMock.AddedUris, want) {
+			t.Errorf("got added %v, want %v", spotifyServiceMock.AddedUris, want)
+		}
+	})
+
+	t.Run("match compilations track by track", func(t *testing.T) {
+		compilation := entities.DiscogsRelease{
+			BasicInformation: entities.DiscogsBasicInformation{
+				ID:      10,
+				Title:   "Artificial Intelligence",
+				Artists: []entities.DiscogsArtist{{Name: "Various"}},
+			},
+		}
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: []entities.DiscogsRelease{entities.MotherTwoDiscogsAlbums()[0], compilation},
+			Release: &entities.DiscogsReleaseDetail{
+				ID: 10,
+				Tracklist: []entities.DiscogsTrack{
+					{Position: "A1", Type: "track", Title: "Polygon Window", Artists: []entities.DiscogsArtist{{Name: "The Dice Man"}}},
+					{Position: "A2", Type: "track", Title: "Spiritual High", Artists: []entities.DiscogsArtist{{Name: "Musicology"}}},
+				},
+			},
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResponses: [][]entities.SpotifyAlbumItem{
+				entities.MotherSpotifyAlbums()[0:2],
+			},
+			AlbumTracks: map[string][]string{
+				entities.SpotifyAlbumIDMiloGoesToCollege: {"spotify:track:milo"},
+			},
+			TrackResults: map[string][]entities.SpotifyTrackItem{
+				"Polygon Window": {{
+					URI:     "spotify:track:polygon",
+					Name:    "Polygon Window",
+					Artists: []entities.SpotifyAlbumArtist{{Name: "The Dice Man"}},
+				}},
+			},
+		}
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+		store := syncs.NewInMemoryStore()
+		controller := NewPlaylistControllerWithOptions(discogsServiceMock, spotifyServiceMock, ControllerOptions{Syncs: store})
+
+		playlist, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if playlist.SpotifyAlbums != 1 || playlist.SpotifyTracks != 1 {
+			t.Errorf("got %d albums and %d tracks, want 1 and 1", playlist.SpotifyAlbums, playlist.SpotifyTracks)
+		}
+		if want := []string{"spotify:track:milo", "spotify:track:polygon"}; !reflect.DeepEqual(spotifyServiceMock.AddedUris, want) {
+			t.Errorf("got added %v, want %v", spotifyServiceMock.AddedUris, want)
+		}
+		match := playlist.Matches[1]
+		if !match.Matched() || match.Album.Tracks != 2 || match.Candidates != 1 {
+			t.Errorf("got compilation match %+v, want 1 of 2 tracks matched", match)
+		}
+
+		saved, err := store.Get(ctx, "wizzler", "collection/digger")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if want := []string{"spotify:track:polygon"}; !reflect.DeepEqual(saved.TrackURIs, want) {
+			t.Errorf("got synced tracks %v, want %v", saved.TrackURIs, want)
+		}
+	})
+
+	t.Run("sync removes the tracks of compilations no longer on Discogs", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums()[0:1],
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResponses: [][]entities.SpotifyAlbumItem{
+				entities.MotherSpotifyAlbums()[0:2],
+			},
+			PlaylistItems: []entities.SpotifyPlaylistItem{
+				{TrackURI: "spotify:track:milo", AlbumID: entities.SpotifyAlbumIDMiloGoesToCollege},
+				{TrackURI: "spotify:track:polygon", AlbumID: "polygon-album"},
+			},
+		}
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+		store := syncs.NewInMemoryStore()
+		_ = store.Save(ctx, &entities.PlaylistSync{
+			UserID:     "wizzler",
+			Source:     "collection/digger",
+			PlaylistID: "synced-playlist",
+			AlbumIDs:   []string{entities.SpotifyAlbumIDMiloGoesToCollege},
+			TrackURIs:  []string{"spotify:track:polygon"},
+		})
+		controller := NewPlaylistControllerWithOptions(discogsServiceMock, spotifyServiceMock, ControllerOptions{Syncs: store})
+
+		_, err := controller.CreatePlaylistWithProgress(
+			ctx,
+			"https://www.discogs.com/user/digger/collection",
+			entities.PlaylistOptions{Sync: true, RemoveMissing: true},
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if len(spotifyServiceMock.AddedUris) != 0 {
+			t.Errorf("got added %v, want none", spotifyServiceMock.AddedUris)
+		}
+		if want := []string{"spotify:track:polygon"}; !reflect.DeepEqual(spotifyServiceMock.RemovedUris, want) {
+			t.Errorf("got removed %v, want %v", spotifyServiceMock.RemovedUris, want)
+		}
+	})
+
+	t.Run("match releases as the pages come in", func(t *testing.T) {
+		albums := append(entities.MotherTwoDiscogsAlbums(), entities.MotherNAlbums(1)...)
+		discogsServiceMock := &discogs.ServiceMock{
+			Pages:     [][]entities.DiscogsRelease{albums[0:1], albums[1:3]},
+			PageOrder: []int{2, 1},
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults(),
+			AlbumTracks: map[string][]string{
+				entities.SpotifyAlbumIDMiloGoesToCollege: {"spotify:track:milo"},
+			},
+		}
+		controller := NewPlaylistController(discogsServiceMock, spotifyServiceMock)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		playlist, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if playlist.DiscogsReleases != 3 {
+			t.Errorf("got %d releases, want 3", playlist.DiscogsReleases)
+		}
+		if len(playlist.Matches) != 3 {
+			t.Fatalf("got %d matches, want 3", len(playlist.Matches))
+		}
+		for i, match := range playlist.Matches {
+			if match.Album.Title != entities.CleanDiscogsName(albums[i].BasicInformation.Title) {
+				t.Errorf("got match %d for %s, want %s", i, match.Album.Title, albums[i].BasicInformation.Title)
+			}
+		}
+		if playlist.Matches[0].SpotifyAlbumID != entities.SpotifyAlbumIDMiloGoesToCollege {
+			t.Errorf("got album %s, want %s", playlist.Matches[0].SpotifyAlbumID, entities.SpotifyAlbumIDMiloGoesToCollege)
+		}
+		if playlist.TracksAdded != 1 {
+			t.Errorf("got %d tracks added, want 1", playlist.TracksAdded)
+		}
+	})
+
+	t.Run("stop when a discogs page fails", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{
+			Pages: [][]entities.DiscogsRelease{entities.MotherTwoDiscogsAlbums()},
+			Error: errors.New("discogs page failed"),
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults()}
+		controller := NewPlaylistController(discogsServiceMock, spotifyServiceMock)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		_, err := controller.CreatePlaylist(ctx, "https://www.discogs.com/user/digger/collection")
+		if err == nil || err.Error() != "discogs page failed" {
+			t.Errorf("got error %v, want discogs page failed", err)
+		}
+		if len(spotifyServiceMock.AddedUris) != 0 {
+			t.Errorf("did not expect tracks added, got %v", spotifyServiceMock.AddedUris)
+		}
+	})
+
 	t.Run("filter duplicates and not founds", func(t *testing.T) {
 		discogsServiceMock := &discogs.ServiceMock{}
 		spotifyServiceMock := &spotify.ServiceMock{}
@@ -0,0 +1,300 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+)
+
+var ErrJobQueueFull = errors.New("too many playlists being created, try again later")
+var ErrJobsClosed = errors.New("the server is shutting down, try again later")
+
+const (
+	jobQueueSize     = 100
+	jobIDLength      = 16
+	subscriberBuffer = 64
+)
+
+type queuedJob struct {
+	ctx context.Context
+	job *entities.Job
+}
+
+// PlaylistJobs runs playlist creations in background workers and tracks their progress
+type PlaylistJobs struct {
+	controller *Controller
+	store      ports.JobPort
+	queue      chan queuedJob
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	closed     bool
+	// subscribers of the running jobs by job ID, guarded by subsMu
+	subscribers map[string]map[chan entities.ProgressEvent]struct{}
+	subsMu      sync.Mutex
+	// streamsEnded is set once EndStreams is called, later subscribers get a closed channel
+	streamsEnded bool
+	// ctx is canceled when Close gives up waiting, aborting the running jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewPlaylistJobs(controller *Controller, store ports.JobPort, workers int) *PlaylistJobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &PlaylistJobs{
+		controller:  controller,
+		store:       store,
+		queue:       make(chan queuedJob, jobQueueSize),
+		subscribers: make(map[string]map[chan entities.ProgressEvent]struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	for range workers {
+		j.wg.Add(1)
+		go j.work()
+	}
+	return j
+}
+
+// Submit validates the URL and the playlist to add to, if any, and enqueues a new job,
+// ctx must outlive the request that submitted it
+func (j *PlaylistJobs) Submit(
+	ctx context.Context,
+	userID, discogsURL string,
+	options entities.PlaylistOptions,
+) (*entities.Job, error) {
+	if _, err := parseDiscogsURL(discogsURL); err != nil {
+		return nil, errors.Wrap(err, "error parsing Discogs URL")
+	}
+	if options.PlaylistID != "" {
+		playlistID, err := parseSpotifyPlaylistID(options.PlaylistID)
+		if err != nil {
+			return nil, err
+		}
+		options.PlaylistID = playlistID
+	}
+
+	id, err := generateJobID()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating job id")
+	}
+
+	now := time.Now()
+	job := &entities.Job{
+		ID:         id,
+		UserID:     userID,
+		DiscogsURL: discogsURL,
+		Options:    options,
+		Stage:      entities.JobQueued,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	// only Submit sends to the queue, so a job saved after the checks always gets a place in it
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return nil, ErrJobsClosed
+	}
+	if len(j.queue) == cap(j.queue) {
+		return nil, ErrJobQueueFull
+	}
+	if err := j.store.Save(ctx, job); err != nil {
+		return nil, errors.Wrap(err, "error saving job")
+	}
+	// the queued job is updated by its worker, the caller gets its state at submission
+	submitted := *job
+	j.queue <- queuedJob{ctx: ctx, job: job}
+	return &submitted, nil
+}
+
+// Get returns the job only if it belongs to the given user
+func (j *PlaylistJobs) Get(ctx context.Context, userID, id string) (*entities.Job, error) {
+	job, err := j.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, errorWrapper.Wrap(errorWrapper.ErrNotFound, "job "+id)
+	}
+	return job, nil
+}
+
+// Subscribe returns the current state of the job and a channel with its following progress events.
+// The channel is closed when the job finishes or EndStreams is called, events are dropped if the listener
+// falls behind.
+// The returned function must be called to stop listening
+func (j *PlaylistJobs) Subscribe(
+	ctx context.Context,
+	userID, id string,
+) (*entities.Job, <-chan entities.ProgressEvent, func(), error) {
+	// holding subsMu while reading the job ensures no event is missed between both steps
+	j.subsMu.Lock()
+	defer j.subsMu.Unlock()
+
+	job, err := j.Get(ctx, userID, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	events := make(chan entities.ProgressEvent, subscriberBuffer)
+	if job.Finished() || j.streamsEnded {
+		close(events)
+		return job, events, func() {}, nil
+	}
+
+	if j.subscribers[id] == nil {
+		j.subscribers[id] = make(map[chan entities.ProgressEvent]struct{})
+	}
+	j.subscribers[id][events] = struct{}{}
+
+	unsubscribe := func() {
+		j.subsMu.Lock()
+		defer j.subsMu.Unlock()
+		if _, exists := j.subscribers[id][events]; exists {
+			delete(j.subscribers[id], events)
+			close(events)
+		}
+	}
+	return job, events, unsubscribe, nil
+}
+
+// EndStreams closes the channels of every subscriber, so the connections listening to the jobs
+// don't hold the server shutdown while the jobs keep running
+func (j *PlaylistJobs) EndStreams() {
+	j.subsMu.Lock()
+	defer j.subsMu.Unlock()
+
+	j.streamsEnded = true
+	for id, subscribers := range j.subscribers {
+		for events := range subscribers {
+			close(events)
+		}
+		delete(j.subscribers, id)
+	}
+}
+
+// Close stops accepting jobs and waits for the queued ones to finish,
+// canceling them if ctx is done first
+func (j *PlaylistJobs) Close(ctx context.Context) {
+	j.mu.Lock()
+	if !j.closed {
+		j.closed = true
+		close(j.queue)
+	}
+	j.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		j.cancel()
+		<-done
+	}
+	j.cancel()
+}
+
+func (j *PlaylistJobs) work() {
+	defer j.wg.Done()
+	for queued := range j.queue {
+		j.run(queued.ctx, queued.job)
+	}
+}
+
+func (j *PlaylistJobs) run(ctx context.Context, job *entities.Job) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(j.ctx, cancel)
+	defer stop()
+
+	// progress events arrive concurrently from the album search goroutines
+	var mu sync.Mutex
+	update := func(event *entities.ProgressEvent, fn func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn()
+		job.UpdatedAt = time.Now()
+
+		j.subsMu.Lock()
+		defer j.subsMu.Unlock()
+		if err := j.store.Save(ctx, job); err != nil {
+			log.Println("error saving job", job.ID, err)
+		}
+		if event != nil {
+			j.broadcast(job.ID, *event)
+		}
+	}
+
+	playlist, err := j.controller.CreatePlaylistWithProgress(ctx, job.DiscogsURL, job.Options, func(event entities.ProgressEvent) {
+		update(&event, func() {
+			applyProgress(job, event)
+			// the totals go along with every event, a listener that fell behind catches up with the next one
+			if event.Type == entities.ProgressAlbumMatched || event.Type == entities.ProgressAlbumUnmatched {
+				event.Processed = job.Processed
+				event.Matched = job.Matched
+			}
+		})
+	})
+
+	update(nil, func() {
+		if err != nil {
+			job.Stage = entities.JobFailed
+			job.Err = err
+			return
+		}
+		job.Stage = entities.JobDone
+		job.Playlist = playlist
+	})
+
+	j.subsMu.Lock()
+	defer j.subsMu.Unlock()
+	for events := range j.subscribers[job.ID] {
+		close(events)
+	}
+	delete(j.subscribers, job.ID)
+}
+
+// broadcast sends the event to the job subscribers, must be called with subsMu held
+func (j *PlaylistJobs) broadcast(id string, event entities.ProgressEvent) {
+	for events := range j.subscribers[id] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+func applyProgress(job *entities.Job, event entities.ProgressEvent) {
+	switch event.Type {
+	case entities.ProgressStage:
+		job.Stage = event.Stage
+	case entities.ProgressReleasesFetched:
+		job.Releases = event.Count
+	case entities.ProgressAlbumMatched:
+		job.Processed++
+		job.Matched++
+	case entities.ProgressAlbumUnmatched:
+		job.Processed++
+	}
+}
+
+func generateJobID() (string, error) {
+	b := make([]byte, jobIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
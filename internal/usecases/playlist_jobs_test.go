@@ -0,0 +1,208 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/martiriera/discogs-spotify/internal/adapters/discogs"
+	"github.com/martiriera/discogs-spotify/internal/adapters/spotify"
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/jobs"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
+	"github.com/martiriera/discogs-spotify/util"
+)
+
+func TestPlaylistJobs(t *testing.T) {
+	newJobs := func(t *testing.T) *PlaylistJobs {
+		t.Helper()
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums(),
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults()}
+		controller := NewPlaylistController(discogsServiceMock, spotifyServiceMock)
+		playlistJobs := NewPlaylistJobs(controller, jobs.NewInMemoryStore(), 1)
+		t.Cleanup(func() { playlistJobs.Close(context.Background()) })
+		return playlistJobs
+	}
+
+	t.Run("job reports progress and playlist", func(t *testing.T) {
+		playlistJobs := newJobs(t)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		job, err := playlistJobs.Submit(ctx, "wizzler", "https://www.discogs.com/user/digger/collection", entities.PlaylistOptions{})
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if job.Stage != entities.JobQueued {
+			t.Errorf("got stage %s, want %s", job.Stage, entities.JobQueued)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !job.Finished() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			job, err = playlistJobs.Get(ctx, "wizzler", job.ID)
+			if err != nil {
+				t.Fatalf("did not expect error, got %v", err)
+			}
+		}
+
+		if job.Stage != entities.JobDone {
+			t.Fatalf("got stage %s, want %s (error: %v)", job.Stage, entities.JobDone, job.Err)
+		}
+		if job.Releases != 2 || job.Processed != 2 || job.Matched != 2 {
+			t.Errorf("got %d releases, %d processed, %d matched, want 2 each", job.Releases, job.Processed, job.Matched)
+		}
+		if job.Playlist == nil || job.Playlist.ID != "6rqhFgbbKwnb9MLmUQDhG6" {
+			t.Errorf("got playlist %v, want 6rqhFgbbKwnb9MLmUQDhG6", job.Playlist)
+		}
+	})
+
+	t.Run("subscriber receives events until the job finishes", func(t *testing.T) {
+		playlistJobs := newJobs(t)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		job, err := playlistJobs.Submit(ctx, "wizzler", "https://www.discogs.com/user/digger/collection", entities.PlaylistOptions{})
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		_, events, unsubscribe, err := playlistJobs.Subscribe(ctx, "wizzler", job.ID)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		defer unsubscribe()
+
+		matched := 0
+		var last entities.ProgressEvent
+		for event := range events {
+			if event.Type == entities.ProgressAlbumMatched {
+				matched++
+				last = event
+			}
+		}
+		if matched != 2 {
+			t.Errorf("got %d matched events, want 2", matched)
+		}
+		if last.Processed != 2 || last.Matched != 2 {
+			t.Errorf("got %d processed and %d matched on the last event, want the totals of 2", last.Processed, last.Matched)
+		}
+
+		job, err = playlistJobs.Get(ctx, "wizzler", job.ID)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if job.Stage != entities.JobDone {
+			t.Errorf("got stage %s, want %s", job.Stage, entities.JobDone)
+		}
+	})
+
+	t.Run("ending the streams leaves the job running", func(t *testing.T) {
+		discogsServiceMock := &discogs.ServiceMock{Response: entities.MotherTwoDiscogsAlbums()}
+		spotifyServiceMock := &spotify.ServiceMock{SearchAlbumResults: entities.MotherSpotifySearchResults(), SleepMillis: 300}
+		playlistJobs := NewPlaylistJobs(NewPlaylistController(discogsServiceMock, spotifyServiceMock), jobs.NewInMemoryStore(), 1)
+		t.Cleanup(func() { playlistJobs.Close(context.Background()) })
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		job, err := playlistJobs.Submit(ctx, "wizzler", "https://www.discogs.com/user/digger/collection", entities.PlaylistOptions{})
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		_, events, unsubscribe, err := playlistJobs.Subscribe(ctx, "wizzler", job.ID)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		defer unsubscribe()
+
+		playlistJobs.EndStreams()
+		ended := make(chan struct{})
+		go func() {
+			for range events {
+			}
+			close(ended)
+		}()
+		select {
+		case <-ended:
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("expected the stream to end before the job")
+		}
+		if _, later, _, _ := playlistJobs.Subscribe(ctx, "wizzler", job.ID); later != nil {
+			if _, open := <-later; open {
+				t.Error("expected the streams opened afterwards to be closed")
+			}
+		}
+
+		playlistJobs.Close(context.Background())
+		if job, _ = playlistJobs.Get(ctx, "wizzler", job.ID); job.Stage != entities.JobDone {
+			t.Errorf("got stage %s, want the job to finish", job.Stage)
+		}
+	})
+
+	t.Run("job of another user is not found", func(t *testing.T) {
+		playlistJobs := newJobs(t)
+		ctx := context.Background()
+
+		job, err := playlistJobs.Submit(ctx, "wizzler", "https://www.discogs.com/user/digger/collection", entities.PlaylistOptions{})
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+
+		_, err = playlistJobs.Get(ctx, "someone-else", job.ID)
+		if !errorWrapper.Is(err, errorWrapper.ErrNotFound) {
+			t.Errorf("got %v, want %v", err, errorWrapper.ErrNotFound)
+		}
+	})
+
+	t.Run("invalid url is rejected on submit", func(t *testing.T) {
+		playlistJobs := newJobs(t)
+
+		_, err := playlistJobs.Submit(context.Background(), "wizzler", "https://www.discogs.com/user/digger", entities.PlaylistOptions{})
+		if !errorWrapper.Is(err, ErrInvalidDiscogsURL) {
+			t.Errorf("got %v, want %v", err, ErrInvalidDiscogsURL)
+		}
+	})
+
+	t.Run("job rejected for a full queue is not kept", func(t *testing.T) {
+		// without workers nothing leaves the queue
+		store := &countingJobStore{InMemoryStore: jobs.NewInMemoryStore()}
+		playlistJobs := NewPlaylistJobs(NewPlaylistController(&discogs.ServiceMock{}, &spotify.ServiceMock{}), store, 0)
+		defer playlistJobs.Close(context.Background())
+
+		var err error
+		for range jobQueueSize + 1 {
+			_, err = playlistJobs.Submit(context.Background(), "wizzler", "https://www.discogs.com/user/digger/collection", entities.PlaylistOptions{})
+		}
+		if !errorWrapper.Is(err, ErrJobQueueFull) {
+			t.Errorf("got %v, want %v", err, ErrJobQueueFull)
+		}
+		if store.saved != jobQueueSize {
+			t.Errorf("got %d jobs saved, want %d", store.saved, jobQueueSize)
+		}
+	})
+
+	t.Run("submit after close is rejected as shutting down", func(t *testing.T) {
+		playlistJobs := newJobs(t)
+		playlistJobs.Close(context.Background())
+
+		_, err := playlistJobs.Submit(context.Background(), "wizzler", "https://www.discogs.com/user/digger/collection", entities.PlaylistOptions{})
+		if !errorWrapper.Is(err, ErrJobsClosed) {
+			t.Errorf("got %v, want %v", err, ErrJobsClosed)
+		}
+	})
+}
+
+// countingJobStore counts the jobs saved for the first time
+type countingJobStore struct {
+	*jobs.InMemoryStore
+	saved int
+}
+
+func (s *countingJobStore) Save(ctx context.Context, job *entities.Job) error {
+	if _, err := s.InMemoryStore.Get(ctx, job.ID); err != nil {
+		s.saved++
+	}
+	return s.InMemoryStore.Save(ctx, job)
+}
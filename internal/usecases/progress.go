@@ -0,0 +1,16 @@
+package usecases
+
+import "github.com/martiriera/discogs-spotify/internal/core/entities"
+
+// ProgressFunc receives progress events while a playlist is being created
+type ProgressFunc func(event entities.ProgressEvent)
+
+func (f ProgressFunc) report(event entities.ProgressEvent) {
+	if f != nil {
+		f(event)
+	}
+}
+
+func (f ProgressFunc) stage(stage entities.JobStage) {
+	f.report(entities.ProgressEvent{Type: entities.ProgressStage, Stage: stage})
+}
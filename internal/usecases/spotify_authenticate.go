@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -15,16 +16,19 @@ import (
 	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
 )
 
-var oauthState, _ = generateRandomState()
-
 const (
 	ErrNoCode                     = "spotify: no code in callback"
 	ErrRedirectStateParamMismatch = "spotify: redirect state parameter doesn't match"
 	ErrErrorInCallback            = "spotify: error in callback"
 	ErrExchangingCode             = "spotify: error exchanging code"
 	ErrSavingSession              = "spotify: error saving session"
+	ErrGeneratingState            = "spotify: error generating state"
+	ErrNoCodeVerifier             = "spotify: no PKCE code verifier for login"
+	ErrNoRefreshToken             = "spotify: no refresh token"
+	ErrRefreshingToken            = "spotify: error refreshing token"
 
 	randomStateLength = 16
+	defaultReturnTo   = "/home"
 )
 
 var scopes = []string{
@@ -38,11 +42,13 @@ var scopes = []string{
 type OAuth2Config interface {
 	AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string
 	Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error)
+	TokenSource(ctx context.Context, t *oauth2.Token) oauth2.TokenSource
 }
 
 type SpotifyAuthenticate struct {
-	config     OAuth2Config
-	oauthState string
+	config OAuth2Config
+	// pkce enables the Proof Key for Code Exchange flow, which doesn't need a client secret
+	pkce bool
 }
 
 func NewSpotifyAuthenticate(clientID, clientSecret, redirectURL string) *SpotifyAuthenticate {
@@ -54,50 +60,153 @@ func NewSpotifyAuthenticate(clientID, clientSecret, redirectURL string) *Spotify
 			Scopes:       scopes,
 			Endpoint:     spotify.Endpoint,
 		},
-		oauthState: oauthState,
+	}
+}
+
+// NewSpotifyAuthenticatePKCE creates a SpotifyAuthenticate using the PKCE flow,
+// so deployments can authenticate users without holding the client secret
+func NewSpotifyAuthenticatePKCE(clientID, redirectURL string) *SpotifyAuthenticate {
+	// without a secret the client ID has to be sent in the body of token requests
+	endpoint := spotify.Endpoint
+	endpoint.AuthStyle = oauth2.AuthStyleInParams
+
+	return &SpotifyAuthenticate{
+		config: &oauth2.Config{
+			ClientID:    clientID,
+			RedirectURL: redirectURL,
+			Scopes:      scopes,
+			Endpoint:    endpoint,
+		},
+		pkce: true,
 	}
 }
 
 // NewSpotifyAuthenticateWithConfig creates a new SpotifyAuthenticate with a custom OAuth2 config
 // This is mainly used for testing purposes
-func NewSpotifyAuthenticateWithConfig(config OAuth2Config, oauthState string) *SpotifyAuthenticate {
+func NewSpotifyAuthenticateWithConfig(config OAuth2Config) *SpotifyAuthenticate {
 	return &SpotifyAuthenticate{
-		config:     config,
-		oauthState: oauthState,
+		config: config,
 	}
 }
 
-func (o *SpotifyAuthenticate) GetAuthURL() string {
-	return o.config.AuthCodeURL(o.oauthState, oauth2.AccessTypeOffline)
+// NewSpotifyAuthenticatePKCEWithConfig creates a new PKCE SpotifyAuthenticate with a custom OAuth2 config
+// This is mainly used for testing purposes
+func NewSpotifyAuthenticatePKCEWithConfig(config OAuth2Config) *SpotifyAuthenticate {
+	return &SpotifyAuthenticate{
+		config: config,
+		pkce:   true,
+	}
 }
 
-func (o *SpotifyAuthenticate) GenerateToken(ctx context.Context, code string) (*oauth2.Token, error) {
+func (o *SpotifyAuthenticate) GetAuthURL(state string, opts ...oauth2.AuthCodeOption) string {
+	return o.config.AuthCodeURL(state, append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, opts...)...)
+}
+
+// StartLogin stores a fresh state in the session, along with the page to go back to
+// once logged in, and returns the Spotify URL the user has to be redirected to
+func (o *SpotifyAuthenticate) StartLogin(ctx *gin.Context, s ports.SessionPort, returnTo string) (string, error) {
+	state, err := generateRandomState()
+	if err != nil {
+		return "", errors.Wrap(err, ErrGeneratingState)
+	}
+
+	loginState := session.LoginState{State: state, ReturnTo: sanitizeReturnTo(returnTo)}
+	var opts []oauth2.AuthCodeOption
+	if o.pkce {
+		loginState.Verifier = oauth2.GenerateVerifier()
+		opts = append(opts, oauth2.S256ChallengeOption(loginState.Verifier))
+	}
+
+	if err := s.SetData(ctx.Request, ctx.Writer, session.LoginStateKey, loginState); err != nil {
+		return "", errors.Wrap(err, ErrSavingSession)
+	}
+
+	return o.GetAuthURL(state, opts...), nil
+}
+
+func (o *SpotifyAuthenticate) GenerateToken(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
 	if code == "" {
 		return nil, errors.New(ErrNoCode)
 	}
 
-	token, err := o.config.Exchange(ctx, code)
+	token, err := o.config.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, ErrExchangingCode)
 	}
 	return token, nil
 }
 
-func (o *SpotifyAuthenticate) GenerateTokenFromGin(ctx *gin.Context) (*oauth2.Token, error) {
+// GenerateTokenFromGin checks the callback against the login state stored in the session,
+// which can only be used once, and returns the token and the page to go back to
+func (o *SpotifyAuthenticate) GenerateTokenFromGin(ctx *gin.Context, s ports.SessionPort) (*oauth2.Token, string, error) {
+	loginState, err := consumeLoginState(ctx, s)
+	if err != nil {
+		return nil, "", err
+	}
+
 	values := ctx.Request.URL.Query()
 	if err := values.Get("error"); err != "" {
-		return nil, errors.Wrap(errors.New(err), ErrErrorInCallback)
+		return nil, "", errors.Wrap(errors.New(err), ErrErrorInCallback)
 	}
 	code := values.Get("code")
 	if code == "" {
-		return nil, errors.New(ErrNoCode)
+		return nil, "", errors.New(ErrNoCode)
 	}
 	actualState := values.Get("state")
-	if actualState != o.oauthState {
-		return nil, errors.New(ErrRedirectStateParamMismatch)
+	if loginState.State == "" || actualState != loginState.State {
+		return nil, "", errors.New(ErrRedirectStateParamMismatch)
+	}
+
+	var opts []oauth2.AuthCodeOption
+	if o.pkce {
+		if loginState.Verifier == "" {
+			return nil, "", errors.New(ErrNoCodeVerifier)
+		}
+		opts = append(opts, oauth2.VerifierOption(loginState.Verifier))
+	}
+
+	token, err := o.GenerateToken(ctx, code, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return token, loginState.ReturnTo, nil
+}
+
+// consumeLoginState reads the login state from the session and clears it
+func consumeLoginState(ctx *gin.Context, s ports.SessionPort) (session.LoginState, error) {
+	data, err := s.GetData(ctx.Request, session.LoginStateKey)
+	if err != nil {
+		return session.LoginState{}, errors.New(ErrRedirectStateParamMismatch)
+	}
+	loginState, _ := data.(session.LoginState)
+
+	if err := s.SetData(ctx.Request, ctx.Writer, session.LoginStateKey, session.LoginState{}); err != nil {
+		return session.LoginState{}, errors.Wrap(err, ErrSavingSession)
 	}
+	return loginState, nil
+}
 
-	return o.GenerateToken(ctx, code)
+// sanitizeReturnTo only accepts local paths, to avoid redirecting to other sites after login
+func sanitizeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return defaultReturnTo
+	}
+	return returnTo
+}
+
+// RefreshToken gets a new access token using the refresh token obtained on login.
+// The refresh is forced even if the token looks valid, as Spotify may have rejected it already
+func (o *SpotifyAuthenticate) RefreshToken(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	if token == nil || token.RefreshToken == "" {
+		return nil, errors.New(ErrNoRefreshToken)
+	}
+
+	stale := &oauth2.Token{RefreshToken: token.RefreshToken}
+	refreshed, err := o.config.TokenSource(ctx, stale).Token()
+	if err != nil {
+		return nil, errors.Wrap(err, ErrRefreshingToken)
+	}
+	return refreshed, nil
 }
 
 func (*SpotifyAuthenticate) StoreToken(ctx *gin.Context, s ports.SessionPort, token *oauth2.Token) error {
@@ -19,6 +19,7 @@ import (
 type mockOauth2Config struct {
 	authCodeURL  func(string, ...oauth2.AuthCodeOption) string
 	exchangeFunc func(string, ...oauth2.AuthCodeOption) (*oauth2.Token, error)
+	refreshFunc  func(*oauth2.Token) (*oauth2.Token, error)
 }
 
 func (m *mockOauth2Config) AuthCodeURL(state string, _ ...oauth2.AuthCodeOption) string {
@@ -39,6 +40,32 @@ func (m *mockOauth2Config) Exchange(_ context.Context, code string, opts ...oaut
 	}, nil
 }
 
+type mockTokenSource struct {
+	token     *oauth2.Token
+	refreshFn func(*oauth2.Token) (*oauth2.Token, error)
+}
+
+func (m *mockTokenSource) Token() (*oauth2.Token, error) {
+	if m.token.Valid() {
+		return m.token, nil
+	}
+	return m.refreshFn(m.token)
+}
+
+func (m *mockOauth2Config) TokenSource(_ context.Context, t *oauth2.Token) oauth2.TokenSource {
+	refreshFn := m.refreshFunc
+	if refreshFn == nil {
+		refreshFn = func(t *oauth2.Token) (*oauth2.Token, error) {
+			return &oauth2.Token{
+				AccessToken:  "refreshed_access_token",
+				RefreshToken: t.RefreshToken,
+				Expiry:       time.Now().Add(time.Hour),
+			}, nil
+		}
+	}
+	return &mockTokenSource{token: t, refreshFn: refreshFn}
+}
+
 type mockSession struct {
 	data         map[session.ContextKey]any
 	setDataError error
@@ -73,25 +100,88 @@ func createMockConfig() *mockOauth2Config {
 	return &mockOauth2Config{}
 }
 
+const testOAuthState = "test_state"
+
+// newLoginSession returns a session holding the state of a login in progress
+func newLoginSession() *mockSession {
+	return &mockSession{
+		data: map[session.ContextKey]any{
+			session.LoginStateKey: session.LoginState{State: testOAuthState, ReturnTo: "/home"},
+		},
+	}
+}
+
 func TestSpotifyAuthenticate_GetAuthURL(t *testing.T) {
 	mockConfig := createMockConfig()
-	controller := NewSpotifyAuthenticateWithConfig(mockConfig, oauthState)
-	redirectURL := controller.GetAuthURL()
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
+	redirectURL := controller.GetAuthURL(testOAuthState)
 
 	want := "https://accounts.spotify.com/authorize?access_type=offline&client_id=test_client_id&redirect_uri=http%3A%2F%2Flocalhost%3A8080%2Fcallback&response_type=code&scope=user-read-private+user-read-email+playlist-modify-public+playlist-modify-private&state=" +
-		url.QueryEscape(oauthState)
+		url.QueryEscape(testOAuthState)
 
 	if redirectURL != want {
 		t.Errorf("got %s, want %s", redirectURL, want)
 	}
 }
 
+func TestSpotifyAuthenticate_StartLogin(t *testing.T) {
+	tcs := []struct {
+		name         string
+		returnTo     string
+		wantReturnTo string
+	}{
+		{name: "local path", returnTo: "/home?tab=1", wantReturnTo: "/home?tab=1"},
+		{name: "empty", returnTo: "", wantReturnTo: "/home"},
+		{name: "absolute URL", returnTo: "https://evil.com", wantReturnTo: "/home"},
+		{name: "protocol relative URL", returnTo: "//evil.com", wantReturnTo: "/home"},
+		{name: "backslash URL", returnTo: "/\\evil.com", wantReturnTo: "/home"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSession := &mockSession{}
+			controller := NewSpotifyAuthenticateWithConfig(createMockConfig())
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", "/auth/login", http.NoBody)
+
+			authURL, err := controller.StartLogin(ctx, mockSession, tc.returnTo)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			loginState, ok := mockSession.data[session.LoginStateKey].(session.LoginState)
+			if !ok || loginState.State == "" {
+				t.Fatalf("expected a login state in session, got %v", mockSession.data[session.LoginStateKey])
+			}
+			if !strings.HasSuffix(authURL, "&state="+url.QueryEscape(loginState.State)) {
+				t.Errorf("got %s, want it to end with the stored state %s", authURL, loginState.State)
+			}
+			if loginState.ReturnTo != tc.wantReturnTo {
+				t.Errorf("got return to %s, want %s", loginState.ReturnTo, tc.wantReturnTo)
+			}
+		})
+	}
+
+	t.Run("state is different on every login", func(t *testing.T) {
+		mockSession := &mockSession{}
+		controller := NewSpotifyAuthenticateWithConfig(createMockConfig())
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/auth/login", http.NoBody)
+
+		first, _ := controller.StartLogin(ctx, mockSession, "")
+		second, _ := controller.StartLogin(ctx, mockSession, "")
+		if first == second {
+			t.Errorf("expected different auth URLs, got %s twice", first)
+		}
+	})
+}
+
 func TestSpotifyAuthenticate_StoreTokenOnGorillaSession(t *testing.T) {
 	t.Setenv("SESSION_KEY", "session_key")
 	s := session.NewGorillaSession()
 	s.Init(60)
 	mockConfig := createMockConfig()
-	controller := NewSpotifyAuthenticateWithConfig(mockConfig, oauthState)
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
 	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
 	ctx.Request = httptest.NewRequest("POST", "/", http.NoBody)
 
@@ -128,7 +218,7 @@ func TestSpotifyAuthenticate_StoreTokenWithSessionError(t *testing.T) {
 		setDataError: errors.New("session error"),
 	}
 	mockConfig := createMockConfig()
-	controller := NewSpotifyAuthenticateWithConfig(mockConfig, oauthState)
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
 	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
 	ctx.Request = httptest.NewRequest("POST", "/", http.NoBody)
 
@@ -144,12 +234,12 @@ func TestSpotifyAuthenticate_StoreTokenWithSessionError(t *testing.T) {
 
 func TestSpotifyAuthenticate_GenerateTokenFromGinWithErrorInCallback(t *testing.T) {
 	mockConfig := createMockConfig()
-	controller := NewSpotifyAuthenticateWithConfig(mockConfig, oauthState)
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
 	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
 	ctx.Request = httptest.NewRequest("GET", "/callback?error=access_denied", http.NoBody)
 	const expectedError = ErrErrorInCallback + ": access_denied"
 
-	_, err := controller.GenerateTokenFromGin(ctx)
+	_, _, err := controller.GenerateTokenFromGin(ctx, newLoginSession())
 	if err == nil || err.Error() != expectedError {
 		t.Errorf("expected error %v, got %v", expectedError, err)
 	}
@@ -157,11 +247,11 @@ func TestSpotifyAuthenticate_GenerateTokenFromGinWithErrorInCallback(t *testing.
 
 func TestSpotifyAuthenticate_GenerateTokenFromGinWithNoCodeInCallback(t *testing.T) {
 	mockConfig := createMockConfig()
-	controller := NewSpotifyAuthenticateWithConfig(mockConfig, oauthState)
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
 	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
-	ctx.Request = httptest.NewRequest("GET", "/callback?state="+oauthState, http.NoBody)
+	ctx.Request = httptest.NewRequest("GET", "/callback?state="+testOAuthState, http.NoBody)
 
-	_, err := controller.GenerateTokenFromGin(ctx)
+	_, _, err := controller.GenerateTokenFromGin(ctx, newLoginSession())
 	if err == nil || err.Error() != ErrNoCode {
 		t.Errorf("expected error %v, got %v", ErrNoCode, err)
 	}
@@ -169,16 +259,44 @@ func TestSpotifyAuthenticate_GenerateTokenFromGinWithNoCodeInCallback(t *testing
 
 func TestSpotifyAuthenticate_GenerateTokenFromGinWithStateMismatch(t *testing.T) {
 	mockConfig := createMockConfig()
-	controller := NewSpotifyAuthenticateWithConfig(mockConfig, oauthState)
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
 	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
 	ctx.Request = httptest.NewRequest("GET", "/callback?code=auth_code&state=wrong_state", http.NoBody)
 
-	_, err := controller.GenerateTokenFromGin(ctx)
+	_, _, err := controller.GenerateTokenFromGin(ctx, newLoginSession())
+	if err == nil || err.Error() != ErrRedirectStateParamMismatch {
+		t.Errorf("expected error %v, got %v", ErrRedirectStateParamMismatch, err)
+	}
+}
+
+func TestSpotifyAuthenticate_GenerateTokenFromGinWithoutLoginInProgress(t *testing.T) {
+	mockConfig := createMockConfig()
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/callback?code=auth_code&state=", http.NoBody)
+
+	_, _, err := controller.GenerateTokenFromGin(ctx, &mockSession{})
 	if err == nil || err.Error() != ErrRedirectStateParamMismatch {
 		t.Errorf("expected error %v, got %v", ErrRedirectStateParamMismatch, err)
 	}
 }
 
+func TestSpotifyAuthenticate_GenerateTokenFromGinStateIsSingleUse(t *testing.T) {
+	mockConfig := createMockConfig()
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
+	loginSession := newLoginSession()
+
+	for i, wantErr := range []bool{false, true} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/callback?code=auth_code&state="+testOAuthState, http.NoBody)
+
+		_, _, err := controller.GenerateTokenFromGin(ctx, loginSession)
+		if (err != nil) != wantErr {
+			t.Errorf("callback %d: got error %v, want error %v", i, err, wantErr)
+		}
+	}
+}
+
 func TestSpotifyAuthenticate_GenerateTokenFromGinSuccessfully(t *testing.T) {
 	expectedToken := &oauth2.Token{
 		AccessToken: "test_access_token",
@@ -194,15 +312,19 @@ func TestSpotifyAuthenticate_GenerateTokenFromGinSuccessfully(t *testing.T) {
 		return expectedToken, nil
 	}
 
-	controller := NewSpotifyAuthenticateWithConfig(mockConfig, oauthState)
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
 	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
-	ctx.Request = httptest.NewRequest("GET", "/callback?code=test_auth_code&state="+oauthState, http.NoBody)
+	ctx.Request = httptest.NewRequest("GET", "/callback?code=test_auth_code&state="+testOAuthState, http.NoBody)
 
-	token, err := controller.GenerateTokenFromGin(ctx)
+	token, returnTo, err := controller.GenerateTokenFromGin(ctx, newLoginSession())
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 
+	if returnTo != "/home" {
+		t.Errorf("got return to %s, want /home", returnTo)
+	}
+
 	if token.AccessToken != expectedToken.AccessToken {
 		t.Errorf("got access token %s, want %s", token.AccessToken, expectedToken.AccessToken)
 	}
@@ -217,7 +339,7 @@ func TestSpotifyAuthenticate_GenerateTokenWithExchangeError(t *testing.T) {
 		return nil, errors.New("exchange error")
 	}
 
-	controller := NewSpotifyAuthenticateWithConfig(mockConfig, oauthState)
+	controller := NewSpotifyAuthenticateWithConfig(mockConfig)
 	ctx := context.Background()
 
 	_, err := controller.GenerateToken(ctx, "test_auth_code")
@@ -225,3 +347,120 @@ func TestSpotifyAuthenticate_GenerateTokenWithExchangeError(t *testing.T) {
 		t.Errorf("expected error containing %s, got %v", ErrExchangingCode, err)
 	}
 }
+
+func TestSpotifyAuthenticate_RefreshToken(t *testing.T) {
+	t.Run("refreshes token even if not expired", func(t *testing.T) {
+		controller := NewSpotifyAuthenticateWithConfig(createMockConfig())
+		token := &oauth2.Token{
+			AccessToken:  "rejected_access_token",
+			RefreshToken: "refresh_token",
+			Expiry:       time.Now().Add(time.Hour),
+		}
+
+		refreshed, err := controller.RefreshToken(context.Background(), token)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if refreshed.AccessToken != "refreshed_access_token" {
+			t.Errorf("got access token %s, want refreshed_access_token", refreshed.AccessToken)
+		}
+		if refreshed.RefreshToken != "refresh_token" {
+			t.Errorf("got refresh token %s, want refresh_token", refreshed.RefreshToken)
+		}
+	})
+
+	t.Run("fails without refresh token", func(t *testing.T) {
+		controller := NewSpotifyAuthenticateWithConfig(createMockConfig())
+
+		_, err := controller.RefreshToken(context.Background(), &oauth2.Token{AccessToken: "access_token"})
+		if err == nil || err.Error() != ErrNoRefreshToken {
+			t.Errorf("expected error %v, got %v", ErrNoRefreshToken, err)
+		}
+	})
+
+	t.Run("wraps refresh error", func(t *testing.T) {
+		mockConfig := createMockConfig()
+		mockConfig.refreshFunc = func(_ *oauth2.Token) (*oauth2.Token, error) {
+			return nil, errors.New("invalid_grant")
+		}
+		controller := NewSpotifyAuthenticateWithConfig(mockConfig)
+
+		_, err := controller.RefreshToken(context.Background(), &oauth2.Token{RefreshToken: "revoked"})
+		if err == nil || !strings.Contains(err.Error(), ErrRefreshingToken) {
+			t.Errorf("expected error containing %s, got %v", ErrRefreshingToken, err)
+		}
+	})
+}
+
+func TestSpotifyAuthenticate_PKCE(t *testing.T) {
+	var gotVerifier, gotSecret string
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotVerifier = r.FormValue("code_verifier")
+		gotSecret = r.FormValue("client_secret")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token": "pkce_access_token", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer tokenServer.Close()
+
+	config := &oauth2.Config{
+		ClientID:    "test_client_id",
+		RedirectURL: "http://localhost:8080/callback",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   tokenServer.URL + "/authorize",
+			TokenURL:  tokenServer.URL + "/api/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+	controller := NewSpotifyAuthenticatePKCEWithConfig(config)
+	loginSession := &mockSession{}
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/auth/login", http.NoBody)
+	authURL, err := controller.StartLogin(ctx, loginSession, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loginState := loginSession.data[session.LoginStateKey].(session.LoginState)
+	if loginState.Verifier == "" {
+		t.Fatalf("expected a code verifier in session")
+	}
+	parsedAuthURL, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	query := parsedAuthURL.Query()
+	if query.Get("code_challenge") != oauth2.S256ChallengeFromVerifier(loginState.Verifier) {
+		t.Errorf("got code challenge %s, want the S256 of the stored verifier", query.Get("code_challenge"))
+	}
+	if query.Get("code_challenge_method") != "S256" {
+		t.Errorf("got code challenge method %s, want S256", query.Get("code_challenge_method"))
+	}
+
+	ctx, _ = gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/callback?code=auth_code&state="+url.QueryEscape(loginState.State), http.NoBody)
+	token, _, err := controller.GenerateTokenFromGin(ctx, loginSession)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "pkce_access_token" {
+		t.Errorf("got access token %s, want pkce_access_token", token.AccessToken)
+	}
+	if gotVerifier != loginState.Verifier {
+		t.Errorf("got code verifier %s, want %s", gotVerifier, loginState.Verifier)
+	}
+	if gotSecret != "" {
+		t.Errorf("got client secret %s, want none", gotSecret)
+	}
+}
+
+func TestSpotifyAuthenticate_PKCEWithoutVerifier(t *testing.T) {
+	controller := NewSpotifyAuthenticatePKCEWithConfig(createMockConfig())
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/callback?code=auth_code&state="+testOAuthState, http.NoBody)
+
+	_, _, err := controller.GenerateTokenFromGin(ctx, newLoginSession())
+	if err == nil || err.Error() != ErrNoCodeVerifier {
+		t.Errorf("expected error %v, got %v", ErrNoCodeVerifier, err)
+	}
+}
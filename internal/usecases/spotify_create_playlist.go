@@ -29,22 +29,33 @@ func (u *SpotifyCreatePlaylist) AppendAlbumsTracks(ctx context.Context, albums [
 	return nil
 }
 
-func (u *SpotifyCreatePlaylist) CreateAndPopulate(ctx context.Context, name, description string) (*entities.SpotifyPlaylist, error) {
+// AppendTracks adds tracks matched on their own, after the tracks of the albums appended so far
+func (u *SpotifyCreatePlaylist) AppendTracks(uris []string) {
+	u.tracks = append(u.tracks, uris...)
+}
+
+func (u *SpotifyCreatePlaylist) CreateAndPopulate(
+	ctx context.Context,
+	name, description string,
+	progress ProgressFunc,
+) (*entities.SpotifyPlaylist, error) {
 	playlist, err := u.spotifyService.CreatePlaylist(ctx, name, description)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating playlist")
 	}
-	err = u.addToSpotifyPlaylist(ctx, playlist.ID, u.tracks)
+	err = u.addToSpotifyPlaylist(ctx, playlist.ID, u.tracks, progress)
 	if err != nil {
 		return nil, errors.Wrap(err, "error adding to playlist")
 	}
 	return &playlist, nil
 }
 
+// albumTracksBatchSize is the most albums Spotify returns in a single request
+const albumTracksBatchSize = 20
+
 func (u *SpotifyCreatePlaylist) getSpotifyTrackUris(ctx context.Context, albums []string) ([]string, error) {
-	batchSize := 20
 	uris := []string{}
-	err := batchRequests(ctx, albums, batchSize, func(ctx context.Context, batch []string) error {
+	err := batchRequests(ctx, albums, albumTracksBatchSize, func(ctx context.Context, batch []string) error {
 		tracks, err := u.spotifyService.GetAlbumsTrackUris(ctx, batch)
 		if err != nil {
 			return errors.Wrap(err, "error getting album track uris")
@@ -58,13 +69,21 @@ func (u *SpotifyCreatePlaylist) getSpotifyTrackUris(ctx context.Context, albums
 	return uris, nil
 }
 
-func (u *SpotifyCreatePlaylist) addToSpotifyPlaylist(ctx context.Context, playlistID string, tracks []string) error {
+func (u *SpotifyCreatePlaylist) addToSpotifyPlaylist(
+	ctx context.Context,
+	playlistID string,
+	tracks []string,
+	progress ProgressFunc,
+) error {
 	batchSize := 100
+	added := 0
 	return batchRequests(ctx, tracks, batchSize, func(ctx context.Context, batch []string) error {
 		err := u.spotifyService.AddToPlaylist(ctx, playlistID, batch)
 		if err != nil {
 			return errors.Wrap(err, "error adding to playlist")
 		}
+		added += len(batch)
+		progress.report(entities.ProgressEvent{Type: entities.ProgressTracksAdded, Count: added, Total: len(tracks)})
 		return nil
 	})
 }
@@ -20,7 +20,7 @@ func TestSpotifyCreatePlaylist(t *testing.T) {
 		builder := NewSpotifyCreatePlaylist(spotifyServiceMock)
 		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
 
-		err := builder.addToSpotifyPlaylist(ctx, "6rqhFgbbKwnb9MLmUQDhG6", uris)
+		err := builder.addToSpotifyPlaylist(ctx, "6rqhFgbbKwnb9MLmUQDhG6", uris, nil)
 		if err != nil {
 			t.Errorf("error is not nil")
 		}
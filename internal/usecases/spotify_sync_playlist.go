@@ -0,0 +1,124 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+)
+
+// SyncResult sums up the changes made to a synced playlist
+type SyncResult struct {
+	AddedTracks   int
+	RemovedTracks int
+	// AlbumIDs and TrackURIs are the albums and the tracks matched on their own to remember for the next sync
+	AlbumIDs  []string
+	TrackURIs []string
+}
+
+// SpotifySyncPlaylist updates a playlist created in a previous conversion
+type SpotifySyncPlaylist struct {
+	spotifyService ports.SpotifyPort
+}
+
+func NewSpotifySyncPlaylist(spotifyService ports.SpotifyPort) *SpotifySyncPlaylist {
+	return &SpotifySyncPlaylist{spotifyService: spotifyService}
+}
+
+// Sync adds the albums and tracks that weren't in the previous sync and aren't in the playlist already.
+// With removeMissing it also removes the albums and tracks of the previous sync missing from albumIDs
+// and trackURIs, tracks added to the playlist by hand are never removed
+func (u *SpotifySyncPlaylist) Sync(
+	ctx context.Context,
+	previous *entities.PlaylistSync,
+	albumIDs []string,
+	trackURIs []string,
+	removeMissing bool,
+	progress ProgressFunc,
+) (*SyncResult, error) {
+	items, err := u.spotifyService.GetPlaylistItems(ctx, previous.PlaylistID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting playlist items")
+	}
+
+	albumsInPlaylist := map[string]bool{}
+	tracksInPlaylist := map[string]bool{}
+	for _, item := range items {
+		albumsInPlaylist[item.AlbumID] = true
+		tracksInPlaylist[item.TrackURI] = true
+	}
+	syncedAlbums, syncedTracks := toSet(previous.AlbumIDs), toSet(previous.TrackURIs)
+	currentAlbums, currentTracks := toSet(albumIDs), toSet(trackURIs)
+
+	newAlbums := []string{}
+	for _, id := range albumIDs {
+		if !syncedAlbums[id] && !albumsInPlaylist[id] {
+			newAlbums = append(newAlbums, id)
+		}
+	}
+	newTracks := []string{}
+	for _, uri := range trackURIs {
+		if !syncedTracks[uri] && !tracksInPlaylist[uri] {
+			newTracks = append(newTracks, uri)
+		}
+	}
+
+	builder := NewSpotifyCreatePlaylist(u.spotifyService)
+	if err := builder.AppendAlbumsTracks(ctx, newAlbums); err != nil {
+		return nil, errors.Wrap(err, "error getting new albums tracks")
+	}
+	builder.AppendTracks(newTracks)
+	if err := builder.addToSpotifyPlaylist(ctx, previous.PlaylistID, builder.tracks, progress); err != nil {
+		return nil, err
+	}
+	result := &SyncResult{AddedTracks: len(builder.tracks)}
+
+	if !removeMissing {
+		// albums and tracks left on Discogs are remembered, so a later sync can still remove them
+		result.AlbumIDs = appendMissing(previous.AlbumIDs, albumIDs, syncedAlbums)
+		result.TrackURIs = appendMissing(previous.TrackURIs, trackURIs, syncedTracks)
+		return result, nil
+	}
+
+	removed := []string{}
+	for _, item := range items {
+		// a track is kept while it's still on Discogs, either on its own or in one of the albums
+		if currentTracks[item.TrackURI] || currentAlbums[item.AlbumID] {
+			continue
+		}
+		if syncedAlbums[item.AlbumID] || syncedTracks[item.TrackURI] {
+			removed = append(removed, item.TrackURI)
+		}
+	}
+	err = batchRequests(ctx, removed, 100, func(ctx context.Context, batch []string) error {
+		return u.spotifyService.RemoveFromPlaylist(ctx, previous.PlaylistID, batch)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error removing from playlist")
+	}
+	result.RemovedTracks = len(removed)
+	result.AlbumIDs = albumIDs
+	result.TrackURIs = trackURIs
+	return result, nil
+}
+
+// appendMissing returns the previous values followed by the current ones not among them
+func appendMissing(previous, current []string, seen map[string]bool) []string {
+	values := append([]string{}, previous...)
+	for _, value := range current {
+		if !seen[value] {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
@@ -0,0 +1,286 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	errorWrapper "github.com/martiriera/discogs-spotify/internal/core/errors"
+	"github.com/martiriera/discogs-spotify/internal/core/ports"
+)
+
+var ErrInvalidSyncInterval = errors.New("invalid sync interval, use hourly, daily or weekly")
+
+const (
+	// runs kept in the history of every schedule
+	maxSyncHistory = 20
+	// how often due schedules are looked for when the check interval isn't positive
+	defaultCheckInterval = time.Minute
+)
+
+// ContextFactory builds the context a scheduled sync runs with, holding the user's Spotify credentials
+// and their Discogs ones, nil when they didn't link a Discogs account
+type ContextFactory func(userID string, token *oauth2.Token, discogs *entities.DiscogsCredentials) context.Context
+
+// SyncScheduler re-syncs the playlists of the scheduled Discogs sources in the background,
+// submitting them as playlist jobs when they are due
+type SyncScheduler struct {
+	jobs          *PlaylistJobs
+	store         ports.SyncSchedulePort
+	contexts      ports.ContextPort
+	newContext    ContextFactory
+	checkInterval time.Duration
+	now           func() time.Time
+	// mu guards the running syncs and the updates of the stored schedules
+	mu       sync.Mutex
+	running  map[string]struct{}
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSyncScheduler checks for due schedules every checkInterval, every minute when it isn't positive
+func NewSyncScheduler(
+	jobs *PlaylistJobs,
+	store ports.SyncSchedulePort,
+	contexts ports.ContextPort,
+	newContext ContextFactory,
+	checkInterval time.Duration,
+) *SyncScheduler {
+	if checkInterval <= 0 {
+		checkInterval = defaultCheckInterval
+	}
+	return &SyncScheduler{
+		jobs:          jobs,
+		store:         store,
+		contexts:      contexts,
+		newContext:    newContext,
+		checkInterval: checkInterval,
+		now:           time.Now,
+		running:       make(map[string]struct{}),
+		stop:          make(chan struct{}),
+	}
+}
+
+// Schedule syncs the Discogs URL to its playlist every interval with the Spotify token and
+// the Discogs account in ctx, running it as soon as the scheduler checks again
+func (s *SyncScheduler) Schedule(
+	ctx context.Context,
+	userID, discogsURL string,
+	interval entities.SyncInterval,
+	removeMissing bool,
+) (*entities.SyncSchedule, error) {
+	parsedURL, err := parseDiscogsURL(discogsURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing Discogs URL")
+	}
+	if interval.Duration() == 0 {
+		return nil, ErrInvalidSyncInterval
+	}
+	token, err := s.contexts.GetToken(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting Spotify token")
+	}
+	discogs, err := s.contexts.GetDiscogsCredentials(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting Discogs credentials")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, err := s.store.Get(ctx, userID, parsedURL.Source())
+	if errorWrapper.Is(err, errorWrapper.ErrNotFound) {
+		schedule = &entities.SyncSchedule{UserID: userID, Source: parsedURL.Source()}
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting sync schedule")
+	}
+	schedule.DiscogsURL = discogsURL
+	schedule.Interval = interval
+	schedule.RemoveMissing = removeMissing
+	schedule.Token = token
+	schedule.Discogs = discogs
+	schedule.NextRunAt = s.now()
+
+	if err := s.store.Save(ctx, schedule); err != nil {
+		return nil, errors.Wrap(err, "error saving sync schedule")
+	}
+	return schedule, nil
+}
+
+func (s *SyncScheduler) List(ctx context.Context, userID string) ([]entities.SyncSchedule, error) {
+	schedules, err := s.store.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing sync schedules")
+	}
+	return schedules, nil
+}
+
+// Delete stops syncing the source, a run already in progress finishes
+func (s *SyncScheduler) Delete(ctx context.Context, userID, source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Delete(ctx, userID, source)
+}
+
+// Start checks for due schedules every check interval until Stop is called
+func (s *SyncScheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.checkInterval)
+		defer ticker.Stop()
+		for {
+			s.runDue()
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops checking for due schedules and waits for the running syncs to be recorded,
+// giving up when ctx is done. The syncs still running then are recorded once the jobs close, see Wait
+func (s *SyncScheduler) Stop(ctx context.Context) {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("gave up waiting for the running syncs to finish")
+	}
+}
+
+// Wait waits for the running syncs to be recorded, to be called after Stop once the jobs are closed
+// so the syncs they canceled are recorded too
+func (s *SyncScheduler) Wait() {
+	s.wg.Wait()
+}
+
+// runDue submits a job for every due schedule that isn't running yet
+func (s *SyncScheduler) runDue() {
+	ctx := context.Background()
+	schedules, err := s.store.List(ctx)
+	if err != nil {
+		log.Println("error listing sync schedules", err)
+		return
+	}
+
+	now := s.now()
+	for i := range schedules {
+		if schedules[i].Due(now) {
+			s.submit(ctx, &schedules[i], now)
+		}
+	}
+}
+
+func (s *SyncScheduler) submit(ctx context.Context, schedule *entities.SyncSchedule, now time.Time) {
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := scheduleKey(schedule.UserID, schedule.Source)
+	if _, running := s.running[key]; running {
+		return
+	}
+
+	runCtx := s.newContext(schedule.UserID, schedule.Token, schedule.Discogs)
+	options := entities.PlaylistOptions{Sync: true, RemoveMissing: schedule.RemoveMissing}
+	job, err := s.jobs.Submit(runCtx, schedule.UserID, schedule.DiscogsURL, options)
+	if errors.Is(err, ErrJobQueueFull) || errors.Is(err, ErrJobsClosed) {
+		// tried again on the next check, or on the next start
+		log.Println("jobs not accepted, delaying sync of", schedule.Source, err)
+		return
+	}
+
+	schedule.NextRunAt = now.Add(schedule.Interval.Duration())
+	if err != nil {
+		appendRun(schedule, entities.SyncRun{
+			StartedAt:  now,
+			FinishedAt: now,
+			Stage:      entities.JobFailed,
+			Error:      err.Error(),
+		})
+	}
+	if err := s.store.Save(ctx, schedule); err != nil {
+		log.Println("error saving sync schedule", schedule.Source, err)
+	}
+	if job == nil {
+		return
+	}
+
+	s.running[key] = struct{}{}
+	s.wg.Add(1)
+	go s.watch(runCtx, schedule.UserID, schedule.Source, job)
+}
+
+// watch waits for the job to finish and records it in the schedule history,
+// along with the token in case it was refreshed during the run
+func (s *SyncScheduler) watch(runCtx context.Context, userID, source string, job *entities.Job) {
+	defer s.wg.Done()
+
+	ctx := context.Background()
+	if _, events, unsubscribe, err := s.jobs.Subscribe(ctx, userID, job.ID); err == nil {
+		for range events {
+		}
+		unsubscribe()
+	}
+
+	run := entities.SyncRun{JobID: job.ID, StartedAt: job.CreatedAt, FinishedAt: s.now(), Stage: entities.JobFailed}
+	if finished, err := s.jobs.Get(ctx, userID, job.ID); err == nil {
+		run.Stage = finished.Stage
+		if finished.Err != nil {
+			run.Error = finished.Err.Error()
+		}
+		if finished.Playlist != nil {
+			run.TracksAdded = finished.Playlist.TracksAdded
+			run.TracksRemoved = finished.Playlist.TracksRemoved
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, scheduleKey(userID, source))
+
+	schedule, err := s.store.Get(ctx, userID, source)
+	if err != nil {
+		// deleted while running
+		return
+	}
+	appendRun(schedule, run)
+	if token, err := s.contexts.GetToken(runCtx); err == nil {
+		schedule.Token = token
+	}
+	if err := s.store.Save(ctx, schedule); err != nil {
+		log.Println("error saving sync schedule", source, err)
+	}
+}
+
+func appendRun(schedule *entities.SyncSchedule, run entities.SyncRun) {
+	schedule.History = append(schedule.History, run)
+	if len(schedule.History) > maxSyncHistory {
+		schedule.History = schedule.History[len(schedule.History)-maxSyncHistory:]
+	}
+}
+
+func scheduleKey(userID, source string) string {
+	return userID + " " + source
+}
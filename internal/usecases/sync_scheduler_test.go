@@ -0,0 +1,158 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/martiriera/discogs-spotify/internal/adapters/discogs"
+	"github.com/martiriera/discogs-spotify/internal/adapters/spotify"
+	"github.com/martiriera/discogs-spotify/internal/core/entities"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/jobs"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/schedules"
+	"github.com/martiriera/discogs-spotify/internal/infrastructure/session"
+	"github.com/martiriera/discogs-spotify/util"
+)
+
+// valueContextProvider reads the token stored as a plain context value, like util.NewTestContextWithToken
+type valueContextProvider struct{}
+
+func (valueContextProvider) GetToken(ctx context.Context) (*oauth2.Token, error) {
+	token, ok := ctx.Value(session.SpotifyTokenKey).(*oauth2.Token)
+	if !ok {
+		return nil, errors.New("token not found in context")
+	}
+	return token, nil
+}
+
+func (valueContextProvider) SetToken(context.Context, *oauth2.Token) error {
+	return errors.New("not supported")
+}
+
+func (valueContextProvider) GetUserID(context.Context) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (valueContextProvider) SetUserID(context.Context, string) error {
+	return errors.New("not supported")
+}
+
+func (valueContextProvider) GetDiscogsCredentials(ctx context.Context) (*entities.DiscogsCredentials, error) {
+	credentials, _ := ctx.Value(session.DiscogsCredentialsKey).(*entities.DiscogsCredentials)
+	return credentials, nil
+}
+
+func TestSyncScheduler(t *testing.T) {
+	newScheduler := func(t *testing.T) (*SyncScheduler, *schedules.Store) {
+		t.Helper()
+		discogsServiceMock := &discogs.ServiceMock{
+			Response: entities.MotherTwoDiscogsAlbums(),
+		}
+		spotifyServiceMock := &spotify.ServiceMock{
+			SearchAlbumResults: entities.MotherSpotifySearchResults()}
+		controller := NewPlaylistController(discogsServiceMock, spotifyServiceMock)
+		playlistJobs := NewPlaylistJobs(controller, jobs.NewInMemoryStore(), 1)
+		t.Cleanup(func() { playlistJobs.Close(context.Background()) })
+
+		store := schedules.NewInMemoryStore()
+		newContext := func(_ string, token *oauth2.Token, _ *entities.DiscogsCredentials) context.Context {
+			return util.NewTestContextWithToken(session.SpotifyTokenKey, token)
+		}
+		return NewSyncScheduler(playlistJobs, store, valueContextProvider{}, newContext, time.Minute), store
+	}
+
+	t.Run("due schedule runs and is recorded", func(t *testing.T) {
+		scheduler, store := newScheduler(t)
+		now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		scheduler.now = func() time.Time { return now }
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test", RefreshToken: "refresh"})
+
+		_, err := scheduler.Schedule(ctx, "wizzler", "https://www.discogs.com/user/digger/collection", entities.SyncDaily, false)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+
+		scheduler.runDue()
+		stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		scheduler.Stop(stopCtx)
+
+		schedule, err := store.Get(ctx, "wizzler", "collection/digger")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if want := now.Add(24 * time.Hour); !schedule.NextRunAt.Equal(want) {
+			t.Errorf("got next run at %v, want %v", schedule.NextRunAt, want)
+		}
+		if len(schedule.History) != 1 {
+			t.Fatalf("got %d runs, want 1", len(schedule.History))
+		}
+		if run := schedule.History[0]; run.Stage != entities.JobDone || run.JobID == "" || run.TracksAdded != 2 {
+			t.Errorf("got run %+v, want a done job adding 2 tracks", run)
+		}
+		if schedule.Token.RefreshToken != "refresh" {
+			t.Errorf("got refresh token %q, want %q", schedule.Token.RefreshToken, "refresh")
+		}
+
+		scheduler.runDue()
+		schedule, _ = store.Get(ctx, "wizzler", "collection/digger")
+		if len(schedule.History) != 1 {
+			t.Errorf("got %d runs, want the schedule not to run before it's due", len(schedule.History))
+		}
+	})
+
+	t.Run("sync canceled at shutdown is recorded", func(t *testing.T) {
+		scheduler, store := newScheduler(t)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		_, err := scheduler.Schedule(ctx, "wizzler", "https://www.discogs.com/user/digger/collection", entities.SyncDaily, false)
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+
+		scheduler.runDue()
+		expired, cancel := context.WithCancel(context.Background())
+		cancel()
+		scheduler.Stop(expired)
+		scheduler.jobs.Close(expired)
+		scheduler.Wait()
+
+		schedule, err := store.Get(ctx, "wizzler", "collection/digger")
+		if err != nil {
+			t.Fatalf("did not expect error, got %v", err)
+		}
+		if len(schedule.History) != 1 {
+			t.Fatalf("got %d runs, want the sync recorded", len(schedule.History))
+		}
+		if run := schedule.History[0]; run.JobID == "" || (run.Stage != entities.JobDone && run.Stage != entities.JobFailed) {
+			t.Errorf("got run %+v, want the finished job", run)
+		}
+
+		scheduler.runDue()
+		if schedule, _ = store.Get(ctx, "wizzler", "collection/digger"); len(schedule.History) != 1 {
+			t.Errorf("got %d runs, want no sync submitted once stopped", len(schedule.History))
+		}
+	})
+
+	t.Run("check interval that isn't positive falls back to the default", func(t *testing.T) {
+		scheduler := NewSyncScheduler(nil, schedules.NewInMemoryStore(), valueContextProvider{}, nil, 0)
+		if scheduler.checkInterval != defaultCheckInterval {
+			t.Errorf("got check interval %v, want %v", scheduler.checkInterval, defaultCheckInterval)
+		}
+		scheduler.Start()
+		scheduler.Stop(context.Background())
+	})
+
+	t.Run("invalid interval", func(t *testing.T) {
+		scheduler, _ := newScheduler(t)
+		ctx := util.NewTestContextWithToken(session.SpotifyTokenKey, &oauth2.Token{AccessToken: "test"})
+
+		_, err := scheduler.Schedule(ctx, "wizzler", "https://www.discogs.com/user/digger/collection", "monthly", false)
+		if !errors.Is(err, ErrInvalidSyncInterval) {
+			t.Errorf("got %v, want %v", err, ErrInvalidSyncInterval)
+		}
+	})
+}
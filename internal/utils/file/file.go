@@ -0,0 +1,31 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic writes data to a temporary file next to path and renames it over path,
+// so readers and crashes never see a half written file. The file is only readable by its owner,
+// as some of the files keep user credentials
+func WriteAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,50 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+var ErrMalformed = errors.New("encrypted data is malformed")
+
+// Box encrypts and authenticates data with AES-GCM, the nonce is kept in front of the encrypted data
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox derives the AES-256 key from the passphrase, so any string long enough to guess is a valid key
+func NewBox(passphrase string) (*Box, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty encryption key")
+	}
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+func (b *Box) Seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(data)+b.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// Open decrypts data sealed by a box with the same key, failing when it was sealed with another one or changed
+func (b *Box) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < b.aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, data := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	return b.aead.Open(nil, nonce, data, nil)
+}
@@ -22,7 +22,10 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	c := container.NewContainer(cfg)
+	c, err := container.NewContainer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to start: %v", err)
+	}
 
 	server := c.GetHTTPServer()
 
@@ -49,5 +52,12 @@ func main() {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	// the jobs get their own time to finish, the server shutdown may have used all of it
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer closeCancel()
+
+	log.Println("Stopping background jobs and scheduled syncs...")
+	c.Close(closeCtx)
+
 	log.Println("Server exited properly")
 }